@@ -0,0 +1,70 @@
+package gwt
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/glanotte/grove/pkg/worktree"
+	"github.com/spf13/cobra"
+)
+
+func newCertsCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "certs",
+		Short: "Manage the local CA used for worktree TLS certificates",
+	}
+
+	cmd.AddCommand(newCertsTrustCmd())
+	return cmd
+}
+
+func newCertsTrustCmd() *cobra.Command {
+	var (
+		install bool
+		yes     bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "trust",
+		Short: "Create the local CA if needed and explain how to trust it",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			manager, err := loadManager()
+			if err != nil {
+				return err
+			}
+
+			ca, err := manager.CertificateAuthorityContext(cmd.Context())
+			if err != nil {
+				return err
+			}
+			fmt.Printf("CA certificate: %s\n\n", ca.CertPath)
+
+			if !install {
+				fmt.Print(worktree.TrustInstructions(ca.CertPath))
+				return nil
+			}
+
+			if !yes {
+				fmt.Print("Install the grove CA into the system trust store? [y/N] ")
+				answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+				if a := strings.ToLower(strings.TrimSpace(answer)); a != "y" && a != "yes" {
+					fmt.Println("Not installed.")
+					return nil
+				}
+			}
+
+			if err := manager.InstallCAContext(cmd.Context(), ca.CertPath); err != nil {
+				return err
+			}
+			fmt.Println("CA installed into the system trust store")
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&install, "install", false, "Install the CA with update-ca-certificates (requires root)")
+	cmd.Flags().BoolVarP(&yes, "yes", "y", false, "Don't ask for confirmation before installing")
+	return cmd
+}
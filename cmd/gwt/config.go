@@ -0,0 +1,96 @@
+package gwt
+
+import (
+	"fmt"
+
+	"github.com/glanotte/grove/pkg/worktree"
+	"github.com/spf13/cobra"
+)
+
+func newConfigCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "config",
+		Short: "Inspect the grove configuration",
+	}
+
+	cmd.AddCommand(
+		newConfigShowCmd(),
+		newConfigMigrateCmd(),
+		newConfigSchemaCmd(),
+	)
+	return cmd
+}
+
+func newConfigShowCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "show",
+		Short: "Print the effective configuration and where each value comes from",
+		Long: `Print the configuration after every layer is merged: the user, project
+and local config files, the selected environment overlay (--env or the
+config's environment), the worktree's .grove-worktree.yaml and GROVE_*
+environment variables. Each value is annotated with its source.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			manager, err := loadManager()
+			if err != nil {
+				return err
+			}
+
+			out, err := manager.EffectiveConfig()
+			if err != nil {
+				return err
+			}
+			if manager.Env != "" {
+				fmt.Printf("# environment: %s\n", manager.Env)
+			}
+			fmt.Print(string(out))
+			return nil
+		},
+	}
+}
+
+func newConfigMigrateCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "migrate",
+		Short: "Upgrade the config files to the current schema version",
+		Long: `Rewrite every config file grove reads in the current schema version: the
+user config, .grove/config.yaml, .grove/config.local.yaml and the worktree's
+.grove-worktree.yaml. Each original is kept next to it as
+<file>.v<version>.bak.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			manager, err := loadManager()
+			if err != nil {
+				return err
+			}
+
+			migrated, err := manager.MigrateConfigContext(cmd.Context())
+			for _, m := range migrated {
+				fmt.Printf("Migrated %s from version %d to %d (backup: %s)\n", m.Path, m.FromVersion, worktree.CurrentConfigVersion, m.Backup)
+			}
+			if err != nil {
+				return err
+			}
+			if len(migrated) == 0 {
+				fmt.Printf("Config is already at version %d\n", worktree.CurrentConfigVersion)
+			}
+			return nil
+		},
+	}
+}
+
+func newConfigSchemaCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "schema",
+		Short: "Print a JSON Schema for .grove/config.yaml",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			schema, err := worktree.ConfigSchema()
+			if err != nil {
+				return err
+			}
+			fmt.Println(string(schema))
+			return nil
+		},
+	}
+}
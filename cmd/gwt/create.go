@@ -2,6 +2,8 @@ package gwt
 
 import (
 	"fmt"
+
+	"github.com/glanotte/grove/pkg/worktree"
 	"github.com/spf13/cobra"
 )
 
@@ -9,6 +11,7 @@ func newCreateCmd() *cobra.Command {
 	var (
 		from     string
 		template string
+		dbFrom   string
 	)
 
 	cmd := &cobra.Command{
@@ -17,13 +20,23 @@ func newCreateCmd() *cobra.Command {
 		Args:  cobra.ExactArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
 			branchName := args[0]
+
+			manager, err := loadManager()
+			if err != nil {
+				return err
+			}
+
 			fmt.Printf("Creating worktree for branch %s...\n", branchName)
-			// Implementation would go here
-			return nil
+			return manager.CreateContext(cmd.Context(), branchName, worktree.CreateOptions{
+				BaseBranch: from,
+				Template:   template,
+				DBFrom:     dbFrom,
+			})
 		},
 	}
 
 	cmd.Flags().StringVar(&from, "from", "main", "Base branch to create from")
-	cmd.Flags().StringVar(&template, "template", "default", "Template to use")
+	cmd.Flags().StringVar(&template, "template", "", "Template to use (default from config)")
+	cmd.Flags().StringVar(&dbFrom, "db-from", "", "Clone the database of another worktree")
 	return cmd
 }
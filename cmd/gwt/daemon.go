@@ -0,0 +1,25 @@
+package gwt
+
+import (
+	"github.com/spf13/cobra"
+)
+
+func newDaemonCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "daemon",
+		Short: "Run scheduled database backups",
+		Long: `Run grove's background tasks in the foreground.
+
+Every worktree database is backed up on database.backup.schedule, and backups
+older than database.backup.retention_days are pruned.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			manager, err := loadManager()
+			if err != nil {
+				return err
+			}
+
+			return manager.RunDaemon(cmd.Context())
+		},
+	}
+}
@@ -0,0 +1,126 @@
+package gwt
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+func newDBCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "db",
+		Short: "Manage worktree databases",
+	}
+
+	cmd.AddCommand(newDBCloneCmd(), newDBReseedCmd(), newDBBackupCmd(), newDBRestoreCmd())
+	return cmd
+}
+
+func newDBCloneCmd() *cobra.Command {
+	var force bool
+
+	cmd := &cobra.Command{
+		Use:   "clone <source-worktree> <destination-worktree>",
+		Short: "Copy one worktree's database into another's",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			manager, err := loadManager()
+			if err != nil {
+				return err
+			}
+			return manager.CloneDatabaseContext(cmd.Context(), args[0], args[1], force)
+		},
+	}
+
+	cmd.Flags().BoolVar(&force, "force", false, "Replace the destination database if it exists")
+	return cmd
+}
+
+func newDBReseedCmd() *cobra.Command {
+	var yes bool
+
+	cmd := &cobra.Command{
+		Use:   "reseed <worktree-name>",
+		Short: "Reset a worktree's database to the seed data",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			manager, err := loadManager()
+			if err != nil {
+				return err
+			}
+
+			if !yes {
+				fmt.Printf("This drops all data in the database of '%s'. Continue? [y/N] ", args[0])
+				answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+				if a := strings.ToLower(strings.TrimSpace(answer)); a != "y" && a != "yes" {
+					fmt.Println("Aborted.")
+					return nil
+				}
+			}
+
+			return manager.ReseedContext(cmd.Context(), args[0])
+		},
+	}
+
+	cmd.Flags().BoolVarP(&yes, "yes", "y", false, "Don't ask for confirmation")
+	return cmd
+}
+
+func newDBBackupCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "backup [worktree-name]",
+		Short: "Back up a worktree's database, or every worktree's",
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			manager, err := loadManager()
+			if err != nil {
+				return err
+			}
+
+			if len(args) == 1 {
+				_, err = manager.BackupDatabaseContext(cmd.Context(), args[0])
+				return err
+			}
+			_, err = manager.BackupAllContext(cmd.Context())
+			return err
+		},
+	}
+}
+
+func newDBRestoreCmd() *cobra.Command {
+	var yes bool
+
+	cmd := &cobra.Command{
+		Use:   "restore <worktree-name> [backup]",
+		Short: "Restore a worktree's database from a backup (the latest by default)",
+		Args:  cobra.RangeArgs(1, 2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			manager, err := loadManager()
+			if err != nil {
+				return err
+			}
+
+			backup := ""
+			if len(args) == 2 {
+				backup = args[1]
+			}
+
+			if !yes {
+				fmt.Printf("This replaces all data in the database of '%s'. Continue? [y/N] ", args[0])
+				answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+				if a := strings.ToLower(strings.TrimSpace(answer)); a != "y" && a != "yes" {
+					fmt.Println("Aborted.")
+					return nil
+				}
+			}
+
+			return manager.RestoreDatabaseContext(cmd.Context(), args[0], backup)
+		},
+	}
+
+	cmd.Flags().BoolVarP(&yes, "yes", "y", false, "Don't ask for confirmation")
+	return cmd
+}
@@ -0,0 +1,53 @@
+package gwt
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+func newDNSCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "dns",
+		Short: "Run a DNS server for worktree subdomains",
+		Long: `Run a DNS server answering A/AAAA queries for worktree subdomains.
+
+Unknown branches get NXDOMAIN. Use 'grove dns config' to forward the project
+domain to this server instead of editing the hosts file.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			manager, err := loadManager()
+			if err != nil {
+				return err
+			}
+
+			return manager.RunDNS(cmd.Context())
+		},
+	}
+
+	cmd.AddCommand(newDNSConfigCmd())
+	return cmd
+}
+
+func newDNSConfigCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:       "config <systemd-resolved|dnsmasq|macos>",
+		Short:     "Print a resolver snippet forwarding the project domain to grove dns",
+		Args:      cobra.ExactArgs(1),
+		ValidArgs: []string{"systemd-resolved", "dnsmasq", "macos"},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			manager, err := loadManager()
+			if err != nil {
+				return err
+			}
+
+			snippet, err := manager.DNSResolverConfig(args[0])
+			if err != nil {
+				return err
+			}
+
+			fmt.Print(snippet)
+			return nil
+		},
+	}
+}
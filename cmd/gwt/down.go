@@ -0,0 +1,20 @@
+package gwt
+
+import (
+	"github.com/spf13/cobra"
+)
+
+func newDownCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "down <worktree-name>",
+		Short: "Stop a worktree's containers",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			manager, err := loadManager()
+			if err != nil {
+				return err
+			}
+			return manager.DownContext(cmd.Context(), args[0])
+		},
+	}
+}
@@ -0,0 +1,55 @@
+package gwt
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+func newEnvCmd() *cobra.Command {
+	var format string
+
+	cmd := &cobra.Command{
+		Use:   "env <worktree-name>",
+		Short: "Print a worktree's generated variables",
+		Long: `Print the values grove generated for a worktree's generate: variables,
+such as per-worktree database passwords, as NAME=value lines:
+
+  eval "$(grove env feature-x --format export)"`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if format != "env" && format != "export" && format != "json" {
+				return fmt.Errorf("unknown format '%s' (expected env, export or json)", format)
+			}
+
+			manager, err := loadManager()
+			if err != nil {
+				return err
+			}
+
+			vars, err := manager.GeneratedVariablesContext(cmd.Context(), args[0])
+			if err != nil {
+				return err
+			}
+
+			if format == "json" {
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "  ")
+				return enc.Encode(vars)
+			}
+
+			for _, v := range vars {
+				if format == "export" {
+					fmt.Print("export ")
+				}
+				fmt.Printf("%s=%s\n", v.Env, v.Value)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&format, "format", "env", "Output format (env|export|json)")
+	return cmd
+}
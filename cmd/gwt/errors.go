@@ -0,0 +1,71 @@
+package gwt
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/glanotte/grove/pkg/git"
+	"github.com/glanotte/grove/pkg/worktree"
+	"github.com/spf13/cobra"
+)
+
+// hintError adds a suggested fix to an error
+type hintError struct {
+	err  error
+	hint string
+}
+
+func (e *hintError) Error() string {
+	return fmt.Sprintf("%v\n  %s", e.err, e.hint)
+}
+
+func (e *hintError) Unwrap() error {
+	return e.err
+}
+
+// explainError attaches a suggested fix to the git failures and timeouts
+// users can act on
+func explainError(err error) error {
+	var (
+		checkedOut *git.ErrBranchCheckedOut
+		pathExists *git.ErrPathExists
+		unknownRef *git.ErrUnknownRef
+		dirty      *git.ErrWorktreeDirty
+		locked     *git.ErrWorktreeLocked
+		timeout    *worktree.TimeoutError
+	)
+
+	var hint string
+	switch {
+	case err == nil:
+		return nil
+	case errors.As(err, &checkedOut):
+		hint = fmt.Sprintf("A branch can only be checked out in one worktree. Use the existing one at %s, or branch off it with 'grove create <new-branch> --from %s'.",
+			checkedOut.Path, checkedOut.Branch)
+	case errors.As(err, &pathExists):
+		hint = fmt.Sprintf("Remove or rename %s, or run 'git worktree prune' if it is left over from a deleted worktree.", pathExists.Path)
+	case errors.As(err, &unknownRef):
+		hint = fmt.Sprintf("Check the spelling of '%s', or run 'git fetch' if it only exists on a remote.", unknownRef.Ref)
+	case errors.As(err, &dirty):
+		hint = "Commit or stash the changes first, or pass --force to discard them."
+	case errors.As(err, &locked):
+		hint = fmt.Sprintf("Run 'git worktree unlock %s' first.", locked.Path)
+	case errors.As(err, &timeout):
+		hint = fmt.Sprintf("If it just needs longer, raise timeouts.%s in .grove/config.yaml (0 disables the limit).", timeout.Step)
+	default:
+		return err
+	}
+	return &hintError{err: err, hint: hint}
+}
+
+// explainErrors applies explainError to every command under cmd
+func explainErrors(cmd *cobra.Command) {
+	if run := cmd.RunE; run != nil {
+		cmd.RunE = func(cmd *cobra.Command, args []string) error {
+			return explainError(run(cmd, args))
+		}
+	}
+	for _, sub := range cmd.Commands() {
+		explainErrors(sub)
+	}
+}
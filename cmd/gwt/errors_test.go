@@ -0,0 +1,50 @@
+package gwt
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/glanotte/grove/pkg/git"
+	"github.com/glanotte/grove/pkg/worktree"
+)
+
+func TestExplainError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		hint string
+	}{
+		{"nil", nil, ""},
+		{"unrelated", errors.New("boom"), ""},
+		{"checked out", &git.ErrBranchCheckedOut{Branch: "f1", Path: "/repo/worktrees/f1"}, "Use the existing one at /repo/worktrees/f1"},
+		{"path exists", &git.ErrPathExists{Path: "/repo/worktrees/f1"}, "Remove or rename /repo/worktrees/f1"},
+		{"unknown ref", &git.ErrUnknownRef{Ref: "mian"}, "Check the spelling of 'mian'"},
+		{"dirty", &git.ErrWorktreeDirty{Path: "/repo/worktrees/f1"}, "--force"},
+		{"locked", &git.ErrWorktreeLocked{Path: "/repo/worktrees/f1"}, "git worktree unlock /repo/worktrees/f1"},
+		{"timeout", &worktree.TimeoutError{Step: "git", Op: "git worktree add", Timeout: time.Minute}, "raise timeouts.git"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Errors reach the CLI wrapped by the Manager
+			err := tt.err
+			if err != nil {
+				err = fmt.Errorf("failed to create git worktree: %w", err)
+			}
+
+			got := explainError(err)
+			if tt.hint == "" {
+				if got != err {
+					t.Errorf("explainError() = %v, want the error unchanged", got)
+				}
+				return
+			}
+			if !strings.Contains(got.Error(), tt.hint) || !errors.Is(got, tt.err) {
+				t.Errorf("explainError() = %q, want it to wrap %v and mention %q", got, tt.err, tt.hint)
+			}
+		})
+	}
+}
@@ -0,0 +1,74 @@
+package gwt
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/glanotte/grove/pkg/worktree"
+	"github.com/spf13/cobra"
+)
+
+func newHostsCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "hosts",
+		Short: "Manage hosts file entries for worktree subdomains",
+	}
+
+	cmd.AddCommand(newHostsSyncCmd(), newHostsApplyCmd())
+	return cmd
+}
+
+func newHostsSyncCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "sync",
+		Short: "Reconcile the hosts file with existing worktrees",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			manager, err := loadManager()
+			if err != nil {
+				return err
+			}
+
+			entries, err := manager.SyncHostsContext(cmd.Context())
+			if err != nil {
+				return err
+			}
+
+			for _, e := range entries {
+				fmt.Printf("%s\t%s\n", e.Address, e.Host)
+			}
+			fmt.Printf("%d hosts entries in sync\n", len(entries))
+			return nil
+		},
+	}
+}
+
+// newHostsApplyCmd is the privileged helper grove runs through sudo when the
+// hosts file isn't writable. It reads "address host" lines from stdin.
+func newHostsApplyCmd() *cobra.Command {
+	var (
+		file    string
+		project string
+	)
+
+	cmd := &cobra.Command{
+		Use:    "apply",
+		Short:  "Replace the grove block of a hosts file with entries from stdin",
+		Hidden: true,
+		Args:   cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			entries, err := worktree.ReadHostEntries(os.Stdin)
+			if err != nil {
+				return err
+			}
+
+			hosts := &worktree.HostsFile{Path: file, Project: project}
+			return hosts.Write(entries)
+		},
+	}
+
+	cmd.Flags().StringVar(&file, "file", "/etc/hosts", "Hosts file to update")
+	cmd.Flags().StringVar(&project, "project", "", "Project whose block is replaced")
+	cmd.MarkFlagRequired("project")
+	return cmd
+}
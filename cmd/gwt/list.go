@@ -1,10 +1,25 @@
 package gwt
 
 import (
+	"encoding/json"
 	"fmt"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+
+	"github.com/glanotte/grove/pkg/worktree"
 	"github.com/spf13/cobra"
 )
 
+// listEntry is a worktree as shown by `grove list`
+type listEntry struct {
+	Name    string            `json:"name"`
+	Branch  string            `json:"branch"`
+	Path    string            `json:"path"`
+	URL     string            `json:"url,omitempty"`
+	Backups []worktree.Backup `json:"backups"`
+}
+
 func newListCmd() *cobra.Command {
 	var format string
 
@@ -12,9 +27,59 @@ func newListCmd() *cobra.Command {
 		Use:   "list",
 		Short: "List all worktrees with their status",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			fmt.Println("Listing worktrees...")
-			// Implementation would go here
-			return nil
+			if format != "table" && format != "json" {
+				return fmt.Errorf("unknown format '%s' (expected table or json)", format)
+			}
+
+			manager, err := loadManager()
+			if err != nil {
+				return err
+			}
+
+			if _, err := manager.TryReconcileStateContext(cmd.Context()); err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: failed to reconcile state: %v\n", err)
+			}
+
+			worktrees, err := manager.ListWorktreesContext(cmd.Context())
+			if err != nil {
+				return err
+			}
+
+			entries := make([]listEntry, 0, len(worktrees))
+			for _, wt := range worktrees {
+				name := filepath.Base(wt.Path)
+				backups, err := manager.BackupsContext(cmd.Context(), name)
+				if err != nil {
+					return err
+				}
+				if backups == nil {
+					backups = []worktree.Backup{}
+				}
+				entries = append(entries, listEntry{
+					Name:    name,
+					Branch:  wt.Branch,
+					Path:    wt.Path,
+					URL:     wt.URL,
+					Backups: backups,
+				})
+			}
+
+			if format == "json" {
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "  ")
+				return enc.Encode(entries)
+			}
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "NAME\tBRANCH\tURL\tLAST BACKUP")
+			for _, e := range entries {
+				lastBackup := "-"
+				if len(e.Backups) > 0 {
+					lastBackup = e.Backups[0].CreatedAt.Local().Format("2006-01-02 15:04")
+				}
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", e.Name, e.Branch, e.URL, lastBackup)
+			}
+			return w.Flush()
 		},
 	}
 
@@ -0,0 +1,25 @@
+package gwt
+
+import (
+	"github.com/spf13/cobra"
+)
+
+func newProxyCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "proxy",
+		Short: "Run the builtin reverse proxy for worktree subdomains",
+		Long: `Run the builtin reverse proxy used by proxy_type: builtin.
+
+Requests are routed by Host header to each worktree's web port. Routes are
+reloaded automatically as worktrees are created and removed.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			manager, err := loadManager()
+			if err != nil {
+				return err
+			}
+
+			return manager.RunProxy(cmd.Context())
+		},
+	}
+}
@@ -2,6 +2,7 @@ package gwt
 
 import (
 	"fmt"
+
 	"github.com/spf13/cobra"
 )
 
@@ -14,9 +15,14 @@ func newRemoveCmd() *cobra.Command {
 		Args:  cobra.ExactArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
 			worktreeName := args[0]
+
+			manager, err := loadManager()
+			if err != nil {
+				return err
+			}
+
 			fmt.Printf("Removing worktree %s...\n", worktreeName)
-			// Implementation would go here
-			return nil
+			return manager.RemoveWorktreeContext(cmd.Context(), worktreeName, force)
 		},
 	}
 
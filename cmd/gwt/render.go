@@ -0,0 +1,25 @@
+package gwt
+
+import (
+	"github.com/spf13/cobra"
+)
+
+func newRenderCmd() *cobra.Command {
+	var template string
+
+	cmd := &cobra.Command{
+		Use:   "render <worktree-name>",
+		Short: "Re-render a worktree's templates",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			manager, err := loadManager()
+			if err != nil {
+				return err
+			}
+			return manager.RenderContext(cmd.Context(), args[0], template)
+		},
+	}
+
+	cmd.Flags().StringVar(&template, "template", "", "Template to use (default: the one the worktree was created with)")
+	return cmd
+}
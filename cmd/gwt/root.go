@@ -1,20 +1,54 @@
 package gwt
 
 import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/glanotte/grove/pkg/git"
+	"github.com/glanotte/grove/pkg/runner"
+	"github.com/glanotte/grove/pkg/worktree"
 	"github.com/spf13/cobra"
 )
 
-func NewRootCmd(version, commit, date string) *cobra.Command {
-	var configFile string
+// managerOptions holds the global flags used to load the grove config
+var managerOptions worktree.Options
+
+var (
+	// lockTimeout bounds the wait for other grove processes
+	lockTimeout time.Duration
+	// commandPath is the running command, recorded in the project lock
+	commandPath string
+	// verbose echoes external commands as they run
+	verbose bool
+)
+
+// Execute runs the grove CLI. The first Ctrl-C or SIGTERM cancels the running
+// command's context so it can roll back; a second one quits immediately.
+func Execute(version, commit, date string) error {
+	ctx, stop := interruptContext(context.Background())
+	defer stop()
+
+	return NewRootCmd(version, commit, date).ExecuteContext(ctx)
+}
 
+func NewRootCmd(version, commit, date string) *cobra.Command {
 	rootCmd := &cobra.Command{
 		Use:   "grove",
 		Short: "Git worktree manager with Docker and template support",
 		Long: `grove is a CLI tool for managing git worktrees with template support,
 Docker integration, and automatic web serving configuration.`,
+		PersistentPreRun: func(cmd *cobra.Command, args []string) {
+			commandPath = cmd.CommandPath()
+		},
 	}
 
-	rootCmd.PersistentFlags().StringVar(&configFile, "config", "", "config file (default is .grove/config.yaml)")
+	rootCmd.PersistentFlags().StringVar(&managerOptions.ConfigPath, "config", "", "config file (default is .grove/config.yaml)")
+	rootCmd.PersistentFlags().StringVar(&managerOptions.Env, "env", "", "environment overlay to apply (default from config)")
+	rootCmd.PersistentFlags().BoolVarP(&verbose, "verbose", "v", false, "print every external command grove runs")
+	rootCmd.PersistentFlags().DurationVar(&lockTimeout, "lock-timeout", worktree.DefaultLockTimeout, "how long to wait for another grove process to finish")
 
 	rootCmd.AddCommand(
 		newInitCmd(),
@@ -22,8 +56,88 @@ Docker integration, and automatic web serving configuration.`,
 		newListCmd(),
 		newRemoveCmd(),
 		newSwitchCmd(),
+		newUpCmd(),
+		newDownCmd(),
+		newRenderCmd(),
+		newEnvCmd(),
+		newDBCmd(),
+		newDaemonCmd(),
+		newProxyCmd(),
+		newCertsCmd(),
+		newHostsCmd(),
+		newDNSCmd(),
+		newConfigCmd(),
+		newSecretsCmd(),
+		newStateCmd(),
 		newVersionCmd(version, commit, date),
 	)
+	explainErrors(rootCmd)
 
 	return rootCmd
 }
+
+// loadManager creates a worktree manager for the grove project containing the
+// working directory
+func loadManager() (*worktree.Manager, error) {
+	dir, err := os.Getwd()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get working directory: %w", err)
+	}
+
+	root := findGroveRoot(dir)
+	opts := managerOptions
+	if opts.ConfigPath != "" {
+		if opts.ConfigPath, err = filepath.Abs(opts.ConfigPath); err != nil {
+			return nil, fmt.Errorf("failed to resolve config path: %w", err)
+		}
+	}
+	opts.WorktreeDir = findWorktreeConfig(dir, root)
+
+	manager, err := worktree.NewManagerWithOptions(root, opts)
+	if err != nil {
+		return nil, err
+	}
+	manager.Passphrase = promptPassphrase()
+	manager.LockTimeout = lockTimeout
+	manager.Command = commandPath
+	manager.Verbose = verbose
+	return manager, nil
+}
+
+// findWorktreeConfig walks up from dir to root looking for the directory with
+// a .grove-worktree.yaml, returning "" when there is none
+func findWorktreeConfig(dir, root string) string {
+	for current := dir; ; {
+		if _, err := os.Stat(filepath.Join(current, ".grove-worktree.yaml")); err == nil {
+			return current
+		}
+		parent := filepath.Dir(current)
+		if current == root || parent == current {
+			return ""
+		}
+		current = parent
+	}
+}
+
+// findGroveRoot returns the grove project containing dir. Linked worktrees
+// check out their own copy of .grove, so inside git the project is the main
+// worktree; elsewhere it is the first directory up from dir containing
+// .grove, falling back to dir itself.
+func findGroveRoot(dir string) string {
+	if main, err := git.New(dir, runner.Exec{}).MainWorktree(context.Background()); err == nil {
+		if info, err := os.Stat(filepath.Join(main, ".grove")); err == nil && info.IsDir() {
+			return main
+		}
+	}
+
+	for current := dir; ; {
+		if info, err := os.Stat(filepath.Join(current, ".grove")); err == nil && info.IsDir() {
+			return current
+		}
+		parent := filepath.Dir(current)
+		if parent == current {
+			return dir
+		}
+		current = parent
+	}
+}
@@ -1,6 +1,9 @@
 package gwt
 
 import (
+	"os"
+	"os/exec"
+	"path/filepath"
 	"testing"
 
 	"github.com/spf13/cobra"
@@ -22,7 +25,7 @@ func TestNewRootCmd(t *testing.T) {
 	}
 
 	// Check that all subcommands are added
-	expectedCommands := []string{"init", "create", "list", "remove", "switch", "version"}
+	expectedCommands := []string{"init", "create", "list", "remove", "switch", "up", "down", "render", "env", "db", "daemon", "proxy", "certs", "hosts", "dns", "config", "secrets", "state", "version"}
 	commands := cmd.Commands()
 
 	if len(commands) != len(expectedCommands) {
@@ -142,3 +145,55 @@ func TestCommandsExecuteWithoutPanic(t *testing.T) {
 		t.Error("Root command should not be nil")
 	}
 }
+
+func TestFindGroveRoot(t *testing.T) {
+	outside := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(outside, ".grove"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	nested := filepath.Join(outside, "src", "app")
+	if err := os.MkdirAll(nested, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if got := findGroveRoot(nested); got != outside {
+		t.Errorf("findGroveRoot() outside git = %s, want %s", got, outside)
+	}
+
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+	for _, kv := range [][2]string{
+		{"GIT_AUTHOR_NAME", "grove"}, {"GIT_AUTHOR_EMAIL", "grove@example.com"},
+		{"GIT_COMMITTER_NAME", "grove"}, {"GIT_COMMITTER_EMAIL", "grove@example.com"},
+	} {
+		t.Setenv(kv[0], kv[1])
+	}
+
+	// Every worktree checks out the committed .grove/config.yaml
+	main := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(main, ".grove"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(main, ".grove", "config.yaml"), []byte("version: 1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	linked := filepath.Join(t.TempDir(), "feature-login")
+	for _, args := range [][]string{
+		{"init", "-q", "-b", "main"},
+		{"add", ".grove"},
+		{"commit", "-q", "-m", "init"},
+		{"worktree", "add", "-q", "-b", "feature/login", linked},
+	} {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = main
+		if output, err := cmd.CombinedOutput(); err != nil {
+			t.Skipf("git %v failed: %s", args, output)
+		}
+	}
+
+	for _, dir := range []string{main, linked, filepath.Join(linked, ".grove")} {
+		if got := findGroveRoot(dir); got != main {
+			t.Errorf("findGroveRoot(%s) = %s, want %s", dir, got, main)
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package gwt
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+func newSecretsCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "secrets",
+		Short: "Manage the encrypted secret store",
+		Long: `Manage .grove/secrets.enc, the AES-GCM encrypted store that secret:NAME
+variable values are read from. The passphrase comes from
+GROVE_SECRETS_PASSPHRASE, or is asked for when running in a terminal.`,
+	}
+
+	cmd.AddCommand(
+		newSecretsSetCmd(),
+		newSecretsListCmd(),
+		newSecretsRemoveCmd(),
+	)
+	return cmd
+}
+
+func newSecretsSetCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "set <name> [value]",
+		Short: "Store a secret, reading the value from stdin when omitted",
+		Args:  cobra.RangeArgs(1, 2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			manager, err := loadManager()
+			if err != nil {
+				return err
+			}
+
+			var value string
+			if len(args) == 2 {
+				value = args[1]
+			} else if isTerminal(os.Stdin) {
+				if value, err = readHidden(fmt.Sprintf("Value for %s: ", args[0])); err != nil {
+					return err
+				}
+			} else {
+				data, err := io.ReadAll(os.Stdin)
+				if err != nil {
+					return fmt.Errorf("failed to read value: %w", err)
+				}
+				value = strings.TrimRight(string(data), "\r\n")
+			}
+
+			if err := manager.SetSecretContext(cmd.Context(), args[0], value); err != nil {
+				return err
+			}
+			fmt.Printf("Stored secret %s\n", args[0])
+			return nil
+		},
+	}
+}
+
+func newSecretsListCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "list",
+		Short: "List the names of stored secrets",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			manager, err := loadManager()
+			if err != nil {
+				return err
+			}
+
+			names, err := manager.SecretNames()
+			if err != nil {
+				return err
+			}
+			for _, name := range names {
+				fmt.Println(name)
+			}
+			return nil
+		},
+	}
+}
+
+func newSecretsRemoveCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "rm <name>",
+		Short: "Remove a stored secret",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			manager, err := loadManager()
+			if err != nil {
+				return err
+			}
+
+			if err := manager.DeleteSecretContext(cmd.Context(), args[0]); err != nil {
+				return err
+			}
+			fmt.Printf("Removed secret %s\n", args[0])
+			return nil
+		},
+	}
+}
+
+// promptPassphrase asks for the secret store passphrase once per run when
+// GROVE_SECRETS_PASSPHRASE isn't set
+func promptPassphrase() func() (string, error) {
+	var passphrase string
+	return func() (string, error) {
+		if p := os.Getenv("GROVE_SECRETS_PASSPHRASE"); p != "" {
+			return p, nil
+		}
+		if passphrase != "" {
+			return passphrase, nil
+		}
+		if !isTerminal(os.Stdin) {
+			return "", fmt.Errorf("set GROVE_SECRETS_PASSPHRASE to unlock .grove/secrets.enc")
+		}
+
+		p, err := readHidden("Secrets passphrase: ")
+		if err != nil {
+			return "", err
+		}
+		if p == "" {
+			return "", fmt.Errorf("passphrase must not be empty")
+		}
+		passphrase = p
+		return passphrase, nil
+	}
+}
+
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// readHidden prompts on stderr and reads a line from the terminal without
+// echoing it
+func readHidden(prompt string) (string, error) {
+	fmt.Fprint(os.Stderr, prompt)
+	if stty("-echo") == nil {
+		defer func() {
+			stty("echo")
+			fmt.Fprintln(os.Stderr)
+		}()
+	}
+
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		return "", fmt.Errorf("failed to read from terminal: %w", err)
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+func stty(arg string) error {
+	cmd := exec.Command("stty", arg)
+	cmd.Stdin = os.Stdin
+	return cmd.Run()
+}
@@ -0,0 +1,45 @@
+package gwt
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+)
+
+// interruptContext returns a context cancelled by the first Ctrl-C or
+// SIGTERM, so the running command can stop and roll back. The default
+// handling is then restored, letting a second Ctrl-C quit grove at once.
+func interruptContext(parent context.Context) (context.Context, func()) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	return cancelOnSignal(parent, signals, func() { signal.Stop(signals) })
+}
+
+// cancelOnSignal cancels the returned context when a signal arrives, calling
+// restore first. The returned stop function releases it.
+func cancelOnSignal(parent context.Context, signals <-chan os.Signal, restore func()) (context.Context, func()) {
+	ctx, cancel := context.WithCancel(parent)
+	done := make(chan struct{})
+
+	go func() {
+		select {
+		case <-signals:
+			restore()
+			fmt.Fprintln(os.Stderr, "\nInterrupted, cleaning up (press Ctrl-C again to quit immediately)")
+			cancel()
+		case <-done:
+		}
+	}()
+
+	var once sync.Once
+	return ctx, func() {
+		once.Do(func() {
+			close(done)
+			restore()
+			cancel()
+		})
+	}
+}
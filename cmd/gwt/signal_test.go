@@ -0,0 +1,42 @@
+package gwt
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestCancelOnSignal(t *testing.T) {
+	signals := make(chan os.Signal, 1)
+	restored := make(chan struct{}, 2)
+	ctx, stop := cancelOnSignal(context.Background(), signals, func() { restored <- struct{}{} })
+	defer stop()
+
+	if ctx.Err() != nil {
+		t.Fatal("context cancelled before any signal")
+	}
+
+	signals <- os.Interrupt
+	select {
+	case <-ctx.Done():
+	case <-time.After(time.Second):
+		t.Fatal("context not cancelled by the signal")
+	}
+	select {
+	case <-restored:
+	default:
+		t.Error("signal handling not restored before cancelling")
+	}
+}
+
+func TestCancelOnSignal_Stop(t *testing.T) {
+	signals := make(chan os.Signal, 1)
+	ctx, stop := cancelOnSignal(context.Background(), signals, func() {})
+
+	stop()
+	stop()
+	if ctx.Err() == nil {
+		t.Error("stop should release the context")
+	}
+}
@@ -0,0 +1,157 @@
+package gwt
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/glanotte/grove/pkg/worktree"
+	"github.com/spf13/cobra"
+)
+
+// stateEntry is a worktree's recorded state as shown by `grove state`.
+// Generated values are listed by name only; `grove env` prints them.
+type stateEntry struct {
+	Name       string     `json:"name"`
+	Branch     string     `json:"branch"`
+	Path       string     `json:"path"`
+	BranchID   int        `json:"branch_id"`
+	BaseBranch string     `json:"base_branch,omitempty"`
+	Template   string     `json:"template,omitempty"`
+	Env        string     `json:"env,omitempty"`
+	Port       int        `json:"port,omitempty"`
+	Host       string     `json:"host,omitempty"`
+	CreatedAt  *time.Time `json:"created_at,omitempty"`
+	SeededAt   *time.Time `json:"seeded_at,omitempty"`
+	Generated  []string   `json:"generated"`
+}
+
+func newStateCmd() *cobra.Command {
+	var format string
+
+	cmd := &cobra.Command{
+		Use:   "state",
+		Short: "Show what grove has recorded about each worktree",
+		Long: `Show .grove/state.json: the template, base branch, environment, port,
+proxy host and generated variables grove recorded for each worktree.
+The state is reconciled against 'git worktree list' first.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if format != "table" && format != "json" {
+				return fmt.Errorf("unknown format '%s' (expected table or json)", format)
+			}
+
+			manager, err := loadManager()
+			if err != nil {
+				return err
+			}
+			if _, err := manager.TryReconcileStateContext(cmd.Context()); err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: failed to reconcile state: %v\n", err)
+			}
+
+			states, err := manager.StateEntriesContext(cmd.Context())
+			if err != nil {
+				return err
+			}
+
+			entries := make([]stateEntry, 0, len(states))
+			for _, s := range states {
+				entries = append(entries, newStateEntry(s))
+			}
+
+			if format == "json" {
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "  ")
+				return enc.Encode(entries)
+			}
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "NAME\tBRANCH\tFROM\tTEMPLATE\tENV\tPORT\tHOST\tCREATED")
+			for _, e := range entries {
+				port, created := "-", "-"
+				if e.Port != 0 {
+					port = fmt.Sprint(e.Port)
+				}
+				if e.CreatedAt != nil {
+					created = e.CreatedAt.Local().Format("2006-01-02 15:04")
+				}
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", e.Name, e.Branch,
+					orDash(e.BaseBranch), orDash(e.Template), orDash(e.Env), port, orDash(e.Host), created)
+			}
+			return w.Flush()
+		},
+	}
+
+	cmd.Flags().StringVar(&format, "format", "table", "Output format (table|json)")
+	cmd.AddCommand(newStateReconcileCmd())
+	return cmd
+}
+
+func newStateReconcileCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "reconcile",
+		Short: "Sync the state with 'git worktree list'",
+		Long: `Drop state for worktrees git no longer knows about, and adopt worktrees
+under the base path that were created outside grove.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			manager, err := loadManager()
+			if err != nil {
+				return err
+			}
+
+			result, err := manager.ReconcileStateContext(cmd.Context())
+			if err != nil {
+				return err
+			}
+			for _, branch := range result.Removed {
+				fmt.Printf("Removed %s (worktree no longer exists)\n", branch)
+			}
+			for _, branch := range result.Adopted {
+				fmt.Printf("Adopted %s\n", branch)
+			}
+			if len(result.Removed) == 0 && len(result.Adopted) == 0 {
+				fmt.Println("State is up to date")
+			}
+			return nil
+		},
+	}
+}
+
+func newStateEntry(s worktree.WorktreeState) stateEntry {
+	e := stateEntry{
+		Name:       filepath.Base(s.Path),
+		Branch:     s.Branch,
+		Path:       s.Path,
+		BranchID:   s.BranchID,
+		BaseBranch: s.BaseBranch,
+		Template:   s.Template,
+		Env:        s.Env,
+		Port:       s.Port,
+		Host:       s.Host,
+		SeededAt:   s.SeededAt,
+		Generated:  []string{},
+	}
+	// Adopted worktrees have no creation time
+	if !s.CreatedAt.IsZero() {
+		created := s.CreatedAt
+		e.CreatedAt = &created
+	}
+	for name := range s.Generated {
+		e.Generated = append(e.Generated, name)
+	}
+	sort.Strings(e.Generated)
+	return e
+}
+
+func orDash(s string) string {
+	if strings.TrimSpace(s) == "" {
+		return "-"
+	}
+	return s
+}
@@ -0,0 +1,20 @@
+package gwt
+
+import (
+	"github.com/spf13/cobra"
+)
+
+func newUpCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "up <worktree-name>",
+		Short: "Start a worktree's containers and wait for its proxy route",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			manager, err := loadManager()
+			if err != nil {
+				return err
+			}
+			return manager.UpContext(cmd.Context(), args[0])
+		},
+	}
+}
@@ -5,7 +5,6 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
-	"strings"
 	"testing"
 
 	"github.com/glanotte/grove/pkg/worktree"
@@ -51,8 +50,8 @@ func CreateTestConfig() *worktree.Config {
 		Docker: worktree.DockerConfig{
 			Enabled:     true,
 			ComposeFile: "docker-compose.yml",
-			PortOffset:  10000,
-			NetworkName: "{project_name}_network",
+			Ports:       worktree.PortsConfig{RangeStart: 10000},
+			Network:     worktree.NetworkConfig{Name: "{project_name}_network"},
 		},
 		Web: worktree.WebConfig{
 			Enabled:          true,
@@ -181,31 +180,6 @@ func contains(str, substr string) bool {
 	return len(str) >= len(substr) && (str == substr || contains(str[1:], substr))
 }
 
-// MockGitCommand creates a mock git command for testing
-type MockGitCommand struct {
-	Commands  []string
-	Outputs   []string
-	Errors    []error
-	CallCount int
-}
-
-func (m *MockGitCommand) Run(command string, args ...string) ([]byte, error) {
-	defer func() { m.CallCount++ }()
-
-	fullCommand := command + " " + strings.Join(args, " ")
-	m.Commands = append(m.Commands, fullCommand)
-
-	if m.CallCount < len(m.Outputs) {
-		return []byte(m.Outputs[m.CallCount]), nil
-	}
-
-	if m.CallCount < len(m.Errors) {
-		return nil, m.Errors[m.CallCount]
-	}
-
-	return []byte(""), nil
-}
-
 // TableTest represents a table-driven test case
 type TableTest struct {
 	Name    string
@@ -14,7 +14,7 @@ var (
 )
 
 func main() {
-	if err := gwt.NewRootCmd(version, commit, date).Execute(); err != nil {
+	if err := gwt.Execute(version, commit, date); err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
 	}
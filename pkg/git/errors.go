@@ -0,0 +1,150 @@
+package git
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// ErrBranchCheckedOut is returned when a branch is already checked out in
+// another worktree
+type ErrBranchCheckedOut struct {
+	Branch string
+	// Path is the worktree that has the branch checked out
+	Path string
+}
+
+func (e *ErrBranchCheckedOut) Error() string {
+	return fmt.Sprintf("branch '%s' is already checked out at %s", e.Branch, e.Path)
+}
+
+// ErrPathExists is returned when a new worktree's directory already exists
+type ErrPathExists struct {
+	Path string
+}
+
+func (e *ErrPathExists) Error() string {
+	return fmt.Sprintf("%s already exists", e.Path)
+}
+
+// ErrUnknownRef is returned for a branch, tag or commit git can't resolve
+type ErrUnknownRef struct {
+	Ref string
+}
+
+func (e *ErrUnknownRef) Error() string {
+	return fmt.Sprintf("unknown ref '%s'", e.Ref)
+}
+
+// ErrBranchExists is returned when creating a branch that already exists
+type ErrBranchExists struct {
+	Branch string
+}
+
+func (e *ErrBranchExists) Error() string {
+	return fmt.Sprintf("branch '%s' already exists", e.Branch)
+}
+
+// ErrWorktreeDirty is returned when removing a worktree with uncommitted
+// changes without forcing it
+type ErrWorktreeDirty struct {
+	Path string
+}
+
+func (e *ErrWorktreeDirty) Error() string {
+	return fmt.Sprintf("%s has modified or untracked files", e.Path)
+}
+
+// ErrWorktreeLocked is returned when removing or moving a locked worktree
+type ErrWorktreeLocked struct {
+	Path   string
+	Reason string
+}
+
+func (e *ErrWorktreeLocked) Error() string {
+	if e.Reason != "" {
+		return fmt.Sprintf("%s is locked: %s", e.Path, e.Reason)
+	}
+	return fmt.Sprintf("%s is locked", e.Path)
+}
+
+// Error is a git failure without a more specific type
+type Error struct {
+	// Command is the git subcommand, e.g. "worktree add"
+	Command string
+	// Output is what git printed, usually a fatal: line
+	Output string
+	Err    error
+}
+
+func (e *Error) Error() string {
+	if e.Output != "" {
+		return fmt.Sprintf("git %s failed: %s", e.Command, e.Output)
+	}
+	return fmt.Sprintf("git %s failed: %v", e.Command, e.Err)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+var (
+	checkedOutPattern   = regexp.MustCompile(`'([^']+)' is already (?:checked out|used by worktree) at '([^']+)'`)
+	pathExistsPattern   = regexp.MustCompile(`'([^']+)' already exists`)
+	branchExistsPattern = regexp.MustCompile(`a branch named '([^']+)' already exists`)
+	unknownRefPatterns  = []*regexp.Regexp{
+		regexp.MustCompile(`invalid reference: (\S+)`),
+		regexp.MustCompile(`not a valid object name:? '?([^'\s]+)`),
+		regexp.MustCompile(`ambiguous argument '([^']+)': unknown revision`),
+	}
+	dirtyPattern  = regexp.MustCompile(`'([^']+)' contains modified or untracked files`)
+	lockedPattern = regexp.MustCompile(`(?:cannot (?:remove|move) a locked working tree)(?:, lock reason: (.*))?`)
+)
+
+// classify turns git's error output into a typed error where it recognizes
+// the failure. path is the worktree the command operated on, if any.
+func classify(command, path, output string, err error) error {
+	output = strings.TrimSpace(output)
+
+	// branchExistsPattern must be checked before pathExistsPattern, which it
+	// also matches
+	if m := branchExistsPattern.FindStringSubmatch(output); m != nil {
+		return &ErrBranchExists{Branch: m[1]}
+	}
+	if m := checkedOutPattern.FindStringSubmatch(output); m != nil {
+		return &ErrBranchCheckedOut{Branch: m[1], Path: m[2]}
+	}
+	if m := pathExistsPattern.FindStringSubmatch(output); m != nil {
+		return &ErrPathExists{Path: orPath(path, m[1])}
+	}
+	if m := dirtyPattern.FindStringSubmatch(output); m != nil {
+		return &ErrWorktreeDirty{Path: orPath(path, m[1])}
+	}
+	if m := lockedPattern.FindStringSubmatch(output); m != nil {
+		reason := strings.TrimSpace(strings.SplitN(m[1], "\n", 2)[0])
+		return &ErrWorktreeLocked{Path: path, Reason: reason}
+	}
+	for _, pattern := range unknownRefPatterns {
+		if m := pattern.FindStringSubmatch(output); m != nil {
+			return &ErrUnknownRef{Ref: m[1]}
+		}
+	}
+
+	// Only the fatal: line is of interest, not hints or progress
+	for _, line := range strings.Split(output, "\n") {
+		if strings.HasPrefix(line, "fatal: ") || strings.HasPrefix(line, "error: ") {
+			output = strings.TrimPrefix(strings.TrimPrefix(line, "fatal: "), "error: ")
+			break
+		}
+	}
+	return &Error{Command: command, Output: output, Err: err}
+}
+
+// orPath prefers the path grove passed over git's rendering of it, which
+// may be relative
+func orPath(path, fallback string) string {
+	if path != "" {
+		return path
+	}
+	return fallback
+}
@@ -0,0 +1,155 @@
+// Package git wraps the git commands grove uses, parsing their output and
+// turning common failures into typed errors.
+package git
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/glanotte/grove/pkg/runner"
+)
+
+// Repo runs git commands against a repository
+type Repo struct {
+	// Dir is the repository root, or any of its worktrees
+	Dir    string
+	Runner runner.Runner
+}
+
+// New returns a Repo for dir, running git through r
+func New(dir string, r runner.Runner) *Repo {
+	return &Repo{Dir: dir, Runner: r}
+}
+
+// git runs a git subcommand in the repository. path is the worktree the
+// command acts on, used to describe failures.
+func (r *Repo) git(ctx context.Context, path string, args ...string) (runner.Result, error) {
+	return r.gitIn(ctx, r.Dir, path, args...)
+}
+
+func (r *Repo) gitIn(ctx context.Context, dir, path string, args ...string) (runner.Result, error) {
+	cmd := runner.Command("git", args...)
+	cmd.Dir = dir
+	result, err := r.Runner.Run(ctx, cmd)
+	if err == nil {
+		return result, nil
+	}
+	if ctx.Err() != nil {
+		return result, ctx.Err()
+	}
+
+	command := args[0]
+	if len(args) > 1 && !strings.HasPrefix(args[1], "-") {
+		command += " " + args[1]
+	}
+	var exitErr *runner.ExitError
+	if !errors.As(err, &exitErr) {
+		return result, &Error{Command: command, Err: err}
+	}
+	return result, classify(command, path, result.Output(), err)
+}
+
+// exitCode returns the exit status of a failed command, or -1
+func exitCode(err error) int {
+	var exitErr *runner.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.Code
+	}
+	return -1
+}
+
+// BranchExists reports whether refs/heads/<branch> exists
+func (r *Repo) BranchExists(ctx context.Context, branch string) (bool, error) {
+	return r.RefExists(ctx, "refs/heads/"+branch)
+}
+
+// RefExists reports whether a fully qualified ref exists
+func (r *Repo) RefExists(ctx context.Context, ref string) (bool, error) {
+	cmd := runner.Command("git", "show-ref", "--verify", "--quiet", ref)
+	cmd.Dir = r.Dir
+	_, err := r.Runner.Run(ctx, cmd)
+	switch {
+	case err == nil:
+		return true, nil
+	case ctx.Err() != nil:
+		return false, ctx.Err()
+	case exitCode(err) == 1:
+		return false, nil
+	}
+	return false, &Error{Command: "show-ref", Err: err}
+}
+
+// CreateBranch creates branch at start
+func (r *Repo) CreateBranch(ctx context.Context, branch, start string) error {
+	_, err := r.git(ctx, "", "branch", branch, start)
+	return err
+}
+
+// DeleteBranch deletes branch; force deletes it even when unmerged
+func (r *Repo) DeleteBranch(ctx context.Context, branch string, force bool) error {
+	flag := "-d"
+	if force {
+		flag = "-D"
+	}
+	_, err := r.git(ctx, "", "branch", flag, branch)
+	return err
+}
+
+// AheadBehind counts the commits on branch but not upstream, and on upstream
+// but not branch
+func (r *Repo) AheadBehind(ctx context.Context, branch, upstream string) (ahead, behind int, err error) {
+	result, err := r.git(ctx, "", "rev-list", "--left-right", "--count", branch+"..."+upstream)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	fields := strings.Fields(string(result.Stdout))
+	if len(fields) != 2 {
+		return 0, 0, fmt.Errorf("unexpected rev-list output %q", result.Stdout)
+	}
+	if ahead, err = strconv.Atoi(fields[0]); err == nil {
+		behind, err = strconv.Atoi(fields[1])
+	}
+	if err != nil {
+		return 0, 0, fmt.Errorf("unexpected rev-list output %q", result.Stdout)
+	}
+	return ahead, behind, nil
+}
+
+// FileStatus is a changed file in a worktree
+type FileStatus struct {
+	// Code is the two-letter porcelain status, e.g. " M" or "??"
+	Code string
+	Path string
+}
+
+// Status lists the changed and untracked files in the worktree at path
+func (r *Repo) Status(ctx context.Context, path string) ([]FileStatus, error) {
+	result, err := r.gitIn(ctx, path, path, "status", "--porcelain=v1", "-z")
+	if err != nil {
+		return nil, err
+	}
+	return parseStatus(string(result.Stdout)), nil
+}
+
+// parseStatus parses `git status --porcelain=v1 -z` output
+func parseStatus(output string) []FileStatus {
+	var files []FileStatus
+	entries := strings.Split(output, "\x00")
+	for i := 0; i < len(entries); i++ {
+		entry := entries[i]
+		if len(entry) < 4 {
+			continue
+		}
+		code := entry[:2]
+		files = append(files, FileStatus{Code: code, Path: entry[3:]})
+		// Renames and copies are followed by the original path
+		if code[0] == 'R' || code[0] == 'C' {
+			i++
+		}
+	}
+	return files
+}
@@ -0,0 +1,253 @@
+package git
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/glanotte/grove/pkg/runner"
+)
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		name   string
+		output string
+		want   error
+	}{
+		{
+			name:   "checked out",
+			output: "Preparing worktree (checking out 'f1')\nfatal: 'f1' is already checked out at '/repo/worktrees/f1'",
+			want:   &ErrBranchCheckedOut{Branch: "f1", Path: "/repo/worktrees/f1"},
+		},
+		{
+			name:   "used by worktree",
+			output: "fatal: 'f1' is already used by worktree at '/repo/worktrees/f1'",
+			want:   &ErrBranchCheckedOut{Branch: "f1", Path: "/repo/worktrees/f1"},
+		},
+		{
+			name:   "path exists",
+			output: "Preparing worktree (new branch 'f3')\nfatal: 'worktrees/f3' already exists",
+			want:   &ErrPathExists{Path: "/repo/worktrees/f3"},
+		},
+		{
+			name:   "branch exists",
+			output: "fatal: a branch named 'f1' already exists",
+			want:   &ErrBranchExists{Branch: "f1"},
+		},
+		{
+			name:   "invalid reference",
+			output: "fatal: invalid reference: nosuch",
+			want:   &ErrUnknownRef{Ref: "nosuch"},
+		},
+		{
+			name:   "invalid base",
+			output: "Preparing worktree (new branch 'f4')\nfatal: not a valid object name: 'nosuch'",
+			want:   &ErrUnknownRef{Ref: "nosuch"},
+		},
+		{
+			name:   "unknown revision",
+			output: "fatal: ambiguous argument 'nosuch...main': unknown revision or path not in the working tree.",
+			want:   &ErrUnknownRef{Ref: "nosuch...main"},
+		},
+		{
+			name:   "dirty",
+			output: "fatal: 'worktrees/f3' contains modified or untracked files, use --force to delete it",
+			want:   &ErrWorktreeDirty{Path: "/repo/worktrees/f3"},
+		},
+		{
+			name:   "locked",
+			output: "fatal: cannot remove a locked working tree, lock reason: on usb\nuse 'remove -f -f' to override or unlock first",
+			want:   &ErrWorktreeLocked{Path: "/repo/worktrees/f3", Reason: "on usb"},
+		},
+		{
+			name:   "other",
+			output: "hint: something\nfatal: 'nope' is not a working tree",
+			want:   &Error{Command: "worktree add", Output: "'nope' is not a working tree"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := ""
+			if _, ok := tt.want.(*ErrBranchCheckedOut); !ok {
+				path = "/repo/worktrees/f3"
+			}
+			got := classify("worktree add", path, tt.output, nil)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("classify() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseWorktrees(t *testing.T) {
+	output := `worktree /repo
+HEAD 8834807
+branch refs/heads/main
+
+worktree /repo/worktrees/f1
+HEAD 8834807
+branch refs/heads/feature/f1
+locked on usb
+
+worktree /repo/worktrees/detached
+HEAD 8834807
+detached
+prunable gitdir file points to non-existent location
+
+`
+	want := []Worktree{
+		{Path: "/repo", Head: "8834807", Branch: "main"},
+		{Path: "/repo/worktrees/f1", Head: "8834807", Branch: "feature/f1", Locked: true, LockReason: "on usb"},
+		{Path: "/repo/worktrees/detached", Head: "8834807", Detached: true, Prunable: true},
+	}
+	if got := parseWorktrees(output); !reflect.DeepEqual(got, want) {
+		t.Errorf("parseWorktrees() =\n%+v\nwant\n%+v", got, want)
+	}
+}
+
+func TestParseStatus(t *testing.T) {
+	output := " M app.go\x00?? new file.txt\x00R  new.go\x00old.go\x00"
+	want := []FileStatus{
+		{Code: " M", Path: "app.go"},
+		{Code: "??", Path: "new file.txt"},
+		{Code: "R ", Path: "new.go"},
+	}
+	if got := parseStatus(output); !reflect.DeepEqual(got, want) {
+		t.Errorf("parseStatus() = %+v, want %+v", got, want)
+	}
+}
+
+func TestRepo_BranchExists(t *testing.T) {
+	fake := runner.NewFake()
+	fake.On("git show-ref --verify --quiet refs/heads/main", runner.Response{})
+	fake.On("git show-ref --verify --quiet refs/heads/gone", runner.Response{ExitCode: 1})
+	fake.On("git show-ref --verify --quiet refs/heads/broken", runner.Response{ExitCode: 128, Stderr: "fatal: not a git repository"})
+	repo := New("/repo", fake)
+	ctx := context.Background()
+
+	if ok, err := repo.BranchExists(ctx, "main"); !ok || err != nil {
+		t.Errorf("BranchExists(main) = %v, %v", ok, err)
+	}
+	if ok, err := repo.BranchExists(ctx, "gone"); ok || err != nil {
+		t.Errorf("BranchExists(gone) = %v, %v", ok, err)
+	}
+	if _, err := repo.BranchExists(ctx, "broken"); err == nil {
+		t.Error("BranchExists() hid a git failure")
+	}
+	if dir := fake.Calls()[0].Dir; dir != "/repo" {
+		t.Errorf("ran git in %q, want /repo", dir)
+	}
+}
+
+// TestRepo_git runs the wrapped commands against a real repository
+func TestRepo_git(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+	for _, kv := range [][2]string{
+		{"GIT_AUTHOR_NAME", "grove"}, {"GIT_AUTHOR_EMAIL", "grove@example.com"},
+		{"GIT_COMMITTER_NAME", "grove"}, {"GIT_COMMITTER_EMAIL", "grove@example.com"},
+	} {
+		t.Setenv(kv[0], kv[1])
+	}
+
+	dir := t.TempDir()
+	for _, args := range [][]string{
+		{"init", "-q", "-b", "main"},
+		{"commit", "-q", "--allow-empty", "-m", "init"},
+	} {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		if output, err := cmd.CombinedOutput(); err != nil {
+			t.Skipf("git %v failed: %s", args, output)
+		}
+	}
+
+	ctx := context.Background()
+	repo := New(dir, runner.Exec{})
+	f1 := filepath.Join(dir, "worktrees", "f1")
+
+	if err := repo.AddWorktreeNewBranch(ctx, f1, "f1", "main"); err != nil {
+		t.Fatalf("AddWorktreeNewBranch() error = %v", err)
+	}
+
+	var checkedOut *ErrBranchCheckedOut
+	err := repo.AddWorktree(ctx, filepath.Join(dir, "worktrees", "again"), "f1")
+	if !errors.As(err, &checkedOut) || filepath.Base(checkedOut.Path) != "f1" {
+		t.Errorf("AddWorktree(f1) error = %v, want ErrBranchCheckedOut", err)
+	}
+
+	var exists *ErrPathExists
+	if err := repo.AddWorktreeNewBranch(ctx, f1, "f2", "main"); !errors.As(err, &exists) || exists.Path != f1 {
+		t.Errorf("AddWorktreeNewBranch() into an existing path error = %v, want ErrPathExists", err)
+	}
+
+	var unknown *ErrUnknownRef
+	if err := repo.AddWorktreeNewBranch(ctx, filepath.Join(dir, "worktrees", "f4"), "f4", "nosuch"); !errors.As(err, &unknown) {
+		t.Errorf("AddWorktreeNewBranch() from a missing base error = %v, want ErrUnknownRef", err)
+	}
+
+	worktrees, err := repo.ListWorktrees(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(worktrees) != 2 || worktrees[1].Branch != "f1" {
+		t.Errorf("ListWorktrees() = %+v", worktrees)
+	}
+
+	for _, from := range []string{dir, f1, filepath.Join(dir, "worktrees")} {
+		main, err := New(from, runner.Exec{}).MainWorktree(ctx)
+		if err != nil || main != filepath.Clean(dir) {
+			t.Errorf("MainWorktree() from %s = %q, %v, want %s", from, main, err, dir)
+		}
+	}
+
+	if err := os.WriteFile(filepath.Join(f1, "new.txt"), []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	status, err := repo.Status(ctx, f1)
+	if err != nil || len(status) != 1 || status[0].Code != "??" {
+		t.Errorf("Status() = %+v, %v", status, err)
+	}
+	var dirty *ErrWorktreeDirty
+	if err := repo.RemoveWorktree(ctx, f1, false); !errors.As(err, &dirty) {
+		t.Errorf("RemoveWorktree() of a dirty worktree error = %v, want ErrWorktreeDirty", err)
+	}
+
+	if err := repo.LockWorktree(ctx, f1, "on usb"); err != nil {
+		t.Fatal(err)
+	}
+	var locked *ErrWorktreeLocked
+	if err := repo.RemoveWorktree(ctx, f1, true); !errors.As(err, &locked) || locked.Reason != "on usb" {
+		t.Errorf("RemoveWorktree() of a locked worktree error = %v, want ErrWorktreeLocked", err)
+	}
+	if err := repo.UnlockWorktree(ctx, f1); err != nil {
+		t.Fatal(err)
+	}
+
+	moved := filepath.Join(dir, "worktrees", "moved")
+	if err := repo.MoveWorktree(ctx, f1, moved); err != nil {
+		t.Fatalf("MoveWorktree() error = %v", err)
+	}
+	if ahead, behind, err := repo.AheadBehind(ctx, "f1", "main"); ahead != 0 || behind != 0 || err != nil {
+		t.Errorf("AheadBehind() = %d, %d, %v", ahead, behind, err)
+	}
+	if err := repo.RemoveWorktree(ctx, moved, true); err != nil {
+		t.Fatalf("RemoveWorktree() error = %v", err)
+	}
+	if err := repo.PruneWorktrees(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.DeleteBranch(ctx, "f1", false); err != nil {
+		t.Errorf("DeleteBranch() error = %v", err)
+	}
+	var branchExists *ErrBranchExists
+	if err := repo.CreateBranch(ctx, "main", "HEAD"); !errors.As(err, &branchExists) {
+		t.Errorf("CreateBranch(main) error = %v, want ErrBranchExists", err)
+	}
+}
@@ -0,0 +1,135 @@
+package git
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// Worktree is an entry of `git worktree list`
+type Worktree struct {
+	Path string
+	// Head is the checked out commit
+	Head string
+	// Branch is the short branch name, empty when detached or bare
+	Branch   string
+	Bare     bool
+	Detached bool
+	Locked   bool
+	// LockReason is the reason given to `git worktree lock`, if any
+	LockReason string
+	// Prunable is set when the worktree's directory is gone
+	Prunable bool
+}
+
+// ListWorktrees lists the repository's worktrees, the main one first
+func (r *Repo) ListWorktrees(ctx context.Context) ([]Worktree, error) {
+	result, err := r.git(ctx, "", "worktree", "list", "--porcelain")
+	if err != nil {
+		return nil, err
+	}
+	return parseWorktrees(string(result.Stdout)), nil
+}
+
+// MainWorktree returns the root of the main worktree, the one whose .git
+// directory Dir's worktree shares
+func (r *Repo) MainWorktree(ctx context.Context) (string, error) {
+	result, err := r.git(ctx, "", "rev-parse", "--git-common-dir")
+	if err != nil {
+		return "", err
+	}
+	common := strings.TrimSpace(string(result.Stdout))
+	if !filepath.IsAbs(common) {
+		common = filepath.Join(r.Dir, common)
+	}
+	if filepath.Base(common) != ".git" {
+		return "", fmt.Errorf("repository %s has no main worktree", common)
+	}
+	return filepath.Dir(common), nil
+}
+
+// parseWorktrees parses `git worktree list --porcelain`: one attribute per
+// line, with records separated by blank lines
+func parseWorktrees(output string) []Worktree {
+	var worktrees []Worktree
+	for _, record := range strings.Split(output, "\n\n") {
+		var wt Worktree
+		for _, line := range strings.Split(record, "\n") {
+			key, value, _ := strings.Cut(line, " ")
+			switch key {
+			case "worktree":
+				wt.Path = value
+			case "HEAD":
+				wt.Head = value
+			case "branch":
+				wt.Branch = strings.TrimPrefix(value, "refs/heads/")
+			case "bare":
+				wt.Bare = true
+			case "detached":
+				wt.Detached = true
+			case "locked":
+				wt.Locked = true
+				wt.LockReason = value
+			case "prunable":
+				wt.Prunable = true
+			}
+		}
+		if wt.Path != "" {
+			worktrees = append(worktrees, wt)
+		}
+	}
+	return worktrees
+}
+
+// AddWorktree checks out an existing branch in a new worktree at path
+func (r *Repo) AddWorktree(ctx context.Context, path, branch string) error {
+	_, err := r.git(ctx, path, "worktree", "add", path, branch)
+	return err
+}
+
+// AddWorktreeNewBranch creates branch from base and checks it out in a new
+// worktree at path
+func (r *Repo) AddWorktreeNewBranch(ctx context.Context, path, branch, base string) error {
+	_, err := r.git(ctx, path, "worktree", "add", "-b", branch, path, base)
+	return err
+}
+
+// RemoveWorktree removes the worktree at path; force discards uncommitted
+// changes
+func (r *Repo) RemoveWorktree(ctx context.Context, path string, force bool) error {
+	args := []string{"worktree", "remove"}
+	if force {
+		args = append(args, "--force")
+	}
+	_, err := r.git(ctx, path, append(args, path)...)
+	return err
+}
+
+// LockWorktree keeps the worktree at path from being pruned, moved or removed
+func (r *Repo) LockWorktree(ctx context.Context, path, reason string) error {
+	args := []string{"worktree", "lock"}
+	if reason != "" {
+		args = append(args, "--reason", reason)
+	}
+	_, err := r.git(ctx, path, append(args, path)...)
+	return err
+}
+
+// UnlockWorktree releases a lock taken with LockWorktree
+func (r *Repo) UnlockWorktree(ctx context.Context, path string) error {
+	_, err := r.git(ctx, path, "worktree", "unlock", path)
+	return err
+}
+
+// MoveWorktree moves the worktree at from to to
+func (r *Repo) MoveWorktree(ctx context.Context, from, to string) error {
+	_, err := r.git(ctx, from, "worktree", "move", from, to)
+	return err
+}
+
+// PruneWorktrees forgets worktrees whose directories were deleted
+func (r *Repo) PruneWorktrees(ctx context.Context) error {
+	_, err := r.git(ctx, "", "worktree", "prune")
+	return err
+}
@@ -0,0 +1,137 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+)
+
+// Response is the scripted outcome of a command run by a Fake
+type Response struct {
+	Stdout string
+	Stderr string
+	// ExitCode makes the command fail with an *ExitError
+	ExitCode int
+	// Err makes the command fail to run at all
+	Err error
+	// Do runs before the response is returned, to simulate side effects
+	// such as git creating the worktree directory
+	Do func(cmd Cmd) error
+}
+
+type fakeRule struct {
+	prefix   string
+	response Response
+}
+
+// Fake is a scripted Runner for tests. Commands are matched against the
+// registered prefixes of their command line, most recent rule first;
+// commands without a rule succeed with no output unless Strict is set.
+type Fake struct {
+	// Strict fails commands that no rule matches
+	Strict bool
+
+	mu    sync.Mutex
+	rules []fakeRule
+	calls []Cmd
+}
+
+// NewFake returns a Fake without rules
+func NewFake() *Fake {
+	return &Fake{}
+}
+
+// On scripts the response to commands whose command line starts with prefix,
+// e.g. "git worktree add"
+func (f *Fake) On(prefix string, response Response) *Fake {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.rules = append(f.rules, fakeRule{prefix: prefix, response: response})
+	return f
+}
+
+// Calls returns the commands run so far
+func (f *Fake) Calls() []Cmd {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return append([]Cmd(nil), f.calls...)
+}
+
+// Commands returns the command lines run so far
+func (f *Fake) Commands() []string {
+	var lines []string
+	for _, c := range f.Calls() {
+		lines = append(lines, c.String())
+	}
+	return lines
+}
+
+// Ran reports whether a command starting with prefix was run
+func (f *Fake) Ran(prefix string) bool {
+	for _, line := range f.Commands() {
+		if matches(line, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *Fake) Run(ctx context.Context, cmd Cmd) (Result, error) {
+	if err := ctx.Err(); err != nil {
+		return Result{}, err
+	}
+
+	f.mu.Lock()
+	f.calls = append(f.calls, cmd)
+	line := cmd.String()
+	var response *Response
+	for i := len(f.rules) - 1; i >= 0; i-- {
+		if matches(line, f.rules[i].prefix) {
+			response = &f.rules[i].response
+			break
+		}
+	}
+	f.mu.Unlock()
+
+	if response == nil {
+		if f.Strict {
+			return Result{}, fmt.Errorf("unexpected command: %s", line)
+		}
+		return Result{}, nil
+	}
+
+	if response.Do != nil {
+		if err := response.Do(cmd); err != nil {
+			return Result{}, err
+		}
+	}
+	if response.Err != nil {
+		return Result{}, response.Err
+	}
+
+	result := Result{}
+	if cmd.Stdout != nil {
+		io.WriteString(cmd.Stdout, response.Stdout)
+	} else {
+		result.Stdout = []byte(response.Stdout)
+	}
+	if cmd.Stderr != nil {
+		io.WriteString(cmd.Stderr, response.Stderr)
+	} else {
+		result.Stderr = []byte(response.Stderr)
+	}
+
+	if response.ExitCode != 0 {
+		return result, &ExitError{Cmd: cmd.Name, Code: response.ExitCode, Stderr: strings.TrimSpace(response.Stderr)}
+	}
+	return result, nil
+}
+
+// matches reports whether line starts with the words of prefix
+func matches(line, prefix string) bool {
+	return line == prefix || strings.HasPrefix(line, prefix+" ")
+}
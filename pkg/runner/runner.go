@@ -0,0 +1,125 @@
+// Package runner runs the external commands grove depends on, such as git
+// and docker, behind an interface that tests can replace.
+package runner
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// waitDelay bounds how long Run waits for output from grandchildren that
+// outlive the command or its context
+const waitDelay = time.Second
+
+// Cmd describes an external command
+type Cmd struct {
+	Name string
+	Args []string
+	// Dir is the working directory, defaulting to the current one
+	Dir string
+	// Env is added to the current process environment
+	Env   []string
+	Stdin io.Reader
+	// Stdout and Stderr stream the command's output. When nil, the output is
+	// captured in the Result instead.
+	Stdout io.Writer
+	Stderr io.Writer
+}
+
+// Command returns a Cmd for name and args
+func Command(name string, args ...string) Cmd {
+	return Cmd{Name: name, Args: args}
+}
+
+// String returns the command line, quoting arguments where a shell would
+// need it
+func (c Cmd) String() string {
+	parts := make([]string, 0, len(c.Args)+1)
+	for _, arg := range append([]string{c.Name}, c.Args...) {
+		parts = append(parts, quote(arg))
+	}
+	return strings.Join(parts, " ")
+}
+
+func quote(arg string) string {
+	if arg != "" && !strings.ContainsAny(arg, " \t\n\"'\\$`|&;<>(){}*?!#~") {
+		return arg
+	}
+	return "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+}
+
+// Result holds the output of a command that wasn't streamed
+type Result struct {
+	Stdout []byte
+	Stderr []byte
+}
+
+// Output returns the captured stderr and stdout, trimmed, for error messages
+func (r Result) Output() string {
+	return strings.TrimSpace(string(r.Stderr) + string(r.Stdout))
+}
+
+// Runner runs external commands
+type Runner interface {
+	// Run runs cmd to completion. A command that exits non-zero returns an
+	// *ExitError; cancelling ctx kills it.
+	Run(ctx context.Context, cmd Cmd) (Result, error)
+}
+
+// ExitError reports a command that ran but failed
+type ExitError struct {
+	Cmd  string
+	Code int
+	// Stderr is the captured error output, if any
+	Stderr string
+}
+
+func (e *ExitError) Error() string {
+	if e.Stderr != "" {
+		return fmt.Sprintf("%s exited with status %d: %s", e.Cmd, e.Code, e.Stderr)
+	}
+	return fmt.Sprintf("%s exited with status %d", e.Cmd, e.Code)
+}
+
+// Exec runs commands with os/exec
+type Exec struct{}
+
+func (Exec) Run(ctx context.Context, c Cmd) (Result, error) {
+	cmd := exec.CommandContext(ctx, c.Name, c.Args...)
+	cmd.Dir = c.Dir
+	if len(c.Env) > 0 {
+		cmd.Env = append(os.Environ(), c.Env...)
+	}
+	cmd.Stdin = c.Stdin
+	cmd.WaitDelay = waitDelay
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = c.Stdout, c.Stderr
+	if cmd.Stdout == nil {
+		cmd.Stdout = &stdout
+	}
+	if cmd.Stderr == nil {
+		cmd.Stderr = &stderr
+	}
+
+	err := cmd.Run()
+	result := Result{Stdout: stdout.Bytes(), Stderr: stderr.Bytes()}
+	if ctx.Err() != nil {
+		return result, ctx.Err()
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return result, &ExitError{Cmd: c.Name, Code: exitErr.ExitCode(), Stderr: strings.TrimSpace(stderr.String())}
+	}
+	if err != nil {
+		return result, fmt.Errorf("failed to run %s: %w", c.Name, err)
+	}
+	return result, nil
+}
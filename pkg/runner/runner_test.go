@@ -0,0 +1,100 @@
+package runner
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCmd_String(t *testing.T) {
+	tests := []struct {
+		cmd  Cmd
+		want string
+	}{
+		{Command("git", "worktree", "list", "--porcelain"), "git worktree list --porcelain"},
+		{Command("docker", "inspect", "-f", "{{.Name}} {{.State.Status}}"), "docker inspect -f '{{.Name}} {{.State.Status}}'"},
+		{Command("sh", "-c", "echo 'hi'"), `sh -c 'echo '\''hi'\'''`},
+		{Command("git", "commit", "-m", ""), "git commit -m ''"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.cmd.String(); got != tt.want {
+			t.Errorf("String() = %s, want %s", got, tt.want)
+		}
+	}
+}
+
+func TestExec_Run(t *testing.T) {
+	ctx := context.Background()
+
+	cmd := Command("sh", "-c", `read line; echo "$line $GREETING"; echo oops >&2`)
+	cmd.Env = []string{"GREETING=world"}
+	cmd.Stdin = strings.NewReader("hello\n")
+	result, err := Exec{}.Run(ctx, cmd)
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if string(result.Stdout) != "hello world\n" || string(result.Stderr) != "oops\n" {
+		t.Errorf("Run() = %q, %q", result.Stdout, result.Stderr)
+	}
+
+	// Streamed output isn't captured
+	var out bytes.Buffer
+	cmd = Command("echo", "streamed")
+	cmd.Stdout = &out
+	result, err = Exec{}.Run(ctx, cmd)
+	if err != nil || out.String() != "streamed\n" || len(result.Stdout) != 0 {
+		t.Errorf("Run() streamed %q, captured %q, error %v", out.String(), result.Stdout, err)
+	}
+
+	_, err = Exec{}.Run(ctx, Command("sh", "-c", "echo failed >&2; exit 3"))
+	var exitErr *ExitError
+	if !errors.As(err, &exitErr) || exitErr.Code != 3 || exitErr.Stderr != "failed" {
+		t.Errorf("Run() error = %v, want exit status 3 with stderr", err)
+	}
+
+	timeout, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	if _, err := (Exec{}).Run(timeout, Command("sleep", "5")); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Run() error = %v, want the context's error", err)
+	}
+}
+
+func TestFake(t *testing.T) {
+	ctx := context.Background()
+	fake := NewFake()
+	fake.On("git", Response{Stdout: "any git"})
+	fake.On("git worktree list", Response{Stdout: "worktree /repo\n"})
+	fake.On("git show-ref", Response{ExitCode: 1})
+
+	result, err := fake.Run(ctx, Command("git", "worktree", "list", "--porcelain"))
+	if err != nil || string(result.Stdout) != "worktree /repo\n" {
+		t.Errorf("worktree list = %q, %v", result.Stdout, err)
+	}
+	if result, _ := fake.Run(ctx, Command("git", "status")); string(result.Stdout) != "any git" {
+		t.Errorf("git status = %q, want the catch-all rule", result.Stdout)
+	}
+	var exitErr *ExitError
+	if _, err := fake.Run(ctx, Command("git", "show-ref", "--verify", "refs/heads/x")); !errors.As(err, &exitErr) {
+		t.Errorf("show-ref error = %v, want an ExitError", err)
+	}
+	// Prefixes match whole words
+	if result, _ := fake.Run(ctx, Command("gitk")); len(result.Stdout) != 0 {
+		t.Errorf("gitk matched the git rule")
+	}
+
+	if !fake.Ran("git show-ref") || fake.Ran("docker") {
+		t.Errorf("Ran() doesn't reflect %v", fake.Commands())
+	}
+	if len(fake.Calls()) != 4 {
+		t.Errorf("Calls() = %d commands, want 4", len(fake.Calls()))
+	}
+
+	fake.Strict = true
+	if _, err := fake.Run(ctx, Command("docker", "ps")); err == nil {
+		t.Error("strict Fake ran an unscripted command")
+	}
+}
@@ -0,0 +1,483 @@
+package worktree
+
+import (
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultBackupDir = ".grove/backups"
+	backupTimeFormat = "20060102T150405Z"
+	backupExt        = ".sql.gz"
+)
+
+// Backup is a compressed SQL dump of a worktree's database
+type Backup struct {
+	Worktree  string    `json:"worktree"`
+	File      string    `json:"file"`
+	Path      string    `json:"path"`
+	CreatedAt time.Time `json:"created_at"`
+	Size      int64     `json:"size"`
+}
+
+// backupDir returns the directory holding a worktree's backups
+func (m *Manager) backupDir(worktreeName string) string {
+	dir := m.Config.Database.Backup.Dir
+	if dir == "" {
+		dir = defaultBackupDir
+	}
+	return filepath.Join(m.resolvePath(dir), worktreeName)
+}
+
+// BackupDatabase dumps a worktree's database to a timestamped file
+func (m *Manager) BackupDatabase(name string) (*Backup, error) {
+	return m.BackupDatabaseContext(context.Background(), name)
+}
+
+// BackupDatabaseContext is BackupDatabase with a context
+func (m *Manager) BackupDatabaseContext(ctx context.Context, name string) (*Backup, error) {
+	release, err := m.lock(ctx, true)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	if !m.Config.Database.Enabled {
+		return nil, fmt.Errorf("databases are not enabled in the grove config")
+	}
+
+	wt, err := m.findWorktree(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	return m.backupWorktree(ctx, wt)
+}
+
+// BackupAll dumps the database of every worktree that has one. A failing
+// worktree doesn't stop the others: the backups taken are returned along
+// with the failures.
+func (m *Manager) BackupAll() ([]Backup, error) {
+	return m.BackupAllContext(context.Background())
+}
+
+// BackupAllContext is BackupAll with a context
+func (m *Manager) BackupAllContext(ctx context.Context) ([]Backup, error) {
+	release, err := m.lock(ctx, true)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	if !m.Config.Database.Enabled {
+		return nil, fmt.Errorf("databases are not enabled in the grove config")
+	}
+
+	worktrees, err := m.ListWorktreesContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var backups []Backup
+	var errs []error
+	for _, wt := range worktrees {
+		if ctx.Err() != nil {
+			return backups, ctx.Err()
+		}
+		backup, err := m.backupIfExists(ctx, wt)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to back up %s: %w", filepath.Base(wt.Path), err))
+			continue
+		}
+		if backup != nil {
+			backups = append(backups, *backup)
+		}
+	}
+	return backups, errors.Join(errs...)
+}
+
+// backupIfExists backs up a worktree's database, returning nil when it has
+// none
+func (m *Manager) backupIfExists(ctx context.Context, wt WorktreeInfo) (*Backup, error) {
+	driver, err := m.database(ctx, wt.Path)
+	if err != nil {
+		return nil, err
+	}
+	exists, err := driver.DatabaseExists(m.databaseName(worktreeBranch(wt)))
+	if err != nil || !exists {
+		return nil, err
+	}
+	return m.backupWorktree(ctx, wt)
+}
+
+func (m *Manager) backupWorktree(ctx context.Context, wt WorktreeInfo) (*Backup, error) {
+	driver, err := m.database(ctx, wt.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	worktreeName := filepath.Base(wt.Path)
+	dir := m.backupDir(worktreeName)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create backup directory: %w", err)
+	}
+
+	now := time.Now().UTC()
+	path := uniqueBackupPath(dir, now)
+
+	// Dump to a temporary file so a failed dump never looks like a backup
+	tmp, err := os.CreateTemp(dir, ".backup-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create backup: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	gz := gzip.NewWriter(tmp)
+	if err := driver.DumpDatabase(m.databaseName(worktreeBranch(wt)), gz); err != nil {
+		tmp.Close()
+		return nil, err
+	}
+	if err := gz.Close(); err != nil {
+		tmp.Close()
+		return nil, fmt.Errorf("failed to write backup: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return nil, fmt.Errorf("failed to write backup: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return nil, fmt.Errorf("failed to write backup: %w", err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Printf("Backed up %s to %s\n", worktreeName, path)
+	return &Backup{
+		Worktree:  worktreeName,
+		File:      filepath.Base(path),
+		Path:      path,
+		CreatedAt: now,
+		Size:      info.Size(),
+	}, nil
+}
+
+// Backups lists a worktree's backups, newest first
+func (m *Manager) Backups(worktreeName string) ([]Backup, error) {
+	return m.BackupsContext(context.Background(), worktreeName)
+}
+
+// BackupsContext is Backups with a context
+func (m *Manager) BackupsContext(ctx context.Context, worktreeName string) ([]Backup, error) {
+	release, err := m.lock(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	dir := m.backupDir(worktreeName)
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to list backups: %w", err)
+	}
+
+	var backups []Backup
+	seqs := make(map[string]int)
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, backupExt) {
+			continue
+		}
+		createdAt, seq, ok := parseBackupName(name)
+		if !ok {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		seqs[name] = seq
+		backups = append(backups, Backup{
+			Worktree:  worktreeName,
+			File:      name,
+			Path:      filepath.Join(dir, name),
+			CreatedAt: createdAt,
+			Size:      info.Size(),
+		})
+	}
+
+	sort.Slice(backups, func(i, j int) bool {
+		if !backups[i].CreatedAt.Equal(backups[j].CreatedAt) {
+			return backups[i].CreatedAt.After(backups[j].CreatedAt)
+		}
+		return seqs[backups[i].File] > seqs[backups[j].File]
+	})
+	return backups, nil
+}
+
+// uniqueBackupPath names a backup taken at t, numbering backups taken within
+// the same second so none overwrites another
+func uniqueBackupPath(dir string, t time.Time) string {
+	stamp := t.Format(backupTimeFormat)
+	path := filepath.Join(dir, stamp+backupExt)
+	for seq := 2; ; seq++ {
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			return path
+		}
+		path = filepath.Join(dir, fmt.Sprintf("%s-%d%s", stamp, seq, backupExt))
+	}
+}
+
+// parseBackupName returns when a backup was taken and its number within
+// that second
+func parseBackupName(name string) (time.Time, int, bool) {
+	stamp, suffix, numbered := strings.Cut(strings.TrimSuffix(name, backupExt), "-")
+	createdAt, err := time.Parse(backupTimeFormat, stamp)
+	if err != nil {
+		return time.Time{}, 0, false
+	}
+	if !numbered {
+		return createdAt, 1, true
+	}
+	seq, err := strconv.Atoi(suffix)
+	if err != nil {
+		return time.Time{}, 0, false
+	}
+	return createdAt, seq, true
+}
+
+// RestoreDatabase replaces a worktree's database with a backup, the latest
+// when backup is empty
+func (m *Manager) RestoreDatabase(name, backup string) error {
+	return m.RestoreDatabaseContext(context.Background(), name, backup)
+}
+
+// RestoreDatabaseContext is RestoreDatabase with a context
+func (m *Manager) RestoreDatabaseContext(ctx context.Context, name, backup string) error {
+	release, err := m.lock(ctx, true)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	if !m.Config.Database.Enabled {
+		return fmt.Errorf("databases are not enabled in the grove config")
+	}
+
+	wt, err := m.findWorktree(ctx, name)
+	if err != nil {
+		return err
+	}
+	return m.restoreWorktree(ctx, wt, backup)
+}
+
+func (m *Manager) restoreWorktree(ctx context.Context, wt WorktreeInfo, backup string) error {
+	path, err := m.findBackup(ctx, filepath.Base(wt.Path), backup)
+	if err != nil {
+		return err
+	}
+
+	// A truncated or corrupt file fails here, before anything is dropped
+	if err := readBackup(path, io.Discard); err != nil {
+		return err
+	}
+
+	driver, err := m.database(ctx, wt.Path)
+	if err != nil {
+		return err
+	}
+
+	// Import into a scratch database, and only replace the worktree's once
+	// the import has succeeded
+	dbName := m.databaseName(worktreeBranch(wt))
+	scratch := dbName + "_restore"
+	if err := driver.DropDatabase(scratch); err != nil {
+		return err
+	}
+	if err := driver.CreateDatabase(scratch); err != nil {
+		return err
+	}
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(readBackup(path, pw))
+	}()
+	err = driver.ImportSQL(scratch, pr)
+	pr.Close()
+	if err != nil {
+		driver.DropDatabase(scratch)
+		return err
+	}
+
+	if err := driver.DropDatabase(dbName); err != nil {
+		driver.DropDatabase(scratch)
+		return err
+	}
+	if err := driver.CloneDatabase(scratch, dbName); err != nil {
+		return fmt.Errorf("failed to replace %s, the restored data is in %s: %w", dbName, scratch, err)
+	}
+	if err := driver.DropDatabase(scratch); err != nil {
+		return err
+	}
+
+	fmt.Printf("Restored %s from %s\n", dbName, filepath.Base(path))
+	return nil
+}
+
+// readBackup decompresses a backup into w, failing on a truncated or
+// corrupt file
+func readBackup(path string, w io.Writer) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open backup: %w", err)
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return fmt.Errorf("failed to read backup %s: %w", filepath.Base(path), err)
+	}
+	defer gz.Close()
+
+	if _, err := io.Copy(w, gz); err != nil {
+		return fmt.Errorf("failed to read backup %s: %w", filepath.Base(path), err)
+	}
+	return nil
+}
+
+// findBackup resolves a backup file name or path for a worktree
+func (m *Manager) findBackup(ctx context.Context, worktreeName, backup string) (string, error) {
+	if backup == "" {
+		backups, err := m.BackupsContext(ctx, worktreeName)
+		if err != nil {
+			return "", err
+		}
+		if len(backups) == 0 {
+			return "", fmt.Errorf("no backups found for '%s'", worktreeName)
+		}
+		return backups[0].Path, nil
+	}
+
+	if strings.ContainsRune(backup, os.PathSeparator) {
+		return backup, nil
+	}
+
+	path := filepath.Join(m.backupDir(worktreeName), backup)
+	if _, err := os.Stat(path); err != nil {
+		return "", fmt.Errorf("backup '%s' not found for '%s'", backup, worktreeName)
+	}
+	return path, nil
+}
+
+// PruneBackups removes a worktree's backups older than the retention period
+func (m *Manager) PruneBackups(worktreeName string, now time.Time) ([]Backup, error) {
+	return m.PruneBackupsContext(context.Background(), worktreeName, now)
+}
+
+// PruneBackupsContext is PruneBackups with a context
+func (m *Manager) PruneBackupsContext(ctx context.Context, worktreeName string, now time.Time) ([]Backup, error) {
+	release, err := m.lock(ctx, true)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	days := m.Config.Database.Backup.RetentionDays
+	if days <= 0 {
+		return nil, nil
+	}
+
+	backups, err := m.BackupsContext(ctx, worktreeName)
+	if err != nil {
+		return nil, err
+	}
+
+	cutoff := now.AddDate(0, 0, -days)
+	var pruned []Backup
+	for _, b := range backups {
+		if b.CreatedAt.Before(cutoff) {
+			if err := os.Remove(b.Path); err != nil {
+				return pruned, fmt.Errorf("failed to prune backup: %w", err)
+			}
+			pruned = append(pruned, b)
+		}
+	}
+	return pruned, nil
+}
+
+// pruneAllBackups applies the retention period to every worktree's backups,
+// including those of removed worktrees
+func (m *Manager) pruneAllBackups(ctx context.Context, now time.Time) error {
+	entries, err := os.ReadDir(m.backupDir(""))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to list backups: %w", err)
+	}
+
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		pruned, err := m.PruneBackupsContext(ctx, entry.Name(), now)
+		if err != nil {
+			return err
+		}
+		for _, b := range pruned {
+			fmt.Printf("Pruned backup %s/%s\n", b.Worktree, b.File)
+		}
+	}
+	return nil
+}
+
+// RunDaemon backs up every worktree database on the configured schedule and
+// prunes expired backups until ctx is cancelled
+func (m *Manager) RunDaemon(ctx context.Context) error {
+	cfg := m.Config.Database.Backup
+	if !m.Config.Database.Enabled || !cfg.Enabled || cfg.Schedule == "" {
+		return fmt.Errorf("database backups with a schedule are not configured")
+	}
+
+	schedule, err := ParseCron(cfg.Schedule)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("grove daemon backing up databases on '%s'\n", cfg.Schedule)
+	for {
+		next := schedule.Next(time.Now())
+		if next.IsZero() {
+			return fmt.Errorf("schedule '%s' never runs", cfg.Schedule)
+		}
+
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil
+		case <-timer.C:
+		}
+
+		if _, err := m.BackupAllContext(ctx); err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			fmt.Fprintf(os.Stderr, "grove daemon: backup failed: %v\n", err)
+		}
+		if err := m.pruneAllBackups(ctx, time.Now()); err != nil {
+			fmt.Fprintf(os.Stderr, "grove daemon: %v\n", err)
+		}
+	}
+}
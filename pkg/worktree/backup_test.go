@@ -0,0 +1,158 @@
+package worktree
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/glanotte/grove/pkg/runner"
+)
+
+func TestManager_backupAndRestore(t *testing.T) {
+	db := newFakeDatabase("testapp_feature_auth")
+	db.imported["testapp_feature_auth"] = "INSERT INTO users VALUES (1);\n"
+	manager := newDatabaseTestManager(t, db)
+	wt := WorktreeInfo{Path: filepath.Join(manager.BaseDir, "worktrees", "feature-auth"), Branch: "feature/auth"}
+
+	backup, err := manager.backupWorktree(context.Background(), wt)
+	if err != nil {
+		t.Fatalf("backupWorktree() error = %v", err)
+	}
+	wantDir := filepath.Join(manager.BaseDir, ".grove", "backups", "feature-auth")
+	if filepath.Dir(backup.Path) != wantDir || !strings.HasSuffix(backup.File, ".sql.gz") {
+		t.Errorf("Unexpected backup path %s", backup.Path)
+	}
+
+	backups, err := manager.Backups("feature-auth")
+	if err != nil || len(backups) != 1 || backups[0].File != backup.File {
+		t.Fatalf("Backups() = %v, %v", backups, err)
+	}
+
+	// Restoring the latest backup replaces the current data
+	db.imported["testapp_feature_auth"] = "INSERT INTO users VALUES (2);\n"
+	if err := manager.restoreWorktree(context.Background(), wt, ""); err != nil {
+		t.Fatalf("restoreWorktree() error = %v", err)
+	}
+	want := "-- dump of testapp_feature_auth\nINSERT INTO users VALUES (1);\n"
+	if got := db.imported["testapp_feature_auth"]; got != want {
+		t.Errorf("Restored data = %q, want %q", got, want)
+	}
+
+	if err := manager.restoreWorktree(context.Background(), wt, "missing.sql.gz"); err == nil {
+		t.Error("Expected an error for a missing backup")
+	}
+
+	// A truncated backup leaves the current database alone
+	data, err := os.ReadFile(backup.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	truncated := filepath.Join(wantDir, "truncated.sql.gz")
+	if err := os.WriteFile(truncated, data[:len(data)-8], 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := manager.restoreWorktree(context.Background(), wt, truncated); err == nil {
+		t.Error("Expected an error for a truncated backup")
+	}
+	if got := db.imported["testapp_feature_auth"]; got != want {
+		t.Errorf("Data after a failed restore = %q, want %q", got, want)
+	}
+	if db.databases["testapp_feature_auth_restore"] {
+		t.Error("Scratch database left behind")
+	}
+	os.Remove(truncated)
+
+	// Backups taken within the same second don't overwrite each other
+	second, err := manager.backupWorktree(context.Background(), wt)
+	if err != nil {
+		t.Fatalf("backupWorktree() error = %v", err)
+	}
+	third, err := manager.backupWorktree(context.Background(), wt)
+	if err != nil {
+		t.Fatalf("backupWorktree() error = %v", err)
+	}
+	if backups, _ := manager.Backups("feature-auth"); len(backups) != 3 || backups[0].File != third.File || backups[1].File != second.File {
+		t.Errorf("Backups() = %v, want 3 backups, newest first", backups)
+	}
+}
+
+func TestManager_BackupAll(t *testing.T) {
+	db := newFakeDatabase("testapp_feature_a", "testapp_feature_b", "testapp_feature_c")
+	db.dumpErrs = map[string]error{"testapp_feature_b": errors.New("container is not running")}
+	manager := newDatabaseTestManager(t, db)
+
+	var list strings.Builder
+	for _, name := range []string{"a", "b", "c"} {
+		fmt.Fprintf(&list, "worktree %s\nHEAD abc123\nbranch refs/heads/feature/%s\n\n", filepath.Join(manager.BaseDir, "worktrees", "feature-"+name), name)
+	}
+	fake := runner.NewFake()
+	fake.On("git worktree list", runner.Response{Stdout: list.String()})
+	manager.Runner = fake
+
+	backups, err := manager.BackupAll()
+	if err == nil || !strings.Contains(err.Error(), "feature-b") || !strings.Contains(err.Error(), "container is not running") {
+		t.Errorf("BackupAll() error = %v, want the feature-b failure", err)
+	}
+	if len(backups) != 2 || backups[0].Worktree != "feature-a" || backups[1].Worktree != "feature-c" {
+		t.Errorf("BackupAll() = %v, want backups of feature-a and feature-c", backups)
+	}
+}
+
+func TestParseBackupName(t *testing.T) {
+	stamp := time.Date(2024, 5, 15, 2, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		wantSeq int
+		wantOK  bool
+	}{
+		{name: "20240515T020000Z.sql.gz", wantSeq: 1, wantOK: true},
+		{name: "20240515T020000Z-12.sql.gz", wantSeq: 12, wantOK: true},
+		{name: "20240515T020000Z-x.sql.gz"},
+		{name: "notes.sql.gz"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			createdAt, seq, ok := parseBackupName(tt.name)
+			if ok != tt.wantOK || seq != tt.wantSeq || (ok && !createdAt.Equal(stamp)) {
+				t.Errorf("parseBackupName() = %v, %d, %v", createdAt, seq, ok)
+			}
+		})
+	}
+}
+
+func TestManager_PruneBackups(t *testing.T) {
+	manager := newDatabaseTestManager(t, newFakeDatabase())
+	manager.Config.Database.Backup.RetentionDays = 7
+
+	now := time.Date(2024, 5, 15, 2, 0, 0, 0, time.UTC)
+	dir := manager.backupDir("feature-auth")
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	for _, age := range []int{1, 6, 8, 30} {
+		name := now.AddDate(0, 0, -age).Format(backupTimeFormat) + backupExt
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	pruned, err := manager.PruneBackups("feature-auth", now)
+	if err != nil {
+		t.Fatalf("PruneBackups() error = %v", err)
+	}
+	if len(pruned) != 2 {
+		t.Errorf("Expected 2 backups to be pruned, got %d", len(pruned))
+	}
+
+	backups, _ := manager.Backups("feature-auth")
+	if len(backups) != 2 || !backups[0].CreatedAt.Equal(now.AddDate(0, 0, -1)) {
+		t.Errorf("Expected the 2 newest backups to remain, newest first, got %v", backups)
+	}
+}
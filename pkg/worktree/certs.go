@@ -0,0 +1,376 @@
+package worktree
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/glanotte/grove/pkg/runner"
+)
+
+const (
+	caValidity = 10 * 365 * 24 * time.Hour
+	// Browsers reject leaf certificates valid for more than 825 days
+	leafValidity = 825 * 24 * time.Hour
+	// Certificates are reissued when they expire within renewBefore
+	renewBefore = 30 * 24 * time.Hour
+)
+
+// CertificateAuthority signs certificates for worktree subdomains
+type CertificateAuthority struct {
+	Cert     *x509.Certificate
+	Key      crypto.Signer
+	CertPath string
+}
+
+// LoadOrCreateCA loads the CA stored in dir, generating it on first use
+func LoadOrCreateCA(dir string) (*CertificateAuthority, error) {
+	certPath := filepath.Join(dir, "ca.pem")
+	keyPath := filepath.Join(dir, "ca-key.pem")
+
+	if _, err := os.Stat(certPath); err == nil {
+		return loadCA(certPath, keyPath)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate CA key: %w", err)
+	}
+
+	serial, err := randomSerial()
+	if err != nil {
+		return nil, err
+	}
+
+	host, _ := os.Hostname()
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject: pkix.Name{
+			Organization: []string{"grove development CA"},
+			CommonName:   fmt.Sprintf("grove CA (%s)", host),
+		},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(caValidity),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create CA certificate: %w", err)
+	}
+
+	keyPEM, err := encodeKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create CA directory: %w", err)
+	}
+	if err := writeFileAtomic(keyPath, keyPEM, 0600); err != nil {
+		return nil, fmt.Errorf("failed to write CA key: %w", err)
+	}
+	if err := writeFileAtomic(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644); err != nil {
+		return nil, fmt.Errorf("failed to write CA certificate: %w", err)
+	}
+
+	return loadCA(certPath, keyPath)
+}
+
+// loadCA reads a PEM encoded CA certificate and private key
+func loadCA(certPath, keyPath string) (*CertificateAuthority, error) {
+	cert, err := readCertificate(certPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CA certificate: %w", err)
+	}
+
+	keyData, err := os.ReadFile(keyPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CA key: %w", err)
+	}
+	block, _ := pem.Decode(keyData)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data in %s", keyPath)
+	}
+
+	var key interface{}
+	switch block.Type {
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	default:
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse CA key: %w", err)
+	}
+
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported CA key type %T", key)
+	}
+
+	return &CertificateAuthority{Cert: cert, Key: signer, CertPath: certPath}, nil
+}
+
+// Issue creates a server certificate for hosts signed by the CA
+func (ca *CertificateAuthority) Issue(hosts []string) (certPEM, keyPEM []byte, err error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to generate key: %w", err)
+	}
+
+	serial, err := randomSerial()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	notAfter := time.Now().Add(leafValidity)
+	if notAfter.After(ca.Cert.NotAfter) {
+		notAfter = ca.Cert.NotAfter
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject: pkix.Name{
+			Organization: []string{"grove development certificate"},
+			CommonName:   hosts[0],
+		},
+		DNSNames:    hosts,
+		NotBefore:   time.Now().Add(-time.Hour),
+		NotAfter:    notAfter,
+		KeyUsage:    x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.Cert, &key.PublicKey, ca.Key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create certificate: %w", err)
+	}
+
+	keyPEM, err = encodeKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), keyPEM, nil
+}
+
+// localCertificates reports whether grove issues certificates itself
+func (m *Manager) localCertificates() bool {
+	ssl := m.Config.Web.SSL
+	return ssl.Enabled && (ssl.Provider == "self-signed" || ssl.Provider == "mkcert")
+}
+
+// CertificateAuthority returns the CA used for the configured provider
+func (m *Manager) CertificateAuthority() (*CertificateAuthority, error) {
+	return m.CertificateAuthorityContext(context.Background())
+}
+
+// CertificateAuthorityContext is CertificateAuthority with a context
+func (m *Manager) CertificateAuthorityContext(ctx context.Context) (*CertificateAuthority, error) {
+	if m.Config.Web.SSL.Provider == "mkcert" {
+		result, err := m.run(ctx, runner.Command("mkcert", "-CAROOT"))
+		if err != nil {
+			return nil, fmt.Errorf("failed to locate mkcert CA (is mkcert installed?): %w", err)
+		}
+		dir := strings.TrimSpace(string(result.Stdout))
+		ca, err := loadCA(filepath.Join(dir, "rootCA.pem"), filepath.Join(dir, "rootCA-key.pem"))
+		if err != nil {
+			return nil, fmt.Errorf("%w (run 'mkcert -install' first)", err)
+		}
+		return ca, nil
+	}
+
+	dir, err := m.caDir()
+	if err != nil {
+		return nil, err
+	}
+	return LoadOrCreateCA(dir)
+}
+
+// caDir returns the directory holding grove's CA
+func (m *Manager) caDir() (string, error) {
+	if m.Config.Web.SSL.CADir != "" {
+		return expandHome(m.Config.Web.SSL.CADir)
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to find home directory: %w", err)
+	}
+	return filepath.Join(home, ".config", "grove", "ca"), nil
+}
+
+// certificateHosts returns the names a route's certificate covers and the
+// name its files are stored under
+func (m *Manager) certificateHosts(route Route) (hosts []string, name string) {
+	if m.Config.Web.SSL.Wildcard {
+		if i := strings.Index(route.Host, "."); i > 0 {
+			domain := route.Host[i+1:]
+			return []string{"*." + domain, domain}, domain
+		}
+	}
+	return []string{route.Host}, route.Host
+}
+
+// certPaths returns where the chosen proxy expects a route's certificate
+func (m *Manager) certPaths(route Route) (certPath, keyPath string) {
+	_, name := m.certificateHosts(route)
+
+	dir := m.Config.Web.SSL.CertDir
+	if m.Config.Web.ProxyType == "nginx-proxy" && m.Config.Web.NginxProxy.CertsDir != "" {
+		// nginx-proxy picks up <host>.crt, falling back to the parent domain
+		dir = m.Config.Web.NginxProxy.CertsDir
+	}
+	if dir == "" {
+		dir = filepath.Join(".grove", "certs")
+	}
+
+	dir = m.resolvePath(dir)
+	return filepath.Join(dir, name+".crt"), filepath.Join(dir, name+".key")
+}
+
+// ensureCertificate issues a certificate for the route unless a valid one
+// already exists
+func (m *Manager) ensureCertificate(ctx context.Context, route Route) error {
+	hosts, _ := m.certificateHosts(route)
+	certPath, keyPath := m.certPaths(route)
+
+	if cert, err := readCertificate(certPath); err == nil {
+		if time.Until(cert.NotAfter) > renewBefore && cert.VerifyHostname(route.Host) == nil {
+			return nil
+		}
+	}
+
+	ca, err := m.CertificateAuthorityContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	certPEM, keyPEM, err := ca.Issue(hosts)
+	if err != nil {
+		return err
+	}
+
+	if err := writeFileAtomic(keyPath, keyPEM, 0600); err != nil {
+		return fmt.Errorf("failed to write certificate key: %w", err)
+	}
+	if err := writeFileAtomic(certPath, certPEM, 0644); err != nil {
+		return fmt.Errorf("failed to write certificate: %w", err)
+	}
+
+	return nil
+}
+
+// removeCertificate deletes a per-worktree certificate. Wildcard
+// certificates are shared and kept.
+func (m *Manager) removeCertificate(route Route) error {
+	if m.Config.Web.SSL.Wildcard {
+		return nil
+	}
+
+	certPath, keyPath := m.certPaths(route)
+	for _, path := range []string{certPath, keyPath} {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove certificate: %w", err)
+		}
+	}
+	return nil
+}
+
+// TrustInstructions explains how to trust the CA on this system
+func TrustInstructions(caPath string) string {
+	return fmt.Sprintf(`To trust grove's development CA, run one of:
+
+  Debian/Ubuntu:  sudo cp %[1]s /usr/local/share/ca-certificates/grove.crt && sudo update-ca-certificates
+  Fedora/RHEL:    sudo cp %[1]s /etc/pki/ca-trust/source/anchors/grove.pem && sudo update-ca-trust
+  macOS:          sudo security add-trusted-cert -d -r trustRoot -k /Library/Keychains/System.keychain %[1]s
+
+Firefox keeps its own store: import %[1]s under Settings > Certificates.
+`, caPath)
+}
+
+// systemCAPath is where InstallCA places the CA for update-ca-certificates
+var systemCAPath = "/usr/local/share/ca-certificates/grove.crt"
+
+// InstallCA copies the CA into the system store and runs update-ca-certificates
+func (m *Manager) InstallCA(caPath string) error {
+	return m.InstallCAContext(context.Background(), caPath)
+}
+
+// InstallCAContext is InstallCA with a context
+func (m *Manager) InstallCAContext(ctx context.Context, caPath string) error {
+	data, err := os.ReadFile(caPath)
+	if err != nil {
+		return fmt.Errorf("failed to read CA certificate: %w", err)
+	}
+
+	if err := os.WriteFile(systemCAPath, data, 0644); err != nil {
+		if errors.Is(err, os.ErrPermission) {
+			return fmt.Errorf("installing the CA requires root: %w", err)
+		}
+		return fmt.Errorf("failed to install CA certificate: %w", err)
+	}
+
+	if result, err := m.run(ctx, runner.Command("update-ca-certificates")); err != nil {
+		return fmt.Errorf("update-ca-certificates failed: %s", commandOutput(result, err))
+	}
+
+	return nil
+}
+
+func readCertificate(path string) (*x509.Certificate, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, fmt.Errorf("no certificate in %s", path)
+	}
+	return x509.ParseCertificate(block.Bytes)
+}
+
+func encodeKey(key *ecdsa.PrivateKey) ([]byte, error) {
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode key: %w", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), nil
+}
+
+func randomSerial() (*big.Int, error) {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate serial number: %w", err)
+	}
+	return serial, nil
+}
+
+// expandHome replaces a leading ~ with the user's home directory
+func expandHome(path string) (string, error) {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to find home directory: %w", err)
+	}
+	return filepath.Join(home, strings.TrimPrefix(path, "~")), nil
+}
@@ -0,0 +1,226 @@
+package worktree
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/glanotte/grove/pkg/runner"
+)
+
+func newCertTestManager(t *testing.T, ssl SSLConfig) *Manager {
+	ssl.Enabled = true
+	ssl.Provider = "self-signed"
+	ssl.CADir = filepath.Join(t.TempDir(), "ca")
+
+	return &Manager{
+		BaseDir: t.TempDir(),
+		Config: &Config{
+			Project: ProjectConfig{
+				Name:   "testapp",
+				Domain: "app.lvh.me",
+			},
+			Web: WebConfig{
+				Enabled:          true,
+				ProxyType:        "traefik",
+				SubdomainPattern: "{branch}.{project_domain}",
+				SSL:              ssl,
+			},
+		},
+	}
+}
+
+func TestLoadOrCreateCA(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "ca")
+
+	ca, err := LoadOrCreateCA(dir)
+	if err != nil {
+		t.Fatalf("LoadOrCreateCA() error = %v", err)
+	}
+	if !ca.Cert.IsCA {
+		t.Error("Expected a CA certificate")
+	}
+
+	info, err := os.Stat(filepath.Join(dir, "ca-key.pem"))
+	if err != nil {
+		t.Fatalf("Expected CA key to be written: %v", err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("Expected CA key mode 0600, got %v", info.Mode().Perm())
+	}
+
+	again, err := LoadOrCreateCA(dir)
+	if err != nil {
+		t.Fatalf("LoadOrCreateCA() reload error = %v", err)
+	}
+	if again.Cert.SerialNumber.Cmp(ca.Cert.SerialNumber) != 0 {
+		t.Error("Expected the existing CA to be reused")
+	}
+}
+
+func TestManager_InstallCA(t *testing.T) {
+	ca, err := LoadOrCreateCA(filepath.Join(t.TempDir(), "ca"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	saved := systemCAPath
+	systemCAPath = filepath.Join(t.TempDir(), "grove.crt")
+	defer func() { systemCAPath = saved }()
+
+	fake := runner.NewFake()
+	fake.Strict = true
+	fake.On("update-ca-certificates", runner.Response{})
+	manager := &Manager{Config: &Config{}, Runner: fake}
+
+	if err := manager.InstallCAContext(context.Background(), ca.CertPath); err != nil {
+		t.Fatalf("InstallCAContext() error = %v", err)
+	}
+	if _, err := os.Stat(systemCAPath); err != nil {
+		t.Errorf("Expected the CA in the system store: %v", err)
+	}
+	if !fake.Ran("update-ca-certificates") {
+		t.Error("Expected update-ca-certificates to run")
+	}
+
+	fake.On("update-ca-certificates", runner.Response{ExitCode: 1, Stderr: "read-only file system"})
+	if err := manager.InstallCA(ca.CertPath); err == nil || !strings.Contains(err.Error(), "read-only file system") {
+		t.Errorf("InstallCA() error = %v, want the command's output", err)
+	}
+}
+
+func TestManager_ensureCertificate(t *testing.T) {
+	tests := []struct {
+		name     string
+		wildcard bool
+		wantFile string
+		wantDNS  []string
+	}{
+		{
+			name:     "per worktree",
+			wantFile: "feature-auth.app.lvh.me.crt",
+			wantDNS:  []string{"feature-auth.app.lvh.me"},
+		},
+		{
+			name:     "wildcard",
+			wildcard: true,
+			wantFile: "app.lvh.me.crt",
+			wantDNS:  []string{"*.app.lvh.me", "app.lvh.me"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			manager := newCertTestManager(t, SSLConfig{Wildcard: tt.wildcard})
+			route := Route{Name: "feature-auth", Host: "feature-auth.app.lvh.me"}
+
+			if err := manager.ensureCertificate(context.Background(), route); err != nil {
+				t.Fatalf("ensureCertificate() error = %v", err)
+			}
+
+			certPath, keyPath := manager.certPaths(route)
+			if filepath.Base(certPath) != tt.wantFile {
+				t.Errorf("Expected certificate file %s, got %s", tt.wantFile, certPath)
+			}
+			if _, err := tls.LoadX509KeyPair(certPath, keyPath); err != nil {
+				t.Fatalf("Expected a usable key pair: %v", err)
+			}
+
+			cert, err := readCertificate(certPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if strings.Join(cert.DNSNames, ",") != strings.Join(tt.wantDNS, ",") {
+				t.Errorf("DNSNames = %v, want %v", cert.DNSNames, tt.wantDNS)
+			}
+
+			ca, err := manager.CertificateAuthority()
+			if err != nil {
+				t.Fatal(err)
+			}
+			roots := x509.NewCertPool()
+			roots.AddCert(ca.Cert)
+			if _, err := cert.Verify(x509.VerifyOptions{DNSName: route.Host, Roots: roots}); err != nil {
+				t.Errorf("Certificate doesn't verify against the grove CA: %v", err)
+			}
+
+			// A valid certificate is not reissued
+			if err := manager.ensureCertificate(context.Background(), route); err != nil {
+				t.Fatal(err)
+			}
+			again, _ := readCertificate(certPath)
+			if again.SerialNumber.Cmp(cert.SerialNumber) != 0 {
+				t.Error("Expected the existing certificate to be kept")
+			}
+
+			if err := manager.removeCertificate(route); err != nil {
+				t.Fatal(err)
+			}
+			_, err = os.Stat(certPath)
+			if tt.wildcard == os.IsNotExist(err) {
+				t.Errorf("Unexpected certificate presence after removal (wildcard=%v): %v", tt.wildcard, err)
+			}
+		})
+	}
+}
+
+func TestManager_certPathsNginxProxy(t *testing.T) {
+	manager := newCertTestManager(t, SSLConfig{})
+	manager.Config.Web.ProxyType = "nginx-proxy"
+	manager.Config.Web.NginxProxy.CertsDir = "/srv/nginx/certs"
+
+	certPath, keyPath := manager.certPaths(Route{Host: "main.app.lvh.me"})
+	if certPath != "/srv/nginx/certs/main.app.lvh.me.crt" || keyPath != "/srv/nginx/certs/main.app.lvh.me.key" {
+		t.Errorf("certPaths() = %s, %s", certPath, keyPath)
+	}
+}
+
+func TestTraefikProxy_dynamicConfigTLS(t *testing.T) {
+	manager := newCertTestManager(t, SSLConfig{})
+	route := Route{Name: "main", Host: "main.app.lvh.me", Port: 10001}
+
+	cfg := (&traefikProxy{m: manager}).dynamicConfig(route)
+	if cfg.HTTP.Routers["testapp-main"].TLS == nil {
+		t.Error("Expected router TLS to be enabled")
+	}
+
+	certPath, _ := manager.certPaths(route)
+	if cfg.TLS == nil || cfg.TLS.Certificates[0].CertFile != certPath {
+		t.Errorf("Expected TLS certificate %s, got %+v", certPath, cfg.TLS)
+	}
+}
+
+func TestTraefikProxy_labelsTLS(t *testing.T) {
+	manager := newCertTestManager(t, SSLConfig{})
+	manager.Config.Web.Traefik.Labels = true
+	manager.Config.Web.Traefik.ContainerPort = 8080
+	route := Route{Name: "main", Host: "main.app.lvh.me", Port: 10001}
+	backend := &traefikProxy{m: manager}
+
+	labels := strings.Join(backend.labels(route), "\n")
+	for _, want := range []string{
+		"traefik.http.routers.testapp-main.tls=true",
+		"traefik.http.services.testapp-main.loadbalancer.server.port=8080",
+	} {
+		if !strings.Contains(labels, want) {
+			t.Errorf("labels missing %s:\n%s", want, labels)
+		}
+	}
+
+	// The certificate still reaches Traefik through the file provider
+	if err := backend.Register(context.Background(), route); err != nil {
+		t.Fatalf("Register() error = %v", err)
+	}
+	data, err := os.ReadFile(backend.configPath(route))
+	if err != nil {
+		t.Fatalf("Expected a TLS config file: %v", err)
+	}
+	certPath, _ := manager.certPaths(route)
+	if !strings.Contains(string(data), certPath) || strings.Contains(string(data), "routers") {
+		t.Errorf("TLS config = %s, want only the certificate", data)
+	}
+}
@@ -1,5 +1,12 @@
 package worktree
 
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
 // Config represents the worktree configuration
 type Config struct {
 	Version   int                    `yaml:"version"`
@@ -7,31 +14,322 @@ type Config struct {
 	Worktree  WorktreeConfig         `yaml:"worktree"`
 	Docker    DockerConfig           `yaml:"docker"`
 	Web       WebConfig              `yaml:"web"`
+	Database  DatabaseConfig         `yaml:"database"`
+	Cache     CacheConfig            `yaml:"cache"`
+	Cleanup   CleanupConfig          `yaml:"cleanup"`
 	Templates TemplateConfig         `yaml:"templates"`
+	Timeouts  TimeoutsConfig         `yaml:"timeouts"`
 	Variables map[string]interface{} `yaml:"variables"`
+	// Environment is the overlay applied when no --env is given
+	Environment string `yaml:"environment"`
+	// Environments are partial configs deep-merged over the base config
+	Environments map[string]map[string]interface{} `yaml:"environments"`
+}
+
+// Validate checks the configured patterns, rejecting unknown placeholders
+func (c *Config) Validate() error {
+	patterns := []struct{ field, pattern string }{
+		{"worktree.naming_pattern", c.Worktree.NamingPattern},
+		{"web.subdomain_pattern", c.Web.SubdomainPattern},
+		{"docker.network.name", c.Docker.Network.Name},
+		{"docker.container_prefix", c.Docker.ContainerPrefix},
+		{"database.name_pattern", c.Database.NamePattern},
+		{"cache.redis.database_pattern", c.Cache.Redis.DatabasePattern},
+	}
+	for _, p := range patterns {
+		if err := validatePattern(p.field, p.pattern); err != nil {
+			return err
+		}
+	}
+
+	if ports := c.Docker.Ports; ports.RangeEnd != 0 && ports.RangeEnd < ports.RangeStart {
+		return fmt.Errorf("docker.ports.range_end must not be below range_start")
+	}
+
+	if strings.ContainsAny(c.Worktree.NamingPattern, `/\`) {
+		return fmt.Errorf("worktree.naming_pattern: path separators are not allowed")
+	}
+
+	if c.Worktree.Hooks.Timeout != "" {
+		if _, err := time.ParseDuration(c.Worktree.Hooks.Timeout); err != nil {
+			return fmt.Errorf("worktree.hooks.timeout: %w", err)
+		}
+	}
+
+	timeouts := []struct{ step, value string }{
+		{stepGit, c.Timeouts.Git},
+		{stepDocker, c.Timeouts.Docker},
+		{stepDatabase, c.Timeouts.Database},
+		{stepProxy, c.Timeouts.Proxy},
+		{stepHealth, c.Timeouts.Health},
+	}
+	for _, t := range timeouts {
+		if t.value == "" {
+			continue
+		}
+		if _, err := time.ParseDuration(t.value); err != nil {
+			return fmt.Errorf("timeouts.%s: %w", t.step, err)
+		}
+	}
+
+	if c.Database.Backup.Schedule != "" {
+		if _, err := ParseCron(c.Database.Backup.Schedule); err != nil {
+			return fmt.Errorf("database.backup.schedule: %w", err)
+		}
+	}
+
+	for name, value := range c.Variables {
+		if _, _, err := parseGenerateSpec(value); err != nil {
+			return fmt.Errorf("variables.%s: %w", name, err)
+		}
+	}
+
+	if c.Worktree.TicketPattern != "" {
+		if _, err := regexp.Compile(c.Worktree.TicketPattern); err != nil {
+			return fmt.Errorf("worktree.ticket_pattern: %w", err)
+		}
+	}
+
+	return nil
 }
 
 type ProjectConfig struct {
 	Name   string `yaml:"name"`
 	Domain string `yaml:"domain"`
+	// Domains replaces Domain when the named environment is selected
+	Domains map[string]string `yaml:"domains"`
 }
 
 type WorktreeConfig struct {
 	BasePath      string `yaml:"base_path"`
 	NamingPattern string `yaml:"naming_pattern"`
+	// TicketPattern is the regular expression {ticket} is extracted with
+	TicketPattern string      `yaml:"ticket_pattern"`
+	Hooks         HooksConfig `yaml:"hooks"`
+}
+
+// HooksConfig lists shell commands run at each point of a worktree's
+// lifecycle. A failing pre_* hook aborts the operation.
+type HooksConfig struct {
+	PreCreate  string `yaml:"pre_create"`
+	PostCreate string `yaml:"post_create"`
+	PreRemove  string `yaml:"pre_remove"`
+	PostRemove string `yaml:"post_remove"`
+	PreUp      string `yaml:"pre_up"`
+	PostUp     string `yaml:"post_up"`
+	PreDown    string `yaml:"pre_down"`
+	PostDown   string `yaml:"post_down"`
+	PreRender  string `yaml:"pre_render"`
+	PostRender string `yaml:"post_render"`
+	// Timeout bounds each hook, as a Go duration (default 5m)
+	Timeout string `yaml:"timeout"`
+}
+
+// TimeoutsConfig bounds each step of an operation, as Go durations. A step
+// that runs longer is cancelled, and an interrupted create is rolled back.
+type TimeoutsConfig struct {
+	// Git bounds each git command (default 5m)
+	Git string `yaml:"git"`
+	// Docker bounds each docker and docker-compose command (default 10m)
+	Docker string `yaml:"docker"`
+	// Database bounds each database client command, including dumps and
+	// restores (default: no limit)
+	Database string `yaml:"database"`
+	// Proxy bounds registering or removing a proxy route (default 1m)
+	Proxy string `yaml:"proxy"`
+	// Health bounds the wait for containers to become healthy (default 2m)
+	Health string `yaml:"health"`
 }
 
 type DockerConfig struct {
-	Enabled     bool   `yaml:"enabled"`
-	ComposeFile string `yaml:"compose_file"`
-	PortOffset  int    `yaml:"port_offset"`
-	NetworkName string `yaml:"network_name"`
+	Enabled         bool              `yaml:"enabled"`
+	ComposeFile     string            `yaml:"compose_file"`
+	Ports           PortsConfig       `yaml:"ports"`
+	Network         NetworkConfig     `yaml:"network"`
+	ContainerPrefix string            `yaml:"container_prefix"`
+	BuildArgs       map[string]string `yaml:"build_args"`
+}
+
+// PortsConfig sets the range worktree web ports are hashed into
+type PortsConfig struct {
+	RangeStart int `yaml:"range_start"`
+	// RangeEnd is the last usable port; zero leaves the range open
+	RangeEnd int `yaml:"range_end"`
+}
+
+// NetworkConfig names the Docker network worktree containers join
+type NetworkConfig struct {
+	Name string `yaml:"name"`
 }
 
 type WebConfig struct {
-	Enabled          bool   `yaml:"enabled"`
-	ProxyType        string `yaml:"proxy_type"`
-	SubdomainPattern string `yaml:"subdomain_pattern"`
+	Enabled          bool               `yaml:"enabled"`
+	ProxyType        string             `yaml:"proxy_type"`
+	SubdomainPattern string             `yaml:"subdomain_pattern"`
+	UpstreamHost     string             `yaml:"upstream_host"`
+	SSL              SSLConfig          `yaml:"ssl"`
+	Hosts            HostsConfig        `yaml:"hosts"`
+	DNS              DNSConfig          `yaml:"dns"`
+	Traefik          TraefikConfig      `yaml:"traefik"`
+	Caddy            CaddyConfig        `yaml:"caddy"`
+	NginxProxy       NginxProxyConfig   `yaml:"nginx_proxy"`
+	Builtin          BuiltinProxyConfig `yaml:"builtin"`
+}
+
+// SSLConfig configures TLS for worktree subdomains
+type SSLConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Provider is letsencrypt (handled by the proxy), self-signed or mkcert
+	Provider string `yaml:"provider"`
+	Email    string `yaml:"email"`
+	// Wildcard issues one *.domain certificate instead of one per worktree
+	Wildcard bool   `yaml:"wildcard"`
+	CADir    string `yaml:"ca_dir"`
+	CertDir  string `yaml:"cert_dir"`
+}
+
+// HostsConfig configures hosts file entries for worktree subdomains
+type HostsConfig struct {
+	// Mode is auto (only for domains that don't resolve to localhost), always or never
+	Mode    string `yaml:"mode"`
+	File    string `yaml:"file"`
+	Address string `yaml:"address"`
+	// Escalate is the command used to run the privileged helper, e.g. sudo
+	Escalate string `yaml:"escalate"`
+}
+
+// DNSConfig configures the DNS server run by `grove dns`
+type DNSConfig struct {
+	Listen    string `yaml:"listen"`
+	Address   string `yaml:"address"`
+	AddressV6 string `yaml:"address_v6"`
+	TTL       int    `yaml:"ttl"`
+}
+
+// TraefikConfig configures the traefik proxy backend
+type TraefikConfig struct {
+	Network     string   `yaml:"network"`
+	Entrypoint  string   `yaml:"entrypoint"`
+	Middlewares []string `yaml:"middlewares"`
+	// DynamicDir is the directory watched by Traefik's file provider
+	DynamicDir string `yaml:"dynamic_dir"`
+	// Labels exposes compose labels to templates instead of writing files
+	Labels bool `yaml:"labels"`
+	// ContainerPort is the port the web container listens on, used by labels
+	ContainerPort int `yaml:"container_port"`
+}
+
+// CaddyConfig configures the caddy proxy backend
+type CaddyConfig struct {
+	// Mode selects "file" for Caddyfile fragments or "api" for the admin API
+	Mode string `yaml:"mode"`
+	// SitesDir is the directory imported by the main Caddyfile
+	SitesDir      string `yaml:"sites_dir"`
+	ReloadCommand string `yaml:"reload_command"`
+	AdminAddress  string `yaml:"admin_address"`
+	// Server is the admin API HTTP server that receives the routes
+	Server string `yaml:"server"`
+}
+
+// NginxProxyConfig configures the nginx-proxy backend
+type NginxProxyConfig struct {
+	Network string `yaml:"network"`
+	// CustomNginxConf is a template rendered into vhost.d/<host>
+	CustomNginxConf string `yaml:"custom_nginx_conf"`
+	// VhostDir, HtpasswdDir and CertsDir are mounted into the nginx-proxy container
+	VhostDir          string          `yaml:"vhost_dir"`
+	HtpasswdDir       string          `yaml:"htpasswd_dir"`
+	CertsDir          string          `yaml:"certs_dir"`
+	ClientMaxBodySize string          `yaml:"client_max_body_size"`
+	Websockets        bool            `yaml:"websockets"`
+	BasicAuth         BasicAuthConfig `yaml:"basic_auth"`
+	// Service is the compose service attached to the proxy network
+	Service string `yaml:"service"`
+	// Address is where nginx-proxy listens, used to verify routes after up
+	Address string `yaml:"address"`
+}
+
+// BuiltinProxyConfig configures the reverse proxy served by `grove proxy`
+type BuiltinProxyConfig struct {
+	Listen    string `yaml:"listen"`
+	TLSListen string `yaml:"tls_listen"`
+	TLSCert   string `yaml:"tls_cert"`
+	TLSKey    string `yaml:"tls_key"`
+	// RoutesFile is the registry shared between grove and the daemon
+	RoutesFile string `yaml:"routes_file"`
+}
+
+// DatabaseConfig configures the per-worktree database grove provisions
+type DatabaseConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Type is postgres or mysql
+	Type        string `yaml:"type"`
+	Version     string `yaml:"version"`
+	NamePattern string `yaml:"name_pattern"`
+	Host        string `yaml:"host"`
+	Port        int    `yaml:"port"`
+	User        string `yaml:"user"`
+	Password    string `yaml:"password"`
+	// Container is a shared database container clients run in via docker exec
+	Container string `yaml:"container"`
+	// Service is the worktree's own compose service running the database
+	Service string       `yaml:"service"`
+	Seed    SeedConfig   `yaml:"seed"`
+	Backup  BackupConfig `yaml:"backup"`
+}
+
+// BackupConfig configures database dumps taken by `grove db backup` and
+// `grove daemon`
+type BackupConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Schedule is a five-field cron expression run by `grove daemon`
+	Schedule string `yaml:"schedule"`
+	// RetentionDays prunes older backups; zero keeps them all
+	RetentionDays int    `yaml:"retention_days"`
+	Dir           string `yaml:"dir"`
+}
+
+// SeedConfig configures how a fresh worktree database is filled. Sources
+// run in order: the SQL file, the shell command, then the compose service.
+type SeedConfig struct {
+	Enabled  bool   `yaml:"enabled"`
+	OnCreate bool   `yaml:"on_create"`
+	Source   string `yaml:"source"`
+	Command  string `yaml:"command"`
+	// Service is a compose service started with `docker-compose run --rm`
+	Service string `yaml:"service"`
+}
+
+type CacheConfig struct {
+	Redis RedisConfig `yaml:"redis"`
+}
+
+// RedisConfig configures the Redis database index each worktree uses on a
+// shared Redis server
+type RedisConfig struct {
+	Enabled bool   `yaml:"enabled"`
+	Version string `yaml:"version"`
+	// DatabasePattern expands to the worktree's database index
+	DatabasePattern string `yaml:"database_pattern"`
+	// Databases is the server's database count (default 16)
+	Databases int    `yaml:"databases"`
+	Host      string `yaml:"host"`
+	Port      int    `yaml:"port"`
+	// Container is a shared Redis container redis-cli runs in via docker exec
+	Container string `yaml:"container"`
+}
+
+// CleanupConfig controls what is removed along with a worktree
+type CleanupConfig struct {
+	RemoveVolumes bool `yaml:"remove_volumes"`
+	DropDatabase  bool `yaml:"drop_database"`
+	// FlushRedis empties the worktree's Redis database
+	FlushRedis bool `yaml:"flush_redis"`
+}
+
+type BasicAuthConfig struct {
+	User     string `yaml:"user"`
+	Password string `yaml:"password"`
 }
 
 type TemplateConfig struct {
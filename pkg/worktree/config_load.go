@@ -0,0 +1,400 @@
+package worktree
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// sourceDefault marks values grove filled in itself
+	sourceDefault = "default"
+
+	localConfigFile    = "config.local.yaml"
+	worktreeConfigFile = ".grove-worktree.yaml"
+	envPrefix          = "GROVE_"
+)
+
+// Options customizes how a Manager loads its configuration
+type Options struct {
+	// ConfigPath overrides .grove/config.yaml
+	ConfigPath string
+	// Env selects an environments: overlay, overriding the config's default
+	Env string
+	// WorktreeDir is the worktree whose .grove-worktree.yaml applies
+	WorktreeDir string
+}
+
+// defaultConfig returns the values used for anything the config file
+// doesn't set
+func defaultConfig() map[string]interface{} {
+	return map[string]interface{}{
+		"version": CurrentConfigVersion,
+		"project": map[string]interface{}{
+			"name":   "myapp",
+			"domain": "app.lvh.me",
+		},
+		"worktree": map[string]interface{}{
+			"base_path":      "./worktrees",
+			"naming_pattern": "{branch}",
+		},
+		"docker": map[string]interface{}{
+			"enabled":      true,
+			"compose_file": "docker-compose.yml",
+			"ports": map[string]interface{}{
+				"range_start": 10000,
+			},
+			"network": map[string]interface{}{
+				"name": "{project_name}_network",
+			},
+		},
+		"web": map[string]interface{}{
+			"enabled":           true,
+			"proxy_type":        "nginx-proxy",
+			"subdomain_pattern": "{branch}.{project_domain}",
+		},
+	}
+}
+
+// loadConfig merges the config layers over the defaults. From lowest to
+// highest precedence:
+//
+//  1. ~/.config/grove/config.yaml (user)
+//  2. .grove/config.yaml (project)
+//  3. .grove/config.local.yaml (personal, git-ignored)
+//  4. environments.<env> from the files above
+//  5. .grove-worktree.yaml in the current worktree
+//  6. GROVE_* environment variables
+func (m *Manager) loadConfig() error {
+	raw := make(map[string]interface{})
+	sources := make(map[string]string)
+	mergeConfig(raw, defaultConfig(), "", sourceDefault, sources)
+
+	files := []string{
+		userConfigPath(),
+		m.ConfigPath,
+		filepath.Join(filepath.Dir(m.ConfigPath), localConfigFile),
+	}
+	for _, path := range files {
+		if path == "" {
+			continue
+		}
+		values, err := readConfigFile(path)
+		if err != nil {
+			return err
+		}
+		mergeConfig(raw, values, "", m.relPath(path), sources)
+	}
+
+	var worktree map[string]interface{}
+	var worktreeSource string
+	if m.worktreeDir != "" {
+		path := filepath.Join(m.worktreeDir, worktreeConfigFile)
+		values, err := readConfigFile(path)
+		if err != nil {
+			return err
+		}
+		worktree, worktreeSource = values, m.relPath(path)
+	}
+
+	env := m.Env
+	for _, layer := range []map[string]interface{}{envVarValues(), worktree, raw} {
+		if env == "" {
+			env, _ = layer["environment"].(string)
+		}
+	}
+	if env != "" {
+		if err := applyEnvironment(raw, env, sources); err != nil {
+			return err
+		}
+	}
+
+	mergeConfig(raw, worktree, "", worktreeSource, sources)
+	for _, v := range envVars() {
+		setConfigValue(raw, v.path, v.value)
+		dropSources(sources, strings.Join(v.path, "."))
+		sources[strings.Join(v.path, ".")] = v.name
+	}
+
+	config, err := decodeConfig(raw)
+	if err != nil {
+		return err
+	}
+	if err := config.Validate(); err != nil {
+		return err
+	}
+
+	m.Env = env
+	m.Config = config
+	m.sources = sources
+	return nil
+}
+
+// userConfigPath returns the per-user config file, honouring XDG_CONFIG_HOME
+func userConfigPath() string {
+	if dir := os.Getenv("XDG_CONFIG_HOME"); dir != "" {
+		return filepath.Join(dir, "grove", "config.yaml")
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".config", "grove", "config.yaml")
+}
+
+// readConfigFile parses a config layer, migrating it to the current version;
+// a missing file is an empty layer
+func readConfigFile(path string) (map[string]interface{}, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	// Older files are upgraded in memory; `grove config migrate` rewrites them
+	if _, err := migrateConfig(&doc, path); err != nil {
+		return nil, err
+	}
+
+	var values map[string]interface{}
+	if err := doc.Decode(&values); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	return values, nil
+}
+
+// envVar is a config override from the environment
+type envVar struct {
+	name  string
+	path  []string
+	value interface{}
+}
+
+// envVars returns the GROVE_* variables that override config keys, sorted
+// by name. Nested keys are separated by a double underscore, so
+// GROVE_DOCKER__PORTS__RANGE_START sets docker.ports.range_start. Values are parsed as
+// YAML scalars.
+func envVars() []envVar {
+	sections := configSections()
+
+	var vars []envVar
+	for _, kv := range os.Environ() {
+		name, value, _ := strings.Cut(kv, "=")
+		if !strings.HasPrefix(name, envPrefix) {
+			continue
+		}
+
+		// Hooks export their context and variables as single-word GROVE_*
+		// names, such as GROVE_ENVIRONMENT, so only the nested
+		// GROVE_SECTION__KEY form is config
+		path := strings.Split(strings.ToLower(strings.TrimPrefix(name, envPrefix)), "__")
+		if len(path) < 2 || !sections[path[0]] || containsEmpty(path) {
+			continue
+		}
+
+		var parsed interface{} = value
+		if err := yaml.Unmarshal([]byte(value), &parsed); err != nil || parsed == nil {
+			parsed = value
+		}
+		vars = append(vars, envVar{name: name, path: path, value: parsed})
+	}
+
+	sort.Slice(vars, func(i, j int) bool { return vars[i].name < vars[j].name })
+	return vars
+}
+
+// envVarValues returns the GROVE_* overrides as a config layer
+func envVarValues() map[string]interface{} {
+	values := make(map[string]interface{})
+	for _, v := range envVars() {
+		setConfigValue(values, v.path, v.value)
+	}
+	return values
+}
+
+// configSections returns the top-level config keys
+func configSections() map[string]bool {
+	sections := make(map[string]bool)
+	t := reflect.TypeOf(Config{})
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("yaml"), ",")
+		sections[name] = true
+	}
+	return sections
+}
+
+func containsEmpty(path []string) bool {
+	for _, key := range path {
+		if key == "" {
+			return true
+		}
+	}
+	return false
+}
+
+// setConfigValue sets the value at path, creating mappings along the way
+func setConfigValue(raw map[string]interface{}, path []string, value interface{}) {
+	for _, key := range path[:len(path)-1] {
+		next, ok := raw[key].(map[string]interface{})
+		if !ok {
+			next = make(map[string]interface{})
+			raw[key] = next
+		}
+		raw = next
+	}
+	raw[path[len(path)-1]] = value
+}
+
+// applyEnvironment merges environments.<env> onto raw, after switching the
+// project domain to project.domains.<env> when one is listed
+func applyEnvironment(raw map[string]interface{}, env string, sources map[string]string) error {
+	environments, _ := raw["environments"].(map[string]interface{})
+	project, _ := raw["project"].(map[string]interface{})
+	domains, _ := project["domains"].(map[string]interface{})
+
+	overlay, hasOverlay := environments[env]
+	domain, hasDomain := domains[env]
+	if !hasOverlay && !hasDomain {
+		return fmt.Errorf("unknown environment '%s'", env)
+	}
+
+	if hasDomain {
+		project["domain"] = domain
+		sources["project.domain"] = "project.domains." + env
+	}
+
+	if overlay == nil {
+		return nil
+	}
+	values, ok := overlay.(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("environments.%s must be a mapping", env)
+	}
+	mergeConfig(raw, values, "", "environments."+env, sources)
+	return nil
+}
+
+// mergeConfig deep-merges src into dst, recording source for every value it
+// sets. Mappings merge key by key; anything else replaces the old value.
+func mergeConfig(dst, src map[string]interface{}, prefix, source string, sources map[string]string) {
+	for key, value := range src {
+		path := key
+		if prefix != "" {
+			path = prefix + "." + key
+		}
+
+		if values, ok := value.(map[string]interface{}); ok {
+			existing, ok := dst[key].(map[string]interface{})
+			if !ok {
+				dropSources(sources, path)
+				existing = make(map[string]interface{})
+				dst[key] = existing
+			}
+			mergeConfig(existing, values, path, source, sources)
+			continue
+		}
+
+		dropSources(sources, path)
+		dst[key] = value
+		sources[path] = source
+	}
+}
+
+// dropSources forgets the sources recorded under a replaced value
+func dropSources(sources map[string]string, path string) {
+	for key := range sources {
+		if key == path || strings.HasPrefix(key, path+".") {
+			delete(sources, key)
+		}
+	}
+}
+
+// decodeConfig converts the merged values into a Config
+func decodeConfig(raw map[string]interface{}) (*Config, error) {
+	data, err := yaml.Marshal(raw)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode config: %w", err)
+	}
+
+	var config Config
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+	if config.Variables == nil {
+		config.Variables = make(map[string]interface{})
+	}
+	return &config, nil
+}
+
+// ConfigSource returns where the effective value of a dotted config key came
+// from: "default", a config file, an environment overlay or a GROVE_*
+// variable
+func (m *Manager) ConfigSource(key string) string {
+	if source, ok := m.sources[key]; ok {
+		return source
+	}
+	return sourceDefault
+}
+
+// EffectiveConfig renders the merged configuration as YAML, annotating each
+// value with its source. The overlays themselves are left out.
+func (m *Manager) EffectiveConfig() ([]byte, error) {
+	var doc yaml.Node
+	if err := doc.Encode(m.Config); err != nil {
+		return nil, fmt.Errorf("failed to encode config: %w", err)
+	}
+	m.annotateSources(&doc, "")
+
+	data, err := yaml.Marshal(&doc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode config: %w", err)
+	}
+	return data, nil
+}
+
+func (m *Manager) annotateSources(node *yaml.Node, prefix string) {
+	if node.Kind != yaml.MappingNode {
+		return
+	}
+
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := node.Content[i], node.Content[i+1]
+		path := key.Value
+		if prefix != "" {
+			path = prefix + "." + key.Value
+		}
+		if path == "environments" {
+			node.Content = append(node.Content[:i], node.Content[i+2:]...)
+			i -= 2
+			continue
+		}
+
+		switch value.Kind {
+		case yaml.MappingNode:
+			m.annotateSources(value, path)
+		case yaml.ScalarNode:
+			value.LineComment = m.ConfigSource(path)
+		default:
+			key.LineComment = m.ConfigSource(path)
+		}
+	}
+}
+
+// relPath returns path relative to the project root when it lies inside it
+func (m *Manager) relPath(path string) string {
+	if rel, err := filepath.Rel(m.BaseDir, path); err == nil && !strings.HasPrefix(rel, "..") {
+		return rel
+	}
+	return path
+}
@@ -0,0 +1,288 @@
+package worktree
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const overlayConfig = `
+project:
+  name: shop
+  domain: shop.lvh.me
+  domains:
+    preview: preview.shop.dev
+docker:
+  build_args:
+    NODE_ENV: development
+    DEBUG: "1"
+variables:
+  log_level: debug
+  app_port: 3000
+environment: development
+environments:
+  development:
+    variables:
+      debug: true
+  staging:
+    project:
+      domain: staging.shop.dev
+    docker:
+      build_args:
+        NODE_ENV: production
+    variables:
+      log_level: info
+`
+
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, ".grove"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, ".grove", "config.yaml"), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestManager_loadConfig_environments(t *testing.T) {
+	dir := writeConfig(t, overlayConfig)
+
+	tests := []struct {
+		env        string
+		wantEnv    string
+		wantDomain string
+		wantSource string
+		wantArgs   map[string]string
+		wantLevel  string
+	}{
+		{
+			env:        "",
+			wantEnv:    "development",
+			wantDomain: "shop.lvh.me",
+			wantSource: ".grove/config.yaml",
+			wantArgs:   map[string]string{"NODE_ENV": "development", "DEBUG": "1"},
+			wantLevel:  "debug",
+		},
+		{
+			env:        "staging",
+			wantEnv:    "staging",
+			wantDomain: "staging.shop.dev",
+			wantSource: "environments.staging",
+			wantArgs:   map[string]string{"NODE_ENV": "production", "DEBUG": "1"},
+			wantLevel:  "info",
+		},
+		{
+			env:        "preview",
+			wantEnv:    "preview",
+			wantDomain: "preview.shop.dev",
+			wantSource: "project.domains.preview",
+			wantArgs:   map[string]string{"NODE_ENV": "development", "DEBUG": "1"},
+			wantLevel:  "debug",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.wantEnv, func(t *testing.T) {
+			m, err := NewManagerWithOptions(dir, Options{Env: tt.env})
+			if err != nil {
+				t.Fatalf("NewManagerWithOptions() error = %v", err)
+			}
+
+			if m.Env != tt.wantEnv {
+				t.Errorf("Env = %q, want %q", m.Env, tt.wantEnv)
+			}
+			if m.Config.Project.Domain != tt.wantDomain {
+				t.Errorf("Project.Domain = %q, want %q", m.Config.Project.Domain, tt.wantDomain)
+			}
+			if got := m.ConfigSource("project.domain"); got != tt.wantSource {
+				t.Errorf("ConfigSource(project.domain) = %q, want %q", got, tt.wantSource)
+			}
+			for k, v := range tt.wantArgs {
+				if got := m.Config.Docker.BuildArgs[k]; got != v {
+					t.Errorf("BuildArgs[%s] = %q, want %q", k, got, v)
+				}
+			}
+			if got := m.Config.Variables["log_level"]; got != tt.wantLevel {
+				t.Errorf("Variables[log_level] = %v, want %q", got, tt.wantLevel)
+			}
+			// Values the overlay doesn't touch survive the merge
+			if got := m.Config.Variables["app_port"]; got != 3000 {
+				t.Errorf("Variables[app_port] = %v, want 3000", got)
+			}
+			if got := m.ConfigSource("docker.compose_file"); got != sourceDefault {
+				t.Errorf("ConfigSource(docker.compose_file) = %q, want %q", got, sourceDefault)
+			}
+		})
+	}
+}
+
+func TestManager_loadConfig_unknownEnvironment(t *testing.T) {
+	dir := writeConfig(t, overlayConfig)
+
+	if _, err := NewManagerWithOptions(dir, Options{Env: "production"}); err == nil {
+		t.Error("expected an error for an undefined environment")
+	}
+}
+
+func TestManager_loadConfig_invalid(t *testing.T) {
+	dir := writeConfig(t, "worktree:\n  naming_pattern: \"{nope}\"\n")
+
+	if _, err := NewManager(dir); err == nil {
+		t.Error("expected an error for an unknown placeholder")
+	}
+}
+
+func TestManager_loadConfig_examples(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join("..", "..", "examples", "configs", "*.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, file := range files {
+		t.Run(filepath.Base(file), func(t *testing.T) {
+			abs, err := filepath.Abs(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := NewManagerWithOptions(t.TempDir(), Options{ConfigPath: abs}); err != nil {
+				t.Errorf("failed to load %s: %v", file, err)
+			}
+		})
+	}
+}
+
+func TestManager_EffectiveConfig(t *testing.T) {
+	dir := writeConfig(t, overlayConfig)
+
+	m, err := NewManagerWithOptions(dir, Options{Env: "staging"})
+	if err != nil {
+		t.Fatalf("NewManagerWithOptions() error = %v", err)
+	}
+
+	out, err := m.EffectiveConfig()
+	if err != nil {
+		t.Fatalf("EffectiveConfig() error = %v", err)
+	}
+
+	for _, want := range []string{
+		"domain: staging.shop.dev # environments.staging",
+		"name: shop # .grove/config.yaml",
+		"compose_file: docker-compose.yml # default",
+	} {
+		if !strings.Contains(string(out), want) {
+			t.Errorf("EffectiveConfig() missing %q:\n%s", want, out)
+		}
+	}
+	if strings.Contains(string(out), "environments:") {
+		t.Errorf("EffectiveConfig() should leave out the overlays:\n%s", out)
+	}
+}
+
+func TestManager_loadConfig_layers(t *testing.T) {
+	dir := writeConfig(t, overlayConfig)
+
+	userDir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", userDir)
+	layers := map[string]string{
+		filepath.Join(userDir, "grove", "config.yaml"): `
+project:
+  name: mine
+  domain: me.lvh.me
+worktree:
+  base_path: ./trees
+docker:
+  ports:
+    range_start: 20000
+`,
+		filepath.Join(dir, ".grove", "config.local.yaml"): `
+project:
+  domain: local.lvh.me
+variables:
+  log_level: trace
+`,
+		filepath.Join(dir, "trees", "feature", ".grove-worktree.yaml"): `
+environment: staging
+variables:
+  app_port: 3100
+`,
+	}
+	for path, content := range layers {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("GROVE_DOCKER__PORTS__RANGE_START", "30000")
+	t.Setenv("GROVE_VARIABLES__LOG_LEVEL", "warn")
+	// Hook context variables aren't config keys and are ignored
+	t.Setenv("GROVE_BRANCH_NAME", "feature")
+
+	m, err := NewManagerWithOptions(dir, Options{WorktreeDir: filepath.Join(dir, "trees", "feature")})
+	if err != nil {
+		t.Fatalf("NewManagerWithOptions() error = %v", err)
+	}
+
+	tests := []struct {
+		key        string
+		got        interface{}
+		want       interface{}
+		wantSource string
+	}{
+		// The user layer is overridden by the project file
+		{"project.name", m.Config.Project.Name, "shop", ".grove/config.yaml"},
+		{"worktree.base_path", m.Config.Worktree.BasePath, "./trees", filepath.Join(userDir, "grove", "config.yaml")},
+		// The worktree file selects staging, whose overlay beats config.local.yaml
+		{"project.domain", m.Config.Project.Domain, "staging.shop.dev", "environments.staging"},
+		{"variables.app_port", m.Config.Variables["app_port"], 3100, filepath.Join("trees", "feature", ".grove-worktree.yaml")},
+		{"docker.ports.range_start", m.Config.Docker.Ports.RangeStart, 30000, "GROVE_DOCKER__PORTS__RANGE_START"},
+		{"variables.log_level", m.Config.Variables["log_level"], "warn", "GROVE_VARIABLES__LOG_LEVEL"},
+	}
+
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%s = %v, want %v", tt.key, tt.got, tt.want)
+		}
+		if got := m.ConfigSource(tt.key); got != tt.wantSource {
+			t.Errorf("ConfigSource(%s) = %q, want %q", tt.key, got, tt.wantSource)
+		}
+	}
+	if m.Env != "staging" {
+		t.Errorf("Env = %q, want staging", m.Env)
+	}
+}
+
+func TestManager_loadConfig_hookEnv(t *testing.T) {
+	dir := writeConfig(t, `environments:
+  production:
+    project:
+      domain: shop.example
+`)
+
+	// A grove command run from a hook inherits the hook's environment
+	vars := map[string]interface{}{
+		"Environment": "production",
+		"version":     1,
+		"cleanup":     "weekly",
+		"web__proxy":  "caddy",
+	}
+	for _, kv := range hookEnv(HookPostCreate, dir, vars) {
+		name, value, _ := strings.Cut(kv, "=")
+		t.Setenv(name, value)
+	}
+
+	m, err := NewManager(dir)
+	if err != nil {
+		t.Fatalf("NewManager() error = %v", err)
+	}
+	if m.Env != "" || m.Config.Project.Domain != "app.lvh.me" {
+		t.Errorf("Env = %q, domain = %s; hook variables selected an environment", m.Env, m.Config.Project.Domain)
+	}
+	if m.Config.Version != CurrentConfigVersion || m.Config.Web.ProxyType != "nginx-proxy" {
+		t.Errorf("Version = %d, proxy = %s; hook variables overrode the config", m.Config.Version, m.Config.Web.ProxyType)
+	}
+}
@@ -2,7 +2,6 @@ package worktree
 
 import (
 	"reflect"
-	"strings"
 	"testing"
 )
 
@@ -27,8 +26,8 @@ func TestConfig_Validate(t *testing.T) {
 				Docker: DockerConfig{
 					Enabled:     true,
 					ComposeFile: "docker-compose.yml",
-					PortOffset:  10000,
-					NetworkName: "{project_name}_network",
+					Ports:       PortsConfig{RangeStart: 10000},
+					Network:     NetworkConfig{Name: "{project_name}_network"},
 				},
 				Web: WebConfig{
 					Enabled:          true,
@@ -59,16 +58,50 @@ func TestConfig_Validate(t *testing.T) {
 					Domain: "app.test",
 				},
 			},
-			wantErr: false, // We'll implement validation later
+			wantErr: false,
+		},
+		{
+			name: "unknown placeholder",
+			config: &Config{
+				Web: WebConfig{SubdomainPattern: "{branch}.{domain}"},
+			},
+			wantErr: true,
+		},
+		{
+			name: "naming pattern with path separator",
+			config: &Config{
+				Worktree: WorktreeConfig{NamingPattern: "{user}/{branch}"},
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid ticket pattern",
+			config: &Config{
+				Worktree: WorktreeConfig{TicketPattern: "[A-Z"},
+			},
+			wantErr: true,
+		},
+		{
+			name: "step timeouts",
+			config: &Config{
+				Timeouts: TimeoutsConfig{Git: "30s", Docker: "0", Health: "5m"},
+			},
+			wantErr: false,
+		},
+		{
+			name: "invalid step timeout",
+			config: &Config{
+				Timeouts: TimeoutsConfig{Docker: "ten minutes"},
+			},
+			wantErr: true,
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			// For now, we don't have validation implemented
-			// This is a placeholder for future validation logic
-			if tt.config == nil {
-				t.Error("Config should not be nil")
+			err := tt.config.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
 			}
 		})
 	}
@@ -243,24 +276,18 @@ func TestWebConfig_GetSubdomain(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			// This would be implemented in the actual subdomain generation logic
-			pattern := config.SubdomainPattern
-			pattern = replacePattern(pattern, "{branch}", tt.branchName)
-			pattern = replacePattern(pattern, "{project_domain}", tt.projectDomain)
+			manager := &Manager{Config: &Config{
+				Project: ProjectConfig{Domain: tt.projectDomain},
+				Web:     config,
+			}}
 
-			if pattern != tt.want {
-				t.Errorf("Subdomain = %v, want %v", pattern, tt.want)
+			if got := manager.subdomain(tt.branchName); got != tt.want {
+				t.Errorf("Subdomain = %v, want %v", got, tt.want)
 			}
 		})
 	}
 }
 
-// Helper function for pattern replacement (would be in utils)
-func replacePattern(pattern, placeholder, value string) string {
-	// Simple string replacement - in real implementation might use text/template
-	return strings.ReplaceAll(pattern, placeholder, value)
-}
-
 // Example of a more complex helper function that could be added to config.go
 func (c *Config) GetEffectiveTemplate(templateName string) (*TemplateDefinition, bool) {
 	if templateName == "" {
@@ -0,0 +1,450 @@
+package worktree
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/glanotte/grove/pkg/runner"
+)
+
+const defaultDatabaseNamePattern = "{project_name}_{branch}"
+
+// DatabaseDriver provisions worktree databases on a database server
+type DatabaseDriver interface {
+	CreateDatabase(name string) error
+	DropDatabase(name string) error
+	DatabaseExists(name string) (bool, error)
+	// CloneDatabase creates dst as a copy of src
+	CloneDatabase(src, dst string) error
+	// ImportSQL runs a SQL script against a database
+	ImportSQL(name string, script io.Reader) error
+	// DumpDatabase writes a SQL dump of a database to w
+	DumpDatabase(name string, w io.Writer) error
+	// URL returns the connection URL applications use for a database
+	URL(name string) string
+}
+
+// commandRunner runs a database client command, feeding it stdin. Output is
+// streamed to stdout when it is set, and returned otherwise.
+type commandRunner func(stdin io.Reader, stdout io.Writer, args ...string) ([]byte, error)
+
+// sqlDriver drives postgres and mysql through their command-line clients
+type sqlDriver struct {
+	kind string
+	cfg  DatabaseConfig
+	run  commandRunner
+}
+
+// database returns the driver for the worktree's database, running its
+// commands under ctx
+func (m *Manager) database(ctx context.Context, worktreePath string) (DatabaseDriver, error) {
+	if m.dbDriver != nil {
+		return m.dbDriver, nil
+	}
+
+	switch m.Config.Database.Type {
+	case "postgres", "postgresql":
+		return &sqlDriver{kind: "postgres", cfg: m.Config.Database, run: m.databaseRunner(ctx, worktreePath)}, nil
+	case "mysql", "mariadb":
+		return &sqlDriver{kind: "mysql", cfg: m.Config.Database, run: m.databaseRunner(ctx, worktreePath)}, nil
+	default:
+		return nil, fmt.Errorf("unsupported database type '%s'", m.Config.Database.Type)
+	}
+}
+
+// databaseRunner runs clients inside the shared container, the worktree's
+// compose service, or locally against host and port
+func (m *Manager) databaseRunner(ctx context.Context, worktreePath string) commandRunner {
+	cfg := m.Config.Database
+
+	return func(stdin io.Reader, stdout io.Writer, args ...string) ([]byte, error) {
+		env := databaseEnv(cfg)
+
+		var cmd runner.Cmd
+		switch {
+		case cfg.Container != "":
+			execArgs := append([]string{"exec", "-i"}, forwardEnv(env)...)
+			cmd = runner.Command("docker", append(append(execArgs, cfg.Container), args...)...)
+		case cfg.Service != "":
+			execArgs := append([]string{"exec", "-T"}, forwardEnv(env)...)
+			cmd = m.compose(worktreePath, append(append(execArgs, cfg.Service), args...)...)
+		default:
+			cmd = runner.Command(args[0], args[1:]...)
+		}
+
+		cmd.Env = env
+		cmd.Stdin = stdin
+		cmd.Stdout = stdout
+		result, err := m.runStep(ctx, stepDatabase, cmd)
+		if err != nil {
+			return result.Stdout, fmt.Errorf("%s failed: %w", args[0], err)
+		}
+		return result.Stdout, nil
+	}
+}
+
+// databaseEnv passes the password to clients through the environment, as
+// arguments are visible to other users in ps
+func databaseEnv(cfg DatabaseConfig) []string {
+	if cfg.Password == "" {
+		return nil
+	}
+	if cfg.Type == "mysql" || cfg.Type == "mariadb" {
+		return []string{"MYSQL_PWD=" + cfg.Password}
+	}
+	return []string{"PGPASSWORD=" + cfg.Password}
+}
+
+// forwardEnv returns the docker exec flags passing the named variables on
+// from grove's environment, keeping their values off the command line
+func forwardEnv(env []string) []string {
+	var args []string
+	for _, e := range env {
+		name, _, _ := strings.Cut(e, "=")
+		args = append(args, "-e", name)
+	}
+	return args
+}
+
+// databaseName returns the name of a branch's database
+func (m *Manager) databaseName(branchName string) string {
+	pattern := m.Config.Database.NamePattern
+	if pattern == "" {
+		pattern = defaultDatabaseNamePattern
+	}
+
+	// Dashes need quoting in SQL identifiers, so use underscores instead
+	name := strings.ReplaceAll(m.expand(pattern, branchName), "-", "_")
+	if len(name) > maxLabelLength {
+		name = strings.ReplaceAll(withHashSuffix(name, branchName), "-", "_")
+	}
+	return name
+}
+
+// provisionDatabase creates the branch's database if it doesn't exist yet,
+// seeding it when configured. Dropping a database it creates is added to
+// undo, if given.
+func (m *Manager) provisionDatabase(ctx context.Context, undo *rollback, worktreePath, branchName string) error {
+	driver, err := m.database(ctx, worktreePath)
+	if err != nil {
+		return err
+	}
+
+	name := m.databaseName(branchName)
+	exists, err := driver.DatabaseExists(name)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return nil
+	}
+
+	undo.add("drop database "+name, func(ctx context.Context) error {
+		return m.dropDatabase(ctx, worktreePath, branchName)
+	})
+	if err := driver.CreateDatabase(name); err != nil {
+		return err
+	}
+	fmt.Printf("Created database %s\n", name)
+
+	if seed := m.Config.Database.Seed; seed.Enabled && seed.OnCreate {
+		return m.seedDatabase(ctx, worktreePath, branchName)
+	}
+	return nil
+}
+
+// dropDatabase drops the branch's database
+func (m *Manager) dropDatabase(ctx context.Context, worktreePath, branchName string) error {
+	driver, err := m.database(ctx, worktreePath)
+	if err != nil {
+		return err
+	}
+
+	name := m.databaseName(branchName)
+	if err := driver.DropDatabase(name); err != nil {
+		return err
+	}
+	fmt.Printf("Dropped database %s\n", name)
+	return nil
+}
+
+// CloneDatabase copies the database of the src worktree into dst's. An
+// existing destination database is only replaced when replace is set.
+func (m *Manager) CloneDatabase(src, dst string, replace bool) error {
+	return m.CloneDatabaseContext(context.Background(), src, dst, replace)
+}
+
+// CloneDatabaseContext is CloneDatabase with a context
+func (m *Manager) CloneDatabaseContext(ctx context.Context, src, dst string, replace bool) error {
+	release, err := m.lock(ctx, true)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	if !m.Config.Database.Enabled {
+		return fmt.Errorf("databases are not enabled in the grove config")
+	}
+
+	srcWt, err := m.findWorktree(ctx, src)
+	if err != nil {
+		return err
+	}
+	dstWt, err := m.findWorktree(ctx, dst)
+	if err != nil {
+		return err
+	}
+
+	return m.cloneDatabase(ctx, nil, srcWt, dstWt.Path, worktreeBranch(dstWt), replace)
+}
+
+// cloneDatabase fills branchName's database from the src worktree's. Dropping
+// the copy is added to undo, if given.
+func (m *Manager) cloneDatabase(ctx context.Context, undo *rollback, src WorktreeInfo, worktreePath, branchName string, replace bool) error {
+	if m.Config.Database.Service != "" {
+		return fmt.Errorf("cloning needs a shared database server, but each worktree runs its own '%s' service", m.Config.Database.Service)
+	}
+
+	driver, err := m.database(ctx, worktreePath)
+	if err != nil {
+		return err
+	}
+
+	srcName := m.databaseName(worktreeBranch(src))
+	dstName := m.databaseName(branchName)
+	if srcName == dstName {
+		return fmt.Errorf("source and destination are the same database (%s)", srcName)
+	}
+
+	exists, err := driver.DatabaseExists(srcName)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("source database %s does not exist", srcName)
+	}
+
+	exists, err = driver.DatabaseExists(dstName)
+	if err != nil {
+		return err
+	}
+	if exists {
+		if !replace {
+			return fmt.Errorf("database %s already exists (use --force to replace it)", dstName)
+		}
+		if err := driver.DropDatabase(dstName); err != nil {
+			return err
+		}
+	}
+
+	undo.add("drop database "+dstName, func(ctx context.Context) error {
+		return m.dropDatabase(ctx, worktreePath, branchName)
+	})
+	if err := driver.CloneDatabase(srcName, dstName); err != nil {
+		return err
+	}
+	fmt.Printf("Cloned database %s into %s\n", srcName, dstName)
+	return nil
+}
+
+// client returns the command line for the database client connected to
+// database, or to the server's default database when empty
+func (d *sqlDriver) client(database string, extra ...string) []string {
+	var args []string
+	if d.kind == "postgres" {
+		if database == "" {
+			database = "postgres"
+		}
+		args = []string{"psql", "-v", "ON_ERROR_STOP=1", "-X", "-q"}
+		if d.local() {
+			args = append(args, "-h", d.host(), "-p", strconv.Itoa(d.port()))
+		}
+		args = append(args, "-U", d.user(), "-d", database)
+	} else {
+		args = []string{"mysql", "--batch", "--skip-column-names"}
+		if d.local() {
+			args = append(args, "-h", d.host(), "-P", strconv.Itoa(d.port()))
+		}
+		args = append(args, "-u", d.user())
+		if database != "" {
+			args = append(args, database)
+		}
+	}
+	return append(args, extra...)
+}
+
+// exec runs a single SQL statement
+func (d *sqlDriver) exec(statement string) ([]byte, error) {
+	if d.kind == "postgres" {
+		return d.run(nil, nil, d.client("", "-tA", "-c", statement)...)
+	}
+	return d.run(nil, nil, d.client("", "-e", statement)...)
+}
+
+func (d *sqlDriver) CreateDatabase(name string) error {
+	_, err := d.exec("CREATE DATABASE " + d.quote(name))
+	if err != nil {
+		return fmt.Errorf("failed to create database %s: %w", name, err)
+	}
+	return nil
+}
+
+func (d *sqlDriver) DropDatabase(name string) error {
+	_, err := d.exec("DROP DATABASE IF EXISTS " + d.quote(name))
+	if err != nil {
+		return fmt.Errorf("failed to drop database %s: %w", name, err)
+	}
+	return nil
+}
+
+func (d *sqlDriver) DatabaseExists(name string) (bool, error) {
+	query := "SELECT 1 FROM pg_database WHERE datname = " + quoteLiteral(name)
+	if d.kind == "mysql" {
+		query = "SELECT 1 FROM information_schema.schemata WHERE schema_name = " + quoteLiteral(name)
+	}
+
+	output, err := d.exec(query)
+	if err != nil {
+		return false, fmt.Errorf("failed to look up database %s: %w", name, err)
+	}
+	return strings.TrimSpace(string(output)) == "1", nil
+}
+
+func (d *sqlDriver) CloneDatabase(src, dst string) error {
+	if d.kind == "postgres" {
+		// TEMPLATE copies at the file level, but needs src to have no other
+		// connections while it runs
+		_, err := d.exec("CREATE DATABASE " + d.quote(dst) + " TEMPLATE " + d.quote(src))
+		if err != nil {
+			return fmt.Errorf("failed to clone database %s into %s (stop connections to %s first): %w", src, dst, src, err)
+		}
+		return nil
+	}
+
+	if err := d.CreateDatabase(dst); err != nil {
+		return err
+	}
+
+	// Pipe the dump straight into the client rather than holding it in memory
+	pr, pw := io.Pipe()
+	dumped := make(chan error, 1)
+	go func() {
+		_, err := d.run(nil, pw, d.dumpCommand(src)...)
+		pw.CloseWithError(err)
+		dumped <- err
+	}()
+	_, restoreErr := d.run(pr, nil, d.client(dst)...)
+	// Let the dump finish if the client stopped reading early
+	io.Copy(io.Discard, pr)
+	dumpErr := <-dumped
+
+	if dumpErr == nil && restoreErr == nil {
+		return nil
+	}
+	d.DropDatabase(dst)
+	if dumpErr != nil {
+		return fmt.Errorf("failed to dump database %s: %w", src, dumpErr)
+	}
+	return fmt.Errorf("failed to restore %s into %s: %w", src, dst, restoreErr)
+}
+
+func (d *sqlDriver) ImportSQL(name string, script io.Reader) error {
+	if _, err := d.run(script, nil, d.client(name)...); err != nil {
+		return fmt.Errorf("failed to import into %s: %w", name, err)
+	}
+	return nil
+}
+
+func (d *sqlDriver) DumpDatabase(name string, w io.Writer) error {
+	if _, err := d.run(nil, w, d.dumpCommand(name)...); err != nil {
+		return fmt.Errorf("failed to dump database %s: %w", name, err)
+	}
+	return nil
+}
+
+// dumpCommand returns the command line dumping a database as plain SQL
+func (d *sqlDriver) dumpCommand(name string) []string {
+	if d.kind == "postgres" {
+		args := []string{"pg_dump", "--no-owner", "--no-privileges"}
+		if d.local() {
+			args = append(args, "-h", d.host(), "-p", strconv.Itoa(d.port()))
+		}
+		return append(args, "-U", d.user(), name)
+	}
+
+	args := []string{"mysqldump", "--single-transaction", "--routines", "--triggers"}
+	if d.local() {
+		args = append(args, "-h", d.host(), "-P", strconv.Itoa(d.port()))
+	}
+	return append(args, "-u", d.user(), name)
+}
+
+func (d *sqlDriver) URL(name string) string {
+	u := url.URL{
+		Scheme: d.kind,
+		Host:   d.host() + ":" + strconv.Itoa(d.port()),
+		Path:   "/" + name,
+	}
+	if d.cfg.Password != "" {
+		u.User = url.UserPassword(d.user(), d.cfg.Password)
+	} else {
+		u.User = url.User(d.user())
+	}
+	return u.String()
+}
+
+// local reports whether the client connects over the network rather than
+// running next to the server
+func (d *sqlDriver) local() bool {
+	return d.cfg.Container == "" && d.cfg.Service == ""
+}
+
+// host is where applications reach the server: the configured host, or the
+// container or service name on the Docker network
+func (d *sqlDriver) host() string {
+	switch {
+	case d.cfg.Host != "":
+		return d.cfg.Host
+	case d.cfg.Container != "":
+		return d.cfg.Container
+	case d.cfg.Service != "":
+		return d.cfg.Service
+	}
+	return "localhost"
+}
+
+func (d *sqlDriver) port() int {
+	switch {
+	case d.cfg.Port != 0:
+		return d.cfg.Port
+	case d.kind == "mysql":
+		return 3306
+	}
+	return 5432
+}
+
+func (d *sqlDriver) user() string {
+	switch {
+	case d.cfg.User != "":
+		return d.cfg.User
+	case d.kind == "mysql":
+		return "root"
+	}
+	return "postgres"
+}
+
+// quote quotes an identifier for the driver's SQL dialect
+func (d *sqlDriver) quote(name string) string {
+	if d.kind == "mysql" {
+		return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+	}
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+func quoteLiteral(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
@@ -0,0 +1,345 @@
+package worktree
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultDNSListen  = "127.0.0.1:5353"
+	defaultDNSAddress = "127.0.0.1"
+	defaultDNSTTL     = 5
+
+	dnsTypeA    = 1
+	dnsTypeAAAA = 28
+	dnsClassIN  = 1
+
+	dnsRcodeSuccess  = 0
+	dnsRcodeFormErr  = 1
+	dnsRcodeNXDomain = 3
+	dnsRcodeNotImp   = 4
+	dnsRcodeRefused  = 5
+
+	// hostsCacheTTL bounds how often the worktree list is re-read
+	hostsCacheTTL = 2 * time.Second
+)
+
+// DNSServer answers A/AAAA queries for worktree subdomains
+type DNSServer struct {
+	Zone  string
+	IPv4  net.IP
+	IPv6  net.IP
+	TTL   uint32
+	Hosts func() ([]string, error)
+
+	mu       sync.Mutex
+	cached   map[string]bool
+	cachedAt time.Time
+}
+
+// NewDNSServer creates a DNS server for the project's worktree subdomains
+func (m *Manager) NewDNSServer() (*DNSServer, error) {
+	cfg := m.Config.Web.DNS
+
+	address := cfg.Address
+	if address == "" {
+		address = defaultDNSAddress
+	}
+	ipv4 := net.ParseIP(address).To4()
+	if ipv4 == nil {
+		return nil, fmt.Errorf("invalid dns address '%s'", address)
+	}
+
+	var ipv6 net.IP
+	if cfg.AddressV6 != "" {
+		if ipv6 = net.ParseIP(cfg.AddressV6); ipv6 == nil || ipv6.To4() != nil {
+			return nil, fmt.Errorf("invalid dns address_v6 '%s'", cfg.AddressV6)
+		}
+	}
+
+	ttl := uint32(defaultDNSTTL)
+	if cfg.TTL > 0 {
+		ttl = uint32(cfg.TTL)
+	}
+
+	return &DNSServer{
+		Zone:  m.dnsZone(),
+		IPv4:  ipv4,
+		IPv6:  ipv6,
+		TTL:   ttl,
+		Hosts: m.worktreeHosts,
+	}, nil
+}
+
+// dnsZone returns the domain worktree subdomains live under, derived from the
+// subdomain pattern
+func (m *Manager) dnsZone() string {
+	// The zone is made of the trailing labels that don't vary per branch
+	labels := strings.Split(m.Config.Web.SubdomainPattern, ".")
+	start := len(labels)
+	for start > 0 && projectPattern(labels[start-1]) {
+		start--
+	}
+
+	zone := m.expand(strings.Join(labels[start:], "."), "")
+	if zone == "" {
+		zone = m.Config.Project.Domain
+	}
+	return strings.ToLower(strings.Trim(zone, "."))
+}
+
+// projectPattern reports whether pattern only uses project-level placeholders
+func projectPattern(pattern string) bool {
+	for _, match := range placeholderRe.FindAllStringSubmatch(pattern, -1) {
+		if match[1] != "project_name" && match[1] != "project_domain" {
+			return false
+		}
+	}
+	return true
+}
+
+// worktreeHosts returns the subdomains of all worktrees grove created
+func (m *Manager) worktreeHosts() ([]string, error) {
+	worktrees, err := m.ListWorktrees()
+	if err != nil {
+		return nil, err
+	}
+
+	basePath := m.resolvePath(m.Config.Worktree.BasePath)
+	var hosts []string
+	for _, wt := range worktrees {
+		if filepath.Dir(wt.Path) == basePath {
+			hosts = append(hosts, m.subdomain(worktreeBranch(wt)))
+		}
+	}
+	return hosts, nil
+}
+
+// known reports whether host belongs to a worktree, refreshing the cached
+// worktree list when it is stale
+func (s *DNSServer) known(host string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.cached == nil || time.Since(s.cachedAt) > hostsCacheTTL {
+		hosts, err := s.Hosts()
+		if err == nil {
+			s.cached = make(map[string]bool, len(hosts))
+			for _, h := range hosts {
+				s.cached[strings.ToLower(strings.TrimSuffix(h, "."))] = true
+			}
+		} else {
+			fmt.Fprintf(os.Stderr, "grove dns: %v\n", err)
+		}
+		s.cachedAt = time.Now()
+	}
+
+	return s.cached[host]
+}
+
+// dnsQuestion is the single question of a query
+type dnsQuestion struct {
+	Name  string
+	Type  uint16
+	Class uint16
+	// raw is the question section as received, echoed in the response
+	raw []byte
+}
+
+// parseDNSQuery extracts the header flags and question from a query
+func parseDNSQuery(msg []byte) (id, flags uint16, q dnsQuestion, err error) {
+	if len(msg) >= 4 {
+		id = binary.BigEndian.Uint16(msg[0:2])
+		flags = binary.BigEndian.Uint16(msg[2:4])
+	}
+	if len(msg) < 12 {
+		return id, flags, q, errors.New("message too short")
+	}
+
+	if binary.BigEndian.Uint16(msg[4:6]) != 1 {
+		return id, flags, q, errors.New("expected exactly one question")
+	}
+
+	var labels []string
+	offset := 12
+	for {
+		if offset >= len(msg) {
+			return id, flags, q, errors.New("truncated name")
+		}
+		length := int(msg[offset])
+		offset++
+		if length == 0 {
+			break
+		}
+		if length > 63 || offset+length > len(msg) {
+			return id, flags, q, errors.New("invalid label")
+		}
+		labels = append(labels, string(msg[offset:offset+length]))
+		offset += length
+	}
+
+	if offset+4 > len(msg) {
+		return id, flags, q, errors.New("truncated question")
+	}
+
+	q.Name = strings.ToLower(strings.Join(labels, "."))
+	q.Type = binary.BigEndian.Uint16(msg[offset : offset+2])
+	q.Class = binary.BigEndian.Uint16(msg[offset+2 : offset+4])
+	q.raw = msg[12 : offset+4]
+	return id, flags, q, nil
+}
+
+// Answer builds the response to a DNS query
+func (s *DNSServer) Answer(query []byte) []byte {
+	id, flags, q, err := parseDNSQuery(query)
+	if err != nil {
+		if len(query) < 4 {
+			return nil
+		}
+		return dnsResponse(id, flags, dnsRcodeFormErr, nil, nil)
+	}
+
+	if opcode := (flags >> 11) & 0xF; opcode != 0 {
+		return dnsResponse(id, flags, dnsRcodeNotImp, q.raw, nil)
+	}
+
+	if q.Name != s.Zone && !strings.HasSuffix(q.Name, "."+s.Zone) {
+		return dnsResponse(id, flags, dnsRcodeRefused, q.raw, nil)
+	}
+
+	if q.Name != s.Zone && !s.known(q.Name) {
+		return dnsResponse(id, flags, dnsRcodeNXDomain, q.raw, nil)
+	}
+
+	var ip net.IP
+	switch {
+	case q.Class != dnsClassIN:
+	case q.Type == dnsTypeA:
+		ip = s.IPv4
+	case q.Type == dnsTypeAAAA:
+		ip = s.IPv6
+	}
+
+	var answer []byte
+	if ip != nil {
+		answer = make([]byte, 0, 12+len(ip))
+		// Pointer to the name in the question section
+		answer = binary.BigEndian.AppendUint16(answer, 0xC00C)
+		answer = binary.BigEndian.AppendUint16(answer, q.Type)
+		answer = binary.BigEndian.AppendUint16(answer, dnsClassIN)
+		answer = binary.BigEndian.AppendUint32(answer, s.TTL)
+		answer = binary.BigEndian.AppendUint16(answer, uint16(len(ip)))
+		answer = append(answer, ip...)
+	}
+
+	// A known name without a record of the requested type is NODATA
+	return dnsResponse(id, flags, dnsRcodeSuccess, q.raw, answer)
+}
+
+// dnsResponse assembles an authoritative response
+func dnsResponse(id, queryFlags uint16, rcode uint16, question, answer []byte) []byte {
+	const (
+		flagQR = 1 << 15
+		flagAA = 1 << 10
+		flagRD = 1 << 8
+	)
+
+	flags := uint16(flagQR|flagAA) | queryFlags&(0xF<<11) | queryFlags&flagRD | rcode
+
+	msg := make([]byte, 12, 12+len(question)+len(answer))
+	binary.BigEndian.PutUint16(msg[0:2], id)
+	binary.BigEndian.PutUint16(msg[2:4], flags)
+	if question != nil {
+		binary.BigEndian.PutUint16(msg[4:6], 1)
+	}
+	if answer != nil {
+		binary.BigEndian.PutUint16(msg[6:8], 1)
+	}
+
+	msg = append(msg, question...)
+	return append(msg, answer...)
+}
+
+// Serve answers queries on conn until ctx is cancelled
+func (s *DNSServer) Serve(ctx context.Context, conn net.PacketConn) error {
+	go func() {
+		<-ctx.Done()
+		conn.Close()
+	}()
+
+	buf := make([]byte, 512)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+
+		if resp := s.Answer(buf[:n]); resp != nil {
+			conn.WriteTo(resp, addr)
+		}
+	}
+}
+
+// RunDNS serves the project's DNS zone until ctx is cancelled
+func (m *Manager) RunDNS(ctx context.Context) error {
+	server, err := m.NewDNSServer()
+	if err != nil {
+		return err
+	}
+
+	conn, err := net.ListenPacket("udp", m.dnsListen())
+	if err != nil {
+		return fmt.Errorf("failed to listen for DNS: %w", err)
+	}
+
+	fmt.Printf("grove dns serving *.%s on %s\n", server.Zone, conn.LocalAddr())
+	return server.Serve(ctx, conn)
+}
+
+func (m *Manager) dnsListen() string {
+	if m.Config.Web.DNS.Listen != "" {
+		return m.Config.Web.DNS.Listen
+	}
+	return defaultDNSListen
+}
+
+// DNSResolverConfig returns a snippet that forwards the project's zone to
+// grove's DNS server. Supported kinds are systemd-resolved, dnsmasq and macos.
+func (m *Manager) DNSResolverConfig(kind string) (string, error) {
+	host, port, err := net.SplitHostPort(m.dnsListen())
+	if err != nil {
+		return "", fmt.Errorf("invalid dns listen address: %w", err)
+	}
+	zone := m.dnsZone()
+
+	switch kind {
+	case "systemd-resolved":
+		return fmt.Sprintf(`# /etc/systemd/resolved.conf.d/grove-%s.conf
+[Resolve]
+DNS=%s
+Domains=~%s
+`, m.Config.Project.Name, net.JoinHostPort(host, port), zone), nil
+	case "dnsmasq":
+		return fmt.Sprintf(`# /etc/dnsmasq.d/grove-%s.conf
+server=/%s/%s#%s
+`, m.Config.Project.Name, zone, host, port), nil
+	case "macos":
+		return fmt.Sprintf(`# /etc/resolver/%s
+nameserver %s
+port %s
+`, zone, host, port), nil
+	default:
+		return "", fmt.Errorf("unknown resolver '%s' (expected systemd-resolved, dnsmasq or macos)", kind)
+	}
+}
@@ -0,0 +1,155 @@
+package worktree
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func startTestDNSServer(t *testing.T, server *DNSServer) *net.Resolver {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go server.Serve(ctx, conn)
+
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "udp", conn.LocalAddr().String())
+		},
+	}
+}
+
+func TestDNSServer(t *testing.T) {
+	manager := &Manager{Config: &Config{
+		Project: ProjectConfig{Name: "testapp", Domain: "app.test"},
+		Web: WebConfig{
+			SubdomainPattern: "{branch}.{project_domain}",
+			DNS:              DNSConfig{AddressV6: "::1"},
+		},
+	}}
+
+	server, err := manager.NewDNSServer()
+	if err != nil {
+		t.Fatalf("NewDNSServer() error = %v", err)
+	}
+	if server.Zone != "app.test" {
+		t.Errorf("Expected zone app.test, got %s", server.Zone)
+	}
+	server.Hosts = func() ([]string, error) {
+		return []string{"main.app.test", "feature-auth.app.test"}, nil
+	}
+
+	resolver := startTestDNSServer(t, server)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	addrs, err := resolver.LookupIPAddr(ctx, "Feature-Auth.app.test")
+	if err != nil {
+		t.Fatalf("LookupIPAddr() error = %v", err)
+	}
+	var got []string
+	for _, a := range addrs {
+		got = append(got, a.IP.String())
+	}
+	if strings.Join(got, ",") != "127.0.0.1,::1" && strings.Join(got, ",") != "::1,127.0.0.1" {
+		t.Errorf("Expected 127.0.0.1 and ::1, got %v", got)
+	}
+
+	_, err = resolver.LookupIPAddr(ctx, "unknown.app.test")
+	var dnsErr *net.DNSError
+	if !errors.As(err, &dnsErr) || !dnsErr.IsNotFound {
+		t.Errorf("Expected NXDOMAIN for an unknown branch, got %v", err)
+	}
+}
+
+func TestDNSServer_Answer(t *testing.T) {
+	server := &DNSServer{
+		Zone:  "app.test",
+		IPv4:  net.IPv4(127, 0, 0, 1).To4(),
+		TTL:   5,
+		Hosts: func() ([]string, error) { return []string{"main.app.test"}, nil },
+	}
+
+	query := func(name string, qtype uint16) []byte {
+		msg := []byte{0x12, 0x34, 0x01, 0x00, 0, 1, 0, 0, 0, 0, 0, 0}
+		for _, label := range strings.Split(name, ".") {
+			msg = append(msg, byte(len(label)))
+			msg = append(msg, label...)
+		}
+		return append(msg, 0, byte(qtype>>8), byte(qtype), 0, 1)
+	}
+
+	tests := []struct {
+		name        string
+		query       []byte
+		wantRcode   byte
+		wantAnswers byte
+	}{
+		{name: "known A", query: query("main.app.test", dnsTypeA), wantRcode: dnsRcodeSuccess, wantAnswers: 1},
+		{name: "known AAAA without v6", query: query("main.app.test", dnsTypeAAAA), wantRcode: dnsRcodeSuccess},
+		{name: "zone apex", query: query("app.test", dnsTypeA), wantRcode: dnsRcodeSuccess, wantAnswers: 1},
+		{name: "unknown branch", query: query("other.app.test", dnsTypeA), wantRcode: dnsRcodeNXDomain},
+		{name: "outside zone", query: query("example.com", dnsTypeA), wantRcode: dnsRcodeRefused},
+		{name: "malformed", query: []byte{0x12, 0x34, 0x01, 0x00, 0, 1}, wantRcode: dnsRcodeFormErr},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := server.Answer(tt.query)
+			if len(resp) < 12 {
+				t.Fatalf("Response too short: %v", resp)
+			}
+			if resp[0] != 0x12 || resp[1] != 0x34 {
+				t.Error("Expected the query ID to be echoed")
+			}
+			if resp[2]&0x80 == 0 {
+				t.Error("Expected the QR bit to be set")
+			}
+			if rcode := resp[3] & 0xF; rcode != tt.wantRcode {
+				t.Errorf("rcode = %d, want %d", rcode, tt.wantRcode)
+			}
+			if resp[7] != tt.wantAnswers {
+				t.Errorf("answers = %d, want %d", resp[7], tt.wantAnswers)
+			}
+		})
+	}
+}
+
+func TestManager_DNSResolverConfig(t *testing.T) {
+	manager := &Manager{Config: &Config{
+		Project: ProjectConfig{Name: "testapp", Domain: "app.test"},
+		Web: WebConfig{
+			SubdomainPattern: "{branch}.{project_domain}",
+			DNS:              DNSConfig{Listen: "127.0.0.1:5353"},
+		},
+	}}
+
+	tests := map[string]string{
+		"systemd-resolved": "DNS=127.0.0.1:5353\nDomains=~app.test\n",
+		"dnsmasq":          "server=/app.test/127.0.0.1#5353\n",
+		"macos":            "nameserver 127.0.0.1\nport 5353\n",
+	}
+
+	for kind, want := range tests {
+		got, err := manager.DNSResolverConfig(kind)
+		if err != nil {
+			t.Fatalf("DNSResolverConfig(%s) error = %v", kind, err)
+		}
+		if !strings.Contains(got, want) {
+			t.Errorf("DNSResolverConfig(%s) = %q, want it to contain %q", kind, got, want)
+		}
+	}
+
+	if _, err := manager.DNSResolverConfig("bind"); err == nil {
+		t.Error("Expected an error for an unknown resolver")
+	}
+}
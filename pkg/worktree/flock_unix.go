@@ -0,0 +1,56 @@
+//go:build !windows
+
+package worktree
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// flock takes an advisory lock on f, blocking until it is available
+func flock(f *os.File, exclusive bool) error {
+	for {
+		err := syscall.Flock(int(f.Fd()), flockMode(exclusive))
+		if err != syscall.EINTR {
+			return err
+		}
+	}
+}
+
+// tryFlock takes an advisory lock on f if it is free, reporting whether it
+// did
+func tryFlock(f *os.File, exclusive bool) (bool, error) {
+	for {
+		err := syscall.Flock(int(f.Fd()), flockMode(exclusive)|syscall.LOCK_NB)
+		switch {
+		case err == nil:
+			return true, nil
+		case errors.Is(err, syscall.EWOULDBLOCK):
+			return false, nil
+		case err != syscall.EINTR:
+			return false, err
+		}
+	}
+}
+
+func flockMode(exclusive bool) int {
+	if exclusive {
+		return syscall.LOCK_EX
+	}
+	return syscall.LOCK_SH
+}
+
+// funlock releases a lock taken with flock
+func funlock(f *os.File) error {
+	return syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+}
+
+// processAlive reports whether a process with the given PID exists
+func processAlive(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+	err := syscall.Kill(pid, 0)
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
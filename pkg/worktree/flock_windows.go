@@ -0,0 +1,88 @@
+//go:build windows
+
+package worktree
+
+import (
+	"errors"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+var (
+	kernel32         = syscall.NewLazyDLL("kernel32.dll")
+	procLockFileEx   = kernel32.NewProc("LockFileEx")
+	procUnlockFileEx = kernel32.NewProc("UnlockFileEx")
+)
+
+const (
+	lockfileFailImmediately = 0x1
+	lockfileExclusiveLock   = 0x2
+
+	// lockOffsetHigh places the locked byte at 4GiB
+	lockOffsetHigh = 1
+
+	errorLockViolation             syscall.Errno = 33
+	processQueryLimitedInformation               = 0x1000
+	stillActive                                  = 259
+)
+
+// flock takes a lock on f, blocking until it is available. Windows locks are
+// mandatory, so the locked byte lies far past the end of the file to keep
+// its contents readable.
+func flock(f *os.File, exclusive bool) error {
+	return lockFileEx(f, flockMode(exclusive))
+}
+
+// tryFlock takes a lock on f if it is free, reporting whether it did
+func tryFlock(f *os.File, exclusive bool) (bool, error) {
+	err := lockFileEx(f, flockMode(exclusive)|lockfileFailImmediately)
+	if errors.Is(err, errorLockViolation) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func flockMode(exclusive bool) uint32 {
+	if exclusive {
+		return lockfileExclusiveLock
+	}
+	return 0
+}
+
+func lockFileEx(f *os.File, flags uint32) error {
+	ol := syscall.Overlapped{OffsetHigh: lockOffsetHigh}
+	r, _, err := procLockFileEx.Call(f.Fd(), uintptr(flags), 0, 1, 0, uintptr(unsafe.Pointer(&ol)))
+	if r == 0 {
+		return err
+	}
+	return nil
+}
+
+// funlock releases a lock taken with flock
+func funlock(f *os.File) error {
+	ol := syscall.Overlapped{OffsetHigh: lockOffsetHigh}
+	r, _, err := procUnlockFileEx.Call(f.Fd(), 0, 1, 0, uintptr(unsafe.Pointer(&ol)))
+	if r == 0 {
+		return err
+	}
+	return nil
+}
+
+// processAlive reports whether a process with the given PID is running
+func processAlive(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+	h, err := syscall.OpenProcess(processQueryLimitedInformation, false, uint32(pid))
+	if err != nil {
+		return false
+	}
+	defer syscall.CloseHandle(h)
+
+	var code uint32
+	if err := syscall.GetExitCodeProcess(h, &code); err != nil {
+		return false
+	}
+	return code == stillActive
+}
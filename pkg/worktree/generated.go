@@ -0,0 +1,224 @@
+package worktree
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"sort"
+)
+
+const (
+	passwordAlphabet      = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+	defaultPasswordLength = 24
+	defaultHexLength      = 32
+	maxGeneratedLength    = 256
+)
+
+// generateSpec is a variable written as {generate: password, length: 24},
+// whose value grove creates once per worktree
+type generateSpec struct {
+	kind   string
+	length int
+}
+
+// parseGenerateSpec reports whether a variable value asks for a generated
+// value, and describes it
+func parseGenerateSpec(value interface{}) (generateSpec, bool, error) {
+	fields, ok := value.(map[string]interface{})
+	if !ok {
+		return generateSpec{}, false, nil
+	}
+	kind, ok := fields["generate"]
+	if !ok {
+		return generateSpec{}, false, nil
+	}
+
+	spec := generateSpec{}
+	if spec.kind, ok = kind.(string); !ok {
+		return spec, true, fmt.Errorf("generate must be password, hex or uuid")
+	}
+	switch spec.kind {
+	case "password":
+		spec.length = defaultPasswordLength
+	case "hex":
+		spec.length = defaultHexLength
+	case "uuid":
+	default:
+		return spec, true, fmt.Errorf("unknown generate type '%s' (want password, hex or uuid)", spec.kind)
+	}
+
+	if length, ok := fields["length"]; ok {
+		n, ok := length.(int)
+		if !ok || n < 1 || n > maxGeneratedLength {
+			return spec, true, fmt.Errorf("length must be between 1 and %d", maxGeneratedLength)
+		}
+		if spec.kind == "uuid" {
+			return spec, true, fmt.Errorf("length does not apply to uuid")
+		}
+		spec.length = n
+	}
+	return spec, true, nil
+}
+
+// generate creates a new random value for the spec
+func (s generateSpec) generate() (string, error) {
+	switch s.kind {
+	case "hex":
+		buf := make([]byte, (s.length+1)/2)
+		if _, err := rand.Read(buf); err != nil {
+			return "", fmt.Errorf("failed to generate value: %w", err)
+		}
+		return hex.EncodeToString(buf)[:s.length], nil
+	case "uuid":
+		buf := make([]byte, 16)
+		if _, err := rand.Read(buf); err != nil {
+			return "", fmt.Errorf("failed to generate value: %w", err)
+		}
+		// Version 4, RFC 4122 variant
+		buf[6] = buf[6]&0x0f | 0x40
+		buf[8] = buf[8]&0x3f | 0x80
+		h := hex.EncodeToString(buf)
+		return h[:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:], nil
+	}
+
+	out := make([]byte, s.length)
+	max := big.NewInt(int64(len(passwordAlphabet)))
+	for i := range out {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", fmt.Errorf("failed to generate value: %w", err)
+		}
+		out[i] = passwordAlphabet[n.Int64()]
+	}
+	return string(out), nil
+}
+
+// generateVariables fills in the worktree's generated variables that don't
+// have a value yet, keeping existing ones stable
+func (m *Manager) generateVariables(wt *WorktreeState) error {
+	for name, value := range m.Config.Variables {
+		spec, ok, err := parseGenerateSpec(value)
+		if err != nil {
+			return fmt.Errorf("variables.%s: %w", name, err)
+		}
+		if !ok {
+			continue
+		}
+		if _, exists := wt.Generated[name]; exists {
+			continue
+		}
+
+		generated, err := spec.generate()
+		if err != nil {
+			return err
+		}
+		if wt.Generated == nil {
+			wt.Generated = make(map[string]string)
+		}
+		wt.Generated[name] = generated
+	}
+	return nil
+}
+
+// hasGeneratedVariables reports whether any variable is generated
+func (m *Manager) hasGeneratedVariables() bool {
+	for _, value := range m.Config.Variables {
+		if _, ok, _ := parseGenerateSpec(value); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// ensureGenerated records values for generated variables added to the config
+// since the worktree was created
+func (m *Manager) ensureGenerated(worktreePath, branchName string) error {
+	if !m.hasGeneratedVariables() {
+		return nil
+	}
+	return m.updateState(func(state *State) error {
+		wt := state.Worktrees[branchName]
+		if wt.Branch == "" {
+			wt = WorktreeState{Branch: branchName, Path: worktreePath}
+		}
+		if err := m.generateVariables(&wt); err != nil {
+			return err
+		}
+		state.Worktrees[branchName] = wt
+		return nil
+	})
+}
+
+// generatedValues returns the branch's generated variables from the state
+func (m *Manager) generatedValues(branchName string) map[string]string {
+	if state, err := m.loadState(); err == nil {
+		return state.Worktrees[branchName].Generated
+	}
+	return nil
+}
+
+// checkGenerated reports invalid generate specs and generated variables the
+// branch has no value for, which would otherwise render as empty strings
+func (m *Manager) checkGenerated(branchName string) error {
+	if !m.hasGeneratedVariables() {
+		return nil
+	}
+	state, err := m.loadState()
+	if err != nil {
+		return err
+	}
+	values := state.Worktrees[branchName].Generated
+
+	names := make([]string, 0, len(m.Config.Variables))
+	for name := range m.Config.Variables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		_, ok, err := parseGenerateSpec(m.Config.Variables[name])
+		if err != nil {
+			return fmt.Errorf("variables.%s: %w", name, err)
+		}
+		if _, exists := values[name]; ok && !exists {
+			return fmt.Errorf("variables.%s has no generated value for branch '%s'", name, branchName)
+		}
+	}
+	return nil
+}
+
+// GeneratedVariable is a worktree's generated variable and its value
+type GeneratedVariable struct {
+	Name string `json:"name"`
+	// Env is the name as an environment variable, e.g. DB_PASSWORD
+	Env   string `json:"env"`
+	Value string `json:"value"`
+}
+
+// GeneratedVariables returns a worktree's generated variables, sorted by name
+func (m *Manager) GeneratedVariables(name string) ([]GeneratedVariable, error) {
+	return m.GeneratedVariablesContext(context.Background(), name)
+}
+
+// GeneratedVariablesContext is GeneratedVariables with a context
+func (m *Manager) GeneratedVariablesContext(ctx context.Context, name string) ([]GeneratedVariable, error) {
+	release, err := m.lock(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	wt, err := m.findWorktree(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	values := m.generatedValues(worktreeBranch(wt))
+	vars := make([]GeneratedVariable, 0, len(values))
+	for k, v := range values {
+		vars = append(vars, GeneratedVariable{Name: k, Env: envName(k), Value: v})
+	}
+	sort.Slice(vars, func(i, j int) bool { return vars[i].Name < vars[j].Name })
+	return vars, nil
+}
@@ -0,0 +1,143 @@
+package worktree
+
+import (
+	"context"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestParseGenerateSpec(t *testing.T) {
+	tests := []struct {
+		name       string
+		value      interface{}
+		wantOK     bool
+		wantErr    bool
+		wantLength int
+	}{
+		{name: "plain string", value: "password"},
+		{name: "other mapping", value: map[string]interface{}{"auth": true}},
+		{name: "password", value: map[string]interface{}{"generate": "password"}, wantOK: true, wantLength: defaultPasswordLength},
+		{name: "password length", value: map[string]interface{}{"generate": "password", "length": 12}, wantOK: true, wantLength: 12},
+		{name: "hex", value: map[string]interface{}{"generate": "hex"}, wantOK: true, wantLength: defaultHexLength},
+		{name: "uuid", value: map[string]interface{}{"generate": "uuid"}, wantOK: true},
+		{name: "unknown type", value: map[string]interface{}{"generate": "pin"}, wantOK: true, wantErr: true},
+		{name: "bad length", value: map[string]interface{}{"generate": "password", "length": 0}, wantOK: true, wantErr: true},
+		{name: "uuid length", value: map[string]interface{}{"generate": "uuid", "length": 8}, wantOK: true, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spec, ok, err := parseGenerateSpec(tt.value)
+			if ok != tt.wantOK || (err != nil) != tt.wantErr {
+				t.Fatalf("parseGenerateSpec() = %v, %v; want ok %v, error %v", ok, err, tt.wantOK, tt.wantErr)
+			}
+			if err == nil && spec.length != tt.wantLength {
+				t.Errorf("length = %d, want %d", spec.length, tt.wantLength)
+			}
+		})
+	}
+}
+
+func TestGenerateSpec_generate(t *testing.T) {
+	tests := []struct {
+		spec generateSpec
+		want *regexp.Regexp
+	}{
+		{generateSpec{kind: "password", length: 24}, regexp.MustCompile(`^[A-Za-z0-9]{24}$`)},
+		{generateSpec{kind: "hex", length: 7}, regexp.MustCompile(`^[0-9a-f]{7}$`)},
+		{generateSpec{kind: "uuid"}, regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)},
+	}
+
+	for _, tt := range tests {
+		a, err := tt.spec.generate()
+		if err != nil {
+			t.Fatalf("generate() error = %v", err)
+		}
+		b, _ := tt.spec.generate()
+		if !tt.want.MatchString(a) {
+			t.Errorf("generate(%s) = %q, want %s", tt.spec.kind, a, tt.want)
+		}
+		if a == b {
+			t.Errorf("generate(%s) returned %q twice", tt.spec.kind, a)
+		}
+	}
+}
+
+func TestManager_ensureGenerated(t *testing.T) {
+	dir := t.TempDir()
+	m := &Manager{
+		BaseDir: dir,
+		Config: &Config{
+			Project: ProjectConfig{Name: "testapp", Domain: "app.test"},
+			Variables: map[string]interface{}{
+				"db_password": map[string]interface{}{"generate": "password", "length": 16},
+				"db_user":     "app",
+			},
+		},
+	}
+
+	if err := m.ensureGenerated(dir+"/worktrees/feature", "feature"); err != nil {
+		t.Fatalf("ensureGenerated() error = %v", err)
+	}
+	ctx := m.buildTemplateContext(context.Background(), dir+"/worktrees/feature", "feature")
+	password, _ := ctx["db_password"].(string)
+	if len(password) != 16 {
+		t.Fatalf("db_password = %q, want 16 characters", password)
+	}
+	if ctx["db_user"] != "app" {
+		t.Errorf("db_user = %v, want app", ctx["db_user"])
+	}
+
+	// Re-rendering keeps the value; another worktree gets its own
+	if err := m.ensureGenerated(dir+"/worktrees/feature", "feature"); err != nil {
+		t.Fatal(err)
+	}
+	if got := m.buildTemplateContext(context.Background(), dir+"/worktrees/feature", "feature")["db_password"]; got != password {
+		t.Errorf("db_password changed from %q to %v", password, got)
+	}
+	if err := m.ensureGenerated(dir+"/worktrees/other", "other"); err != nil {
+		t.Fatal(err)
+	}
+	if got := m.buildTemplateContext(context.Background(), dir+"/worktrees/other", "other")["db_password"]; got == password {
+		t.Error("worktrees share a generated password")
+	}
+
+	info, err := os.Stat(m.statePath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("state file mode = %v, want 0600", info.Mode().Perm())
+	}
+}
+
+func TestManager_checkGenerated(t *testing.T) {
+	dir := t.TempDir()
+	m := &Manager{
+		BaseDir: dir,
+		Config: &Config{
+			Variables: map[string]interface{}{
+				"db_password": map[string]interface{}{"generate": "password"},
+			},
+		},
+	}
+
+	// Rendering before a value exists fails instead of writing ""
+	if err := m.checkGenerated("feature"); err == nil || !strings.Contains(err.Error(), "variables.db_password") {
+		t.Errorf("checkGenerated() error = %v, want a missing value error", err)
+	}
+
+	if err := m.ensureGenerated(dir+"/worktrees/feature", "feature"); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.checkGenerated("feature"); err != nil {
+		t.Errorf("checkGenerated() error = %v", err)
+	}
+
+	m.Config.Variables["api_key"] = map[string]interface{}{"generate": "base64"}
+	if err := m.checkGenerated("feature"); err == nil || !strings.Contains(err.Error(), "variables.api_key") {
+		t.Errorf("checkGenerated() error = %v, want the invalid spec", err)
+	}
+}
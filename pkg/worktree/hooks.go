@@ -0,0 +1,174 @@
+package worktree
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/glanotte/grove/pkg/runner"
+)
+
+const defaultHookTimeout = 5 * time.Minute
+
+// Lifecycle hook names, matching the keys under worktree.hooks
+const (
+	HookPreCreate  = "pre_create"
+	HookPostCreate = "post_create"
+	HookPreRemove  = "pre_remove"
+	HookPostRemove = "post_remove"
+	HookPreUp      = "pre_up"
+	HookPostUp     = "post_up"
+	HookPreDown    = "pre_down"
+	HookPostDown   = "post_down"
+	HookPreRender  = "pre_render"
+	HookPostRender = "post_render"
+)
+
+// hookCommand returns the configured command for a hook
+func (m *Manager) hookCommand(hook string) string {
+	h := m.Config.Worktree.Hooks
+	switch hook {
+	case HookPreCreate:
+		return h.PreCreate
+	case HookPostCreate:
+		return h.PostCreate
+	case HookPreRemove:
+		return h.PreRemove
+	case HookPostRemove:
+		return h.PostRemove
+	case HookPreUp:
+		return h.PreUp
+	case HookPostUp:
+		return h.PostUp
+	case HookPreDown:
+		return h.PreDown
+	case HookPostDown:
+		return h.PostDown
+	case HookPreRender:
+		return h.PreRender
+	case HookPostRender:
+		return h.PostRender
+	}
+	return ""
+}
+
+func (m *Manager) hookTimeout() time.Duration {
+	if timeout, err := time.ParseDuration(m.Config.Worktree.Hooks.Timeout); err == nil && timeout > 0 {
+		return timeout
+	}
+	return defaultHookTimeout
+}
+
+// runHook runs a lifecycle hook in dir with the template context vars
+// exported as GROVE_* environment variables. Output is streamed to the
+// terminal.
+func (m *Manager) runHook(ctx context.Context, hook, dir string, vars map[string]interface{}) error {
+	command := m.hookCommand(hook)
+	if command == "" {
+		return nil
+	}
+
+	fmt.Printf("Running %s hook...\n", hook)
+	return m.runShell(ctx, hook+" hook", command, dir, hookEnv(hook, m.BaseDir, vars), m.hookTimeout())
+}
+
+// runShell runs a configured shell command in dir, streaming its output. A
+// zero timeout lets the command run until it exits or ctx is cancelled.
+func (m *Manager) runShell(ctx context.Context, label, command, dir string, env []string, timeout time.Duration) error {
+	// Scripts are configured relative to the project root, not the worktree
+	if fields := strings.Fields(command); len(fields) > 0 && !strings.HasPrefix(fields[0], "/") {
+		if script := m.resolvePath(fields[0]); fileExists(script) {
+			command = script + strings.TrimPrefix(strings.TrimLeft(command, " \t"), fields[0])
+		}
+	}
+
+	if _, err := os.Stat(dir); err != nil {
+		dir = m.BaseDir
+	}
+
+	runCtx, cancel := ctx, func() {}
+	if timeout > 0 {
+		runCtx, cancel = context.WithTimeout(runCtx, timeout)
+	}
+	defer cancel()
+
+	cmd := runner.Command("sh", "-c", command)
+	cmd.Dir = dir
+	cmd.Env = append(env, m.lockEnv()...)
+	cmd.Stdout = redactWriter{m: m, w: os.Stdout}
+	cmd.Stderr = redactWriter{m: m, w: os.Stderr}
+
+	_, err := m.run(runCtx, cmd)
+	if ctx.Err() == nil && errors.Is(runCtx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("%s timed out after %s", label, timeout)
+	}
+	if err != nil {
+		return fmt.Errorf("%s failed: %w", label, err)
+	}
+	return nil
+}
+
+// runPostHook runs a post_* hook, reporting failures without failing the
+// operation that already completed
+func (m *Manager) runPostHook(ctx context.Context, hook, dir string, vars map[string]interface{}) {
+	if err := m.runHook(ctx, hook, dir, vars); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+	}
+}
+
+// hookEnv converts the template context into GROVE_* environment variables
+func hookEnv(hook, root string, vars map[string]interface{}) []string {
+	env := []string{
+		"GROVE_HOOK=" + hook,
+		"GROVE_ROOT=" + root,
+	}
+
+	keys := make([]string, 0, len(vars))
+	for k := range vars {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		env = append(env, fmt.Sprintf("GROVE_%s=%v", envName(k), vars[k]))
+	}
+	return env
+}
+
+// envName converts BranchName or db_name_prefix to BRANCH_NAME or
+// DB_NAME_PREFIX. The result never contains "__", so hook variables can't
+// be mistaken for GROVE_SECTION__KEY config overrides.
+func envName(key string) string {
+	var b strings.Builder
+	runes := []rune(key)
+	for i, r := range runes {
+		switch {
+		case unicode.IsUpper(r):
+			// Start a new word at a lower-to-upper boundary, or at the last
+			// capital of an acronym (URLPath -> URL_PATH)
+			if i > 0 && (unicode.IsLower(runes[i-1]) || unicode.IsDigit(runes[i-1]) ||
+				(unicode.IsUpper(runes[i-1]) && i+1 < len(runes) && unicode.IsLower(runes[i+1]))) {
+				b.WriteByte('_')
+			}
+			b.WriteRune(r)
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			b.WriteRune(unicode.ToUpper(r))
+		default:
+			// Never emit "__", which marks a config override
+			if !strings.HasSuffix(b.String(), "_") {
+				b.WriteByte('_')
+			}
+		}
+	}
+	return b.String()
+}
+
+func fileExists(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && !info.IsDir()
+}
@@ -0,0 +1,85 @@
+package worktree
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestManager_runHook(t *testing.T) {
+	tempDir := t.TempDir()
+	worktreePath := filepath.Join(tempDir, "worktrees", "feature-auth")
+	if err := os.MkdirAll(worktreePath, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	hooksDir := filepath.Join(tempDir, ".grove", "hooks")
+	if err := os.MkdirAll(hooksDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	script := "#!/bin/sh\necho \"$PWD $GROVE_HOOK $GROVE_BRANCH_NAME $GROVE_DB_NAME_PREFIX $1\" > \"$GROVE_ROOT/out\"\n"
+	if err := os.WriteFile(filepath.Join(hooksDir, "post-create.sh"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	manager := &Manager{
+		BaseDir: tempDir,
+		Config: &Config{
+			Worktree: WorktreeConfig{
+				BasePath: "./worktrees",
+				Hooks: HooksConfig{
+					PostCreate: ".grove/hooks/post-create.sh extra",
+					PreRemove:  "echo aborting >&2; exit 3",
+					PreUp:      "exec sleep 5",
+					Timeout:    "100ms",
+				},
+			},
+			Variables: map[string]interface{}{"db_name_prefix": "testapp"},
+		},
+	}
+	vars := manager.buildTemplateContext(context.Background(), worktreePath, "feature/auth")
+
+	if err := manager.runHook(context.Background(), HookPostCreate, worktreePath, vars); err != nil {
+		t.Fatalf("runHook(post_create) error = %v", err)
+	}
+	out, err := os.ReadFile(filepath.Join(tempDir, "out"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, _ := filepath.EvalSymlinks(worktreePath)
+	if want := dir + " post_create feature-auth testapp extra\n"; string(out) != want {
+		t.Errorf("hook output = %q, want %q", out, want)
+	}
+
+	if err := manager.runHook(context.Background(), HookPreRemove, worktreePath, vars); err == nil || !strings.Contains(err.Error(), "pre_remove hook failed") {
+		t.Errorf("Expected a failing pre_remove hook, got %v", err)
+	}
+
+	if err := manager.runHook(context.Background(), HookPreUp, worktreePath, vars); err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Errorf("Expected pre_up to time out, got %v", err)
+	}
+
+	// Unconfigured hooks are a no-op
+	if err := manager.runHook(context.Background(), HookPostDown, worktreePath, vars); err != nil {
+		t.Errorf("runHook(post_down) error = %v", err)
+	}
+}
+
+func TestEnvName(t *testing.T) {
+	tests := map[string]string{
+		"BranchName":     "BRANCH_NAME",
+		"WebPort":        "WEB_PORT",
+		"db_name_prefix": "DB_NAME_PREFIX",
+		"DatabaseURL":    "DATABASE_URL",
+		"URLPath":        "URL_PATH",
+		"Redis2Host":     "REDIS2_HOST",
+	}
+
+	for key, want := range tests {
+		if got := envName(key); got != want {
+			t.Errorf("envName(%q) = %q, want %q", key, got, want)
+		}
+	}
+}
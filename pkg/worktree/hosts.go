@@ -0,0 +1,304 @@
+package worktree
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/glanotte/grove/pkg/runner"
+)
+
+const (
+	defaultHostsFile     = "/etc/hosts"
+	defaultHostsAddress  = "127.0.0.1"
+	defaultHostsEscalate = "sudo"
+)
+
+// wildcardDomains resolve every subdomain to 127.0.0.1 without any setup
+var wildcardDomains = []string{
+	"localhost",
+	"lvh.me",
+	"localtest.me",
+	"vcap.me",
+	"nip.io",
+	"sslip.io",
+}
+
+// HostEntry maps a hostname to an address in the hosts file
+type HostEntry struct {
+	Host    string
+	Address string
+}
+
+// HostsFile edits the grove block of a hosts file
+type HostsFile struct {
+	Path    string
+	Project string
+}
+
+func (h *HostsFile) beginMarker() string {
+	return fmt.Sprintf("# BEGIN grove %s", h.Project)
+}
+
+func (h *HostsFile) endMarker() string {
+	return "# END grove"
+}
+
+// Entries returns the entries currently in the project's block
+func (h *HostsFile) Entries() ([]HostEntry, error) {
+	content, err := os.ReadFile(h.Path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read hosts file: %w", err)
+	}
+
+	var entries []HostEntry
+	inBlock := false
+	for _, line := range strings.Split(string(content), "\n") {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case trimmed == h.beginMarker():
+			inBlock = true
+		case inBlock && trimmed == h.endMarker():
+			inBlock = false
+		case inBlock:
+			fields := strings.Fields(trimmed)
+			if len(fields) >= 2 && !strings.HasPrefix(fields[0], "#") {
+				for _, host := range fields[1:] {
+					entries = append(entries, HostEntry{Host: host, Address: fields[0]})
+				}
+			}
+		}
+	}
+
+	return entries, nil
+}
+
+// Render returns content with the project's block replaced by entries. An
+// empty entry list removes the block.
+func (h *HostsFile) Render(content string, entries []HostEntry) string {
+	var lines []string
+	inBlock := false
+	for _, line := range strings.Split(strings.TrimRight(content, "\n"), "\n") {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case trimmed == h.beginMarker():
+			inBlock = true
+		case inBlock && trimmed == h.endMarker():
+			inBlock = false
+		case !inBlock:
+			lines = append(lines, line)
+		}
+	}
+
+	// Drop trailing blank lines left behind by a removed block
+	for len(lines) > 0 && strings.TrimSpace(lines[len(lines)-1]) == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	if len(entries) > 0 {
+		sorted := append([]HostEntry(nil), entries...)
+		sort.Slice(sorted, func(i, j int) bool { return sorted[i].Host < sorted[j].Host })
+
+		if len(lines) > 0 {
+			lines = append(lines, "")
+		}
+		lines = append(lines, h.beginMarker())
+		for _, e := range sorted {
+			lines = append(lines, fmt.Sprintf("%s\t%s", e.Address, e.Host))
+		}
+		lines = append(lines, h.endMarker())
+	}
+
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// Write replaces the project's block with entries atomically, keeping the
+// file's permissions
+func (h *HostsFile) Write(entries []HostEntry) error {
+	content, err := os.ReadFile(h.Path)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read hosts file: %w", err)
+	}
+
+	perm := os.FileMode(0644)
+	if info, err := os.Stat(h.Path); err == nil {
+		perm = info.Mode().Perm()
+	}
+
+	updated := h.Render(string(content), entries)
+	if updated == string(content) {
+		return nil
+	}
+
+	return writeFileAtomic(h.Path, []byte(updated), perm)
+}
+
+// ReadHostEntries parses "address host" lines, as passed to the privileged
+// helper on stdin
+func ReadHostEntries(r io.Reader) ([]HostEntry, error) {
+	var entries []HostEntry
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("invalid hosts entry %q", scanner.Text())
+		}
+		entries = append(entries, HostEntry{Address: fields[0], Host: fields[1]})
+	}
+	return entries, scanner.Err()
+}
+
+// hostsFile returns the hosts file configured for the project
+func (m *Manager) hostsFile() *HostsFile {
+	path := m.Config.Web.Hosts.File
+	if path == "" {
+		path = defaultHostsFile
+	}
+	return &HostsFile{Path: m.resolvePath(path), Project: m.Config.Project.Name}
+}
+
+// useHostsFile reports whether worktree hostnames need hosts file entries
+func (m *Manager) useHostsFile() bool {
+	switch m.Config.Web.Hosts.Mode {
+	case "always":
+		return true
+	case "never":
+		return false
+	}
+
+	domain := strings.ToLower(strings.TrimSuffix(m.Config.Project.Domain, "."))
+	for _, wildcard := range wildcardDomains {
+		if domain == wildcard || strings.HasSuffix(domain, "."+wildcard) {
+			return false
+		}
+	}
+	return true
+}
+
+func (m *Manager) hostsAddress() string {
+	if m.Config.Web.Hosts.Address != "" {
+		return m.Config.Web.Hosts.Address
+	}
+	return defaultHostsAddress
+}
+
+// addHostsEntry adds the route's host to the hosts file
+func (m *Manager) addHostsEntry(ctx context.Context, route Route) error {
+	entries, err := m.hostsFile().Entries()
+	if err != nil {
+		return err
+	}
+
+	entries = removeHostEntry(entries, route.Host)
+	entries = append(entries, HostEntry{Host: route.Host, Address: m.hostsAddress()})
+	return m.writeHostsEntries(ctx, entries)
+}
+
+// removeHostsEntry removes the route's host from the hosts file
+func (m *Manager) removeHostsEntry(ctx context.Context, route Route) error {
+	entries, err := m.hostsFile().Entries()
+	if err != nil {
+		return err
+	}
+	return m.writeHostsEntries(ctx, removeHostEntry(entries, route.Host))
+}
+
+// SyncHosts rewrites the project's hosts block to match existing worktrees
+func (m *Manager) SyncHosts() ([]HostEntry, error) {
+	return m.SyncHostsContext(context.Background())
+}
+
+// SyncHostsContext is SyncHosts with a context
+func (m *Manager) SyncHostsContext(ctx context.Context) ([]HostEntry, error) {
+	release, err := m.lock(ctx, true)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	worktrees, err := m.ListWorktreesContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	basePath := m.resolvePath(m.Config.Worktree.BasePath)
+	var entries []HostEntry
+	for _, wt := range worktrees {
+		if filepath.Dir(wt.Path) != basePath {
+			// Skip the main checkout and worktrees grove didn't create
+			continue
+		}
+		entries = append(entries, HostEntry{
+			Host:    m.subdomain(worktreeBranch(wt)),
+			Address: m.hostsAddress(),
+		})
+	}
+
+	return entries, m.writeHostsEntries(ctx, entries)
+}
+
+// writeHostsEntries writes the block directly, or through the privileged
+// helper when the hosts file isn't writable by the current user
+func (m *Manager) writeHostsEntries(ctx context.Context, entries []HostEntry) error {
+	hosts := m.hostsFile()
+
+	err := hosts.Write(entries)
+	if err == nil || !errors.Is(err, os.ErrPermission) {
+		return err
+	}
+
+	return m.writeHostsEscalated(ctx, hosts, entries)
+}
+
+// writeHostsEscalated re-runs grove as `grove hosts apply` through the
+// configured escalation command, passing the entries on stdin
+func (m *Manager) writeHostsEscalated(ctx context.Context, hosts *HostsFile, entries []HostEntry) error {
+	escalate := m.Config.Web.Hosts.Escalate
+	if escalate == "" {
+		escalate = defaultHostsEscalate
+	}
+
+	self, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to locate grove executable: %w", err)
+	}
+
+	var input strings.Builder
+	for _, e := range entries {
+		fmt.Fprintf(&input, "%s %s\n", e.Address, e.Host)
+	}
+
+	args := append(strings.Fields(escalate), self, "hosts", "apply", "--file", hosts.Path, "--project", hosts.Project)
+	fmt.Printf("Updating %s requires elevated privileges (%s)\n", hosts.Path, args[0])
+
+	cmd := runner.Command(args[0], args[1:]...)
+	cmd.Stdin = strings.NewReader(input.String())
+	cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+	if _, err := m.run(ctx, cmd); err != nil {
+		return fmt.Errorf("privileged hosts update failed: %w", err)
+	}
+
+	return nil
+}
+
+func removeHostEntry(entries []HostEntry, host string) []HostEntry {
+	kept := entries[:0]
+	for _, e := range entries {
+		if e.Host != host {
+			kept = append(kept, e)
+		}
+	}
+	return kept
+}
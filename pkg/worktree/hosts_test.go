@@ -0,0 +1,146 @@
+package worktree
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const systemHosts = "127.0.0.1\tlocalhost\n::1\tlocalhost\n"
+
+func TestHostsFile_Render(t *testing.T) {
+	hosts := &HostsFile{Project: "testapp"}
+
+	tests := []struct {
+		name    string
+		content string
+		entries []HostEntry
+		want    string
+	}{
+		{
+			name:    "add block",
+			content: systemHosts,
+			entries: []HostEntry{
+				{Host: "main.app.test", Address: "127.0.0.1"},
+				{Host: "feature-auth.app.test", Address: "127.0.0.1"},
+			},
+			want: systemHosts + "\n# BEGIN grove testapp\n127.0.0.1\tfeature-auth.app.test\n127.0.0.1\tmain.app.test\n# END grove\n",
+		},
+		{
+			name:    "replace block",
+			content: systemHosts + "\n# BEGIN grove testapp\n127.0.0.1\told.app.test\n# END grove\n",
+			entries: []HostEntry{{Host: "main.app.test", Address: "127.0.0.1"}},
+			want:    systemHosts + "\n# BEGIN grove testapp\n127.0.0.1\tmain.app.test\n# END grove\n",
+		},
+		{
+			name:    "remove block",
+			content: systemHosts + "\n# BEGIN grove testapp\n127.0.0.1\told.app.test\n# END grove\n",
+			want:    systemHosts,
+		},
+		{
+			name:    "other projects untouched",
+			content: "# BEGIN grove other\n127.0.0.1\tmain.other.test\n# END grove\n",
+			entries: []HostEntry{{Host: "main.app.test", Address: "127.0.0.1"}},
+			want:    "# BEGIN grove other\n127.0.0.1\tmain.other.test\n# END grove\n\n# BEGIN grove testapp\n127.0.0.1\tmain.app.test\n# END grove\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := hosts.Render(tt.content, tt.entries)
+			if got != tt.want {
+				t.Errorf("Render() =\n%s\nwant:\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestManager_hostsEntries(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "hosts")
+	if err := os.WriteFile(path, []byte(systemHosts), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	manager := &Manager{
+		BaseDir: dir,
+		Config: &Config{
+			Project: ProjectConfig{Name: "testapp", Domain: "app.test"},
+			Web: WebConfig{
+				SubdomainPattern: "{branch}.{project_domain}",
+				Hosts:            HostsConfig{File: path},
+			},
+		},
+	}
+
+	route := manager.route("/tmp/worktrees/feature-auth", "feature-auth")
+	if err := manager.addHostsEntry(context.Background(), route); err != nil {
+		t.Fatalf("addHostsEntry() error = %v", err)
+	}
+	// Adding twice doesn't duplicate the entry
+	if err := manager.addHostsEntry(context.Background(), route); err != nil {
+		t.Fatalf("addHostsEntry() error = %v", err)
+	}
+
+	entries, err := manager.hostsFile().Entries()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []HostEntry{{Host: "feature-auth.app.test", Address: "127.0.0.1"}}
+	if !reflect.DeepEqual(entries, want) {
+		t.Errorf("Entries() = %v, want %v", entries, want)
+	}
+
+	if err := manager.removeHostsEntry(context.Background(), route); err != nil {
+		t.Fatalf("removeHostsEntry() error = %v", err)
+	}
+	content, _ := os.ReadFile(path)
+	if string(content) != systemHosts {
+		t.Errorf("Expected hosts file to be restored, got:\n%s", content)
+	}
+}
+
+func TestManager_useHostsFile(t *testing.T) {
+	tests := []struct {
+		domain string
+		mode   string
+		want   bool
+	}{
+		{domain: "app.lvh.me", want: false},
+		{domain: "app.localhost", want: false},
+		{domain: "10.0.0.1.nip.io", want: false},
+		{domain: "app.test", want: true},
+		{domain: "myapp.local", want: true},
+		{domain: "app.lvh.me", mode: "always", want: true},
+		{domain: "app.test", mode: "never", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.domain+"/"+tt.mode, func(t *testing.T) {
+			manager := &Manager{Config: &Config{
+				Project: ProjectConfig{Domain: tt.domain},
+				Web:     WebConfig{Hosts: HostsConfig{Mode: tt.mode}},
+			}}
+			if got := manager.useHostsFile(); got != tt.want {
+				t.Errorf("useHostsFile() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadHostEntries(t *testing.T) {
+	entries, err := ReadHostEntries(strings.NewReader("127.0.0.1 main.app.test\n\n::1 main.app.test\n"))
+	if err != nil {
+		t.Fatalf("ReadHostEntries() error = %v", err)
+	}
+	if len(entries) != 2 || entries[1].Address != "::1" {
+		t.Errorf("ReadHostEntries() = %v", entries)
+	}
+
+	if _, err := ReadHostEntries(strings.NewReader("127.0.0.1\n")); err == nil {
+		t.Error("Expected an error for a malformed entry")
+	}
+}
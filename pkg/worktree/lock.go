@@ -0,0 +1,239 @@
+package worktree
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+const (
+	rootLockFile = "grove.lock"
+	// DefaultLockTimeout is how long grove waits for another process to
+	// release the project lock
+	DefaultLockTimeout = 30 * time.Second
+	lockPollInterval   = 50 * time.Millisecond
+	// lockPIDEnv tells grove commands run from hooks that their parent
+	// already holds the project lock
+	lockPIDEnv = "GROVE_LOCK_PID"
+)
+
+// LockHolder describes the process holding the project lock exclusively
+type LockHolder struct {
+	PID     int       `json:"pid"`
+	Command string    `json:"command"`
+	Since   time.Time `json:"since"`
+}
+
+// LockError is returned when the project lock can't be taken in time
+type LockError struct {
+	// Holder is nil when the lock is shared by readers such as `grove list`
+	Holder  *LockHolder
+	Timeout time.Duration
+	// Stale is set when the recorded holder has exited, meaning a process it
+	// started still has the lock open
+	Stale bool
+}
+
+func (e *LockError) Error() string {
+	switch {
+	case e.Holder == nil:
+		return fmt.Sprintf("timed out after %s waiting for the grove lock held by another grove process", e.Timeout)
+	case e.Stale:
+		return fmt.Sprintf("timed out after %s waiting for the grove lock: PID %d (%s) has exited but a process it started still holds .grove/%s",
+			e.Timeout, e.Holder.PID, e.Holder.Command, rootLockFile)
+	}
+	return fmt.Sprintf("timed out after %s waiting for the grove lock held by PID %d (%s) since %s",
+		e.Timeout, e.Holder.PID, e.Holder.Command, e.Holder.Since.Local().Format("15:04:05"))
+}
+
+// lockPath returns the file locked around operations on the project
+func (m *Manager) lockPath() string {
+	return filepath.Join(m.BaseDir, ".grove", rootLockFile)
+}
+
+// lock takes the project lock, waiting up to LockTimeout for other grove
+// processes or until ctx is cancelled. Operations that change worktrees,
+// containers or .grove take it exclusively; readers share it. Nested calls
+// reuse the lock already held.
+func (m *Manager) lock(ctx context.Context, exclusive bool) (func(), error) {
+	release, ok, err := m.acquireLock(ctx, exclusive, true)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, fmt.Errorf("failed to lock %s", m.lockPath())
+	}
+	return release, nil
+}
+
+// tryLock takes the project lock if no other process holds it, reporting
+// whether it did
+func (m *Manager) tryLock(exclusive bool) (func(), bool, error) {
+	return m.acquireLock(context.Background(), exclusive, false)
+}
+
+func (m *Manager) acquireLock(ctx context.Context, exclusive, wait bool) (func(), bool, error) {
+	m.lockMu.Lock()
+	defer m.lockMu.Unlock()
+
+	if m.lockDepth > 0 {
+		if exclusive && !m.lockExclusive {
+			return nil, false, fmt.Errorf("cannot upgrade a shared grove lock to an exclusive one")
+		}
+		m.lockDepth++
+		return m.unlock, true, nil
+	}
+
+	// A hook running grove would otherwise wait on the process running it
+	if m.inheritedLock() {
+		m.lockExclusive = true
+		m.lockDepth = 1
+		return m.unlock, true, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(m.lockPath()), 0755); err != nil {
+		return nil, false, fmt.Errorf("failed to create .grove directory: %w", err)
+	}
+	f, err := os.OpenFile(m.lockPath(), os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to open lock file: %w", err)
+	}
+
+	timeout := m.LockTimeout
+	if timeout == 0 {
+		timeout = DefaultLockTimeout
+	}
+	deadline := time.Now().Add(timeout)
+	for {
+		ok, err := tryFlock(f, exclusive)
+		if err != nil {
+			f.Close()
+			return nil, false, fmt.Errorf("failed to lock %s: %w", m.lockPath(), err)
+		}
+		if ok {
+			break
+		}
+		if !wait {
+			f.Close()
+			return nil, false, nil
+		}
+		if time.Now().After(deadline) {
+			f.Close()
+			holder := readLockHolder(m.lockPath())
+			return nil, false, &LockError{
+				Holder:  holder,
+				Timeout: timeout,
+				Stale:   holder != nil && !processAlive(holder.PID),
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			f.Close()
+			return nil, false, ctx.Err()
+		case <-time.After(lockPollInterval):
+		}
+	}
+
+	// Readers share the lock, so only an exclusive holder records itself.
+	// A record left by a process that died holding the lock is overwritten.
+	if exclusive {
+		if err := writeLockHolder(f, m.lockCommand()); err != nil {
+			funlock(f)
+			f.Close()
+			return nil, false, err
+		}
+	}
+
+	m.lockFile = f
+	m.lockExclusive = exclusive
+	m.lockDepth = 1
+	return m.unlock, true, nil
+}
+
+// unlock releases one level of the project lock
+func (m *Manager) unlock() {
+	m.lockMu.Lock()
+	defer m.lockMu.Unlock()
+
+	if m.lockDepth == 0 {
+		return
+	}
+	if m.lockDepth--; m.lockDepth > 0 || m.lockFile == nil {
+		return
+	}
+	if m.lockExclusive {
+		m.lockFile.Truncate(0)
+	}
+	funlock(m.lockFile)
+	m.lockFile.Close()
+	m.lockFile = nil
+}
+
+// inheritedLock reports whether GROVE_LOCK_PID names the running holder of
+// the project lock
+func (m *Manager) inheritedLock() bool {
+	pid, err := strconv.Atoi(os.Getenv(lockPIDEnv))
+	if err != nil {
+		return false
+	}
+	holder := readLockHolder(m.lockPath())
+	return holder != nil && holder.PID == pid && processAlive(pid)
+}
+
+// lockEnv returns the environment passed to commands run while holding the
+// project lock exclusively
+func (m *Manager) lockEnv() []string {
+	m.lockMu.Lock()
+	defer m.lockMu.Unlock()
+
+	if m.lockDepth == 0 || !m.lockExclusive {
+		return nil
+	}
+	pid := os.Getpid()
+	if m.lockFile == nil {
+		// Pass on the lock this process inherited
+		pid, _ = strconv.Atoi(os.Getenv(lockPIDEnv))
+	}
+	return []string{fmt.Sprintf("%s=%d", lockPIDEnv, pid)}
+}
+
+// lockCommand names this process in the lock file
+func (m *Manager) lockCommand() string {
+	if m.Command != "" {
+		return m.Command
+	}
+	return filepath.Base(os.Args[0])
+}
+
+func writeLockHolder(f *os.File, command string) error {
+	data, err := json.Marshal(LockHolder{PID: os.Getpid(), Command: command, Since: time.Now()})
+	if err != nil {
+		return fmt.Errorf("failed to encode lock holder: %w", err)
+	}
+	if err := f.Truncate(0); err != nil {
+		return fmt.Errorf("failed to write lock file: %w", err)
+	}
+	if _, err := f.WriteAt(append(data, '\n'), 0); err != nil {
+		return fmt.Errorf("failed to write lock file: %w", err)
+	}
+	return nil
+}
+
+// readLockHolder returns the process recorded in the lock file, or nil when
+// the lock isn't held exclusively
+func readLockHolder(path string) *LockHolder {
+	data, err := os.ReadFile(path)
+	if err != nil || len(data) == 0 {
+		return nil
+	}
+	var holder LockHolder
+	if err := json.Unmarshal(data, &holder); err != nil || holder.PID == 0 {
+		return nil
+	}
+	return &holder
+}
@@ -0,0 +1,189 @@
+package worktree
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// newLockTestManagers returns two managers for the same project, standing in
+// for two grove processes
+func newLockTestManagers(t *testing.T) (*Manager, *Manager) {
+	t.Helper()
+	dir := t.TempDir()
+	a := &Manager{BaseDir: dir, Command: "grove create", LockTimeout: 100 * time.Millisecond}
+	b := &Manager{BaseDir: dir, Command: "grove remove", LockTimeout: 100 * time.Millisecond}
+	return a, b
+}
+
+func TestManager_lock_exclusive(t *testing.T) {
+	a, b := newLockTestManagers(t)
+
+	release, err := a.lock(context.Background(), true)
+	if err != nil {
+		t.Fatalf("lock() error = %v", err)
+	}
+
+	_, err = b.lock(context.Background(), true)
+	var lockErr *LockError
+	if !errors.As(err, &lockErr) {
+		t.Fatalf("second lock() error = %v, want a LockError", err)
+	}
+	if lockErr.Holder == nil || lockErr.Holder.PID != os.Getpid() || lockErr.Holder.Command != "grove create" {
+		t.Errorf("Holder = %+v, want this process running grove create", lockErr.Holder)
+	}
+	if lockErr.Stale {
+		t.Error("live holder reported as stale")
+	}
+	if _, ok, _ := b.tryLock(false); ok {
+		t.Error("tryLock(shared) succeeded while the lock is held exclusively")
+	}
+
+	release()
+	release2, err := b.lock(context.Background(), true)
+	if err != nil {
+		t.Fatalf("lock() after release error = %v", err)
+	}
+	release2()
+}
+
+func TestManager_lock_cancelled(t *testing.T) {
+	a, b := newLockTestManagers(t)
+	b.LockTimeout = time.Minute
+
+	release, err := a.lock(context.Background(), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer release()
+
+	// Cancelling stops the wait long before the lock timeout
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := b.lock(ctx, true); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("lock() error = %v, want the context's error", err)
+	}
+	if waited := time.Since(start); waited > 5*time.Second {
+		t.Errorf("lock() waited %s after the context was done", waited)
+	}
+}
+
+func TestManager_lock_shared(t *testing.T) {
+	a, b := newLockTestManagers(t)
+
+	releaseA, err := a.lock(context.Background(), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer releaseA()
+
+	releaseB, ok, err := b.tryLock(false)
+	if err != nil || !ok {
+		t.Fatalf("tryLock(shared) = %v, %v; want readers to share the lock", ok, err)
+	}
+	defer releaseB()
+
+	c := &Manager{BaseDir: a.BaseDir, LockTimeout: 100 * time.Millisecond}
+	_, err = c.lock(context.Background(), true)
+	var lockErr *LockError
+	if !errors.As(err, &lockErr) || lockErr.Holder != nil {
+		t.Errorf("exclusive lock() error = %v, want a LockError without a holder", err)
+	}
+}
+
+func TestManager_lock_nested(t *testing.T) {
+	a, _ := newLockTestManagers(t)
+
+	release, err := a.lock(context.Background(), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	inner, err := a.lock(context.Background(), false)
+	if err != nil {
+		t.Fatalf("nested lock() error = %v", err)
+	}
+	inner()
+	if a.lockFile == nil {
+		t.Fatal("releasing a nested lock released the outer one")
+	}
+	release()
+	if a.lockFile != nil {
+		t.Fatal("lock still held after the outer release")
+	}
+
+	release, err = a.lock(context.Background(), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer release()
+	if _, err := a.lock(context.Background(), true); err == nil {
+		t.Error("upgrading a shared lock succeeded")
+	}
+}
+
+func TestManager_lock_stale(t *testing.T) {
+	a, b := newLockTestManagers(t)
+
+	// A PID that has exited
+	cmd := exec.Command("true")
+	if err := cmd.Run(); err != nil {
+		t.Skip("true not available")
+	}
+	dead := cmd.Process.Pid
+	record := fmt.Sprintf(`{"pid": %d, "command": "grove create"}`, dead)
+
+	// A record left by a process that no longer holds the lock is ignored
+	if err := os.MkdirAll(a.BaseDir+"/.grove", 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(a.lockPath(), []byte(record), 0644); err != nil {
+		t.Fatal(err)
+	}
+	release, err := a.lock(context.Background(), true)
+	if err != nil {
+		t.Fatalf("lock() with a stale record error = %v", err)
+	}
+	if holder := readLockHolder(a.lockPath()); holder == nil || holder.PID != os.Getpid() {
+		t.Errorf("holder = %+v, want this process", holder)
+	}
+
+	// A lock still held under a dead holder's name is reported as stale
+	if err := os.WriteFile(a.lockPath(), []byte(record), 0644); err != nil {
+		t.Fatal(err)
+	}
+	_, err = b.lock(context.Background(), true)
+	var lockErr *LockError
+	if !errors.As(err, &lockErr) || !lockErr.Stale {
+		t.Errorf("lock() error = %v, want a stale LockError", err)
+	}
+	release()
+}
+
+func TestManager_lock_inherited(t *testing.T) {
+	a, b := newLockTestManagers(t)
+
+	release, err := a.lock(context.Background(), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer release()
+
+	env := a.lockEnv()
+	if len(env) != 1 || env[0] != lockPIDEnv+"="+strconv.Itoa(os.Getpid()) {
+		t.Fatalf("lockEnv() = %v", env)
+	}
+
+	// grove run from a hook shares its parent's lock
+	t.Setenv(lockPIDEnv, strconv.Itoa(os.Getpid()))
+	releaseB, err := b.lock(context.Background(), true)
+	if err != nil {
+		t.Fatalf("lock() from a hook error = %v", err)
+	}
+	releaseB()
+}
@@ -1,12 +1,20 @@
 package worktree
 
 import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strings"
+	"sync"
 	"text/template"
+	"time"
+
+	"github.com/glanotte/grove/pkg/git"
+	"github.com/glanotte/grove/pkg/runner"
 )
 
 // Manager handles git worktree operations
@@ -14,15 +22,57 @@ type Manager struct {
 	BaseDir    string
 	ConfigPath string
 	Config     *Config
+	// Env is the selected environment overlay, if any
+	Env string
+	// Passphrase unlocks .grove/secrets.enc, defaulting to
+	// GROVE_SECRETS_PASSPHRASE
+	Passphrase func() (string, error)
+	// LockTimeout bounds the wait for another grove process to release the
+	// project lock, defaulting to DefaultLockTimeout
+	LockTimeout time.Duration
+	// Command describes this process in the lock file, e.g. "grove create"
+	Command string
+	// Runner runs git, docker and other external commands, defaulting to
+	// runner.Exec
+	Runner runner.Runner
+	// Verbose echoes every external command to stderr before running it
+	Verbose bool
+
+	// worktreeDir is the worktree whose .grove-worktree.yaml was loaded
+	worktreeDir string
+	// sources records where each config value came from
+	sources map[string]string
+	// secretCache holds the secret references resolved so far
+	secretsMu   sync.Mutex
+	secretCache map[string]secretResult
+	secretStore map[string]string
+	// dbDriver overrides the configured database driver
+	dbDriver DatabaseDriver
+	// lockFile is the held project lock, shared by nested operations
+	lockMu        sync.Mutex
+	lockFile      *os.File
+	lockDepth     int
+	lockExclusive bool
 }
 
 // NewManager creates a new worktree manager
 func NewManager(baseDir string) (*Manager, error) {
-	configPath := filepath.Join(baseDir, ".grove", "config.yaml")
+	return NewManagerWithOptions(baseDir, Options{})
+}
+
+// NewManagerWithOptions creates a worktree manager with a custom config path,
+// environment or worktree-local config
+func NewManagerWithOptions(baseDir string, opts Options) (*Manager, error) {
+	configPath := opts.ConfigPath
+	if configPath == "" {
+		configPath = filepath.Join(baseDir, ".grove", "config.yaml")
+	}
 
 	m := &Manager{
-		BaseDir:    baseDir,
-		ConfigPath: configPath,
+		BaseDir:     baseDir,
+		ConfigPath:  configPath,
+		Env:         opts.Env,
+		worktreeDir: opts.WorktreeDir,
 	}
 
 	if err := m.loadConfig(); err != nil {
@@ -32,120 +82,430 @@ func NewManager(baseDir string) (*Manager, error) {
 	return m, nil
 }
 
+// git returns the project's repository, running git through the Manager
+func (m *Manager) git() *git.Repo {
+	return git.New(m.BaseDir, managerRunner{m})
+}
+
+// managerRunner runs commands with Manager.run, so they are echoed in
+// verbose mode
+type managerRunner struct {
+	m *Manager
+}
+
+func (r managerRunner) Run(ctx context.Context, cmd runner.Cmd) (runner.Result, error) {
+	return r.m.run(ctx, cmd)
+}
+
+// run runs an external command with the Manager's Runner
+func (m *Manager) run(ctx context.Context, cmd runner.Cmd) (runner.Result, error) {
+	if m.Verbose {
+		line := cmd.String()
+		if cmd.Dir != "" && cmd.Dir != m.BaseDir {
+			line = fmt.Sprintf("(cd %s && %s)", m.relPath(cmd.Dir), line)
+		}
+		fmt.Fprintf(os.Stderr, "+ %s\n", m.redact(line))
+	}
+
+	r := m.Runner
+	if r == nil {
+		r = runner.Exec{}
+	}
+	return r.Run(ctx, cmd)
+}
+
+// CreateOptions configures a new worktree
+type CreateOptions struct {
+	BaseBranch string
+	Template   string
+	// DBFrom names a worktree whose database is cloned into the new one
+	DBFrom string
+}
+
 // CreateWorktree creates a new git worktree with templates
 func (m *Manager) CreateWorktree(branchName, baseBranch, templateName string) error {
-	// Sanitize branch name for use in paths and subdomains
-	safeBranchName := m.sanitizeBranchName(branchName)
+	return m.CreateWorktreeContext(context.Background(), branchName, baseBranch, templateName)
+}
+
+// CreateWorktreeContext is CreateWorktree with a context
+func (m *Manager) CreateWorktreeContext(ctx context.Context, branchName, baseBranch, templateName string) error {
+	return m.CreateContext(ctx, branchName, CreateOptions{BaseBranch: baseBranch, Template: templateName})
+}
+
+// Create creates a new git worktree with templates, containers, proxy route
+// and database as configured
+func (m *Manager) Create(branchName string, opts CreateOptions) error {
+	return m.CreateContext(context.Background(), branchName, opts)
+}
+
+// CreateContext is Create with a context. When a step fails, times out or
+// ctx is cancelled, everything set up so far is rolled back.
+func (m *Manager) CreateContext(ctx context.Context, branchName string, opts CreateOptions) (err error) {
+	release, err := m.lock(ctx, true)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	var undo rollback
+	defer func() {
+		if err != nil {
+			undo.run(ctx)
+		}
+	}()
+
+	baseBranch, templateName := opts.BaseBranch, opts.Template
+
+	// Resolve the clone source before touching anything
+	var dbSource WorktreeInfo
+	if opts.DBFrom != "" {
+		if !m.Config.Database.Enabled {
+			return fmt.Errorf("--db-from requires databases to be enabled in the grove config")
+		}
+		src, err := m.findWorktree(ctx, opts.DBFrom)
+		if err != nil {
+			return err
+		}
+		dbSource = src
+	}
+
+	// Refuse to overwrite the record of a worktree that still exists. A
+	// stale record is replaced, and put back if the create fails.
+	state, err := m.loadState()
+	if err != nil {
+		return err
+	}
+	previous, recorded := state.Worktrees[branchName]
+	if recorded {
+		if _, err := os.Stat(previous.Path); err == nil {
+			return fmt.Errorf("branch '%s' already has a worktree at %s", branchName, previous.Path)
+		}
+	}
 
-	// Calculate worktree path
-	worktreePath := m.getWorktreePath(safeBranchName)
+	// Pick a collision-free name for paths, subdomains and containers
+	slug, err := m.reserveBranchSlug(branchName)
+	if err != nil {
+		return err
+	}
+
+	// Record the worktree so later lookups reuse its slug. The branch ID is
+	// allocated under the same lock, so the path is calculated here too,
+	// fixing {branch_id}, {user} and {date} for the worktree's lifetime
+	created := WorktreeState{
+		User: m.sanitizeBranchName(currentUser()),
+		Date: placeholderDate(time.Now()),
+	}
+	var worktreePath string
+	err = m.updateState(func(state *State) error {
+		id, err := m.allocateBranchID(state, branchName)
+		if err != nil {
+			return err
+		}
+		created.BranchID = id
+		worktreePath = m.getWorktreePath(expandPlaceholders(m.worktreeNamePattern(), m.worktreePlaceholders(branchName, slug, created)))
+
+		wt := WorktreeState{
+			Branch:     branchName,
+			Slug:       slug,
+			BranchID:   id,
+			Path:       worktreePath,
+			CreatedAt:  time.Now(),
+			User:       created.User,
+			Date:       created.Date,
+			BaseBranch: baseBranch,
+			Template:   templateName,
+			Env:        m.Env,
+		}
+		if wt.Template == "" {
+			wt.Template = m.Config.Templates.Default
+		}
+		if m.Config.Docker.Enabled {
+			wt.Port = m.calculatePort(slug)
+		}
+		if err := m.generateVariables(&wt); err != nil {
+			return err
+		}
+		state.Worktrees[branchName] = wt
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to record worktree: %w", err)
+	}
+	undo.add("restore the worktree's previous state", func(context.Context) error {
+		if recorded {
+			return m.restoreWorktreeState(branchName, &previous)
+		}
+		return m.restoreWorktreeState(branchName, nil)
+	})
+
+	vars := m.buildTemplateContext(ctx, worktreePath, branchName)
+	if err := m.runHook(ctx, HookPreCreate, m.BaseDir, vars); err != nil {
+		return err
+	}
 
 	// Create git worktree
-	if err := m.createGitWorktree(worktreePath, branchName, baseBranch); err != nil {
+	if err := m.createGitWorktree(ctx, &undo, worktreePath, branchName, baseBranch); err != nil {
 		return fmt.Errorf("failed to create git worktree: %w", err)
 	}
 
 	// Process templates
-	if err := m.processTemplates(worktreePath, branchName, templateName); err != nil {
-		return fmt.Errorf("failed to process templates: %w", err)
+	if err := m.renderTemplates(ctx, worktreePath, branchName, templateName); err != nil {
+		return err
 	}
 
 	// Setup Docker if enabled
 	if m.Config.Docker.Enabled {
-		if err := m.setupDocker(worktreePath, safeBranchName); err != nil {
+		if err := m.setupDocker(ctx, worktreePath, branchName); err != nil {
 			return fmt.Errorf("failed to setup Docker: %w", err)
 		}
 	}
 
 	// Setup web proxy if enabled
 	if m.Config.Web.Enabled {
-		if err := m.setupWebProxy(safeBranchName); err != nil {
+		undo.add("remove the web proxy route", func(ctx context.Context) error {
+			return m.teardownWebProxy(ctx, WorktreeInfo{Path: worktreePath, Branch: branchName})
+		})
+		if err := m.setupWebProxy(ctx, worktreePath, branchName); err != nil {
 			return fmt.Errorf("failed to setup web proxy: %w", err)
 		}
+		host := m.route(worktreePath, branchName).Host
+		err := m.updateState(func(state *State) error {
+			wt := state.Worktrees[branchName]
+			wt.Host = host
+			state.Worktrees[branchName] = wt
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("failed to record proxy route: %w", err)
+		}
 	}
 
+	// Provision the database on a shared server. A worktree's own database
+	// service is provisioned on `grove up`, once it is running.
+	if opts.DBFrom != "" {
+		if err := m.cloneDatabase(ctx, &undo, dbSource, worktreePath, branchName, false); err != nil {
+			return fmt.Errorf("failed to clone database: %w", err)
+		}
+	} else if m.Config.Database.Enabled && m.Config.Database.Service == "" {
+		if err := m.provisionDatabase(ctx, &undo, worktreePath, branchName); err != nil {
+			return fmt.Errorf("failed to provision database: %w", err)
+		}
+	}
+
+	m.runPostHook(ctx, HookPostCreate, worktreePath, vars)
+
 	return nil
 }
 
-// loadConfig loads the configuration file
-func (m *Manager) loadConfig() error {
-	// In a real implementation, this would use viper or yaml.Unmarshal
-	// For now, we'll use a default config
-	m.Config = &Config{
-		Version: 1,
-		Project: ProjectConfig{
-			Name:   "myapp",
-			Domain: "app.lvh.me",
-		},
-		Worktree: WorktreeConfig{
-			BasePath:      "./worktrees",
-			NamingPattern: "{branch}",
-		},
-		Docker: DockerConfig{
-			Enabled:     true,
-			ComposeFile: "docker-compose.yml",
-			PortOffset:  10000,
-			NetworkName: "{project_name}_network",
-		},
-		Web: WebConfig{
-			Enabled:          true,
-			ProxyType:        "nginx-proxy",
-			SubdomainPattern: "{branch}.{project_domain}",
-		},
-		Variables: make(map[string]interface{}),
+// restoreWorktreeState puts back a branch's state entry after a failed
+// create, dropping it when there was none before
+func (m *Manager) restoreWorktreeState(branchName string, previous *WorktreeState) error {
+	return m.updateState(func(state *State) error {
+		if previous == nil {
+			delete(state.Worktrees, branchName)
+			return nil
+		}
+		state.Worktrees[branchName] = *previous
+		return nil
+	})
+}
+
+// renderTemplates processes the worktree's templates between the pre_render
+// and post_render hooks
+func (m *Manager) renderTemplates(ctx context.Context, worktreePath, branchName, templateName string) error {
+	if err := m.ensureGenerated(worktreePath, branchName); err != nil {
+		return err
 	}
+
+	vars := m.buildTemplateContext(ctx, worktreePath, branchName)
+	if err := m.runHook(ctx, HookPreRender, worktreePath, vars); err != nil {
+		return err
+	}
+
+	if err := m.processTemplates(ctx, worktreePath, branchName, templateName); err != nil {
+		return fmt.Errorf("failed to process templates: %w", err)
+	}
+
+	m.runPostHook(ctx, HookPostRender, worktreePath, vars)
 	return nil
 }
 
-// sanitizeBranchName makes a branch name safe for use in URLs and paths
+// Render re-processes an existing worktree's templates
+func (m *Manager) Render(name, templateName string) error {
+	return m.RenderContext(context.Background(), name, templateName)
+}
+
+// RenderContext is Render with a context
+func (m *Manager) RenderContext(ctx context.Context, name, templateName string) error {
+	release, err := m.lock(ctx, true)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	wt, err := m.findWorktree(ctx, name)
+	if err != nil {
+		return err
+	}
+	branchName := worktreeBranch(wt)
+
+	// Default to the template the worktree was created with
+	if templateName == "" {
+		if state, err := m.loadState(); err == nil {
+			templateName = state.Worktrees[branchName].Template
+		}
+	}
+	return m.renderTemplates(ctx, wt.Path, branchName, templateName)
+}
+
+// sanitizeBranchName makes a branch name safe for use as a DNS label, path
+// and Docker name
 func (m *Manager) sanitizeBranchName(branchName string) string {
-	// Replace slashes with dashes
-	safe := strings.ReplaceAll(branchName, "/", "-")
-	// Replace other problematic characters
-	safe = strings.ReplaceAll(safe, "_", "-")
-	// Convert to lowercase for consistency
-	safe = strings.ToLower(safe)
+	// Lowercase and collapse anything outside [a-z0-9] into single dashes
+	var b strings.Builder
+	dash := false
+	for _, c := range strings.ToLower(branchName) {
+		if (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') {
+			b.WriteRune(c)
+			dash = false
+		} else if !dash {
+			b.WriteByte('-')
+			dash = true
+		}
+	}
+	safe := strings.Trim(b.String(), "-")
+
+	if safe == "" {
+		return shortHash(branchName)
+	}
+	if len(safe) > maxLabelLength {
+		return withHashSuffix(safe, branchName)
+	}
 	return safe
 }
 
-// getWorktreePath returns the full path for a worktree
-func (m *Manager) getWorktreePath(safeBranchName string) string {
-	basePath := m.Config.Worktree.BasePath
-	if !filepath.IsAbs(basePath) {
-		basePath = filepath.Join(m.BaseDir, basePath)
+// withHashSuffix appends a short hash of branchName to slug, truncating it so
+// the result still fits in a DNS label
+func withHashSuffix(slug, branchName string) string {
+	suffix := shortHash(branchName)
+	if max := maxLabelLength - len(suffix) - 1; len(slug) > max {
+		slug = strings.TrimRight(slug[:max], "-")
 	}
-	return filepath.Join(basePath, safeBranchName)
+	return slug + "-" + suffix
+}
+
+// shortHash returns a short, stable hex digest of s
+func shortHash(s string) string {
+	sum := sha1.Sum([]byte(s))
+	return hex.EncodeToString(sum[:])[:6]
 }
 
-// createGitWorktree creates the actual git worktree
-func (m *Manager) createGitWorktree(path, branchName, baseBranch string) error {
-	// Check if branch exists
-	checkCmd := exec.Command("git", "show-ref", "--verify", "--quiet", fmt.Sprintf("refs/heads/%s", branchName))
-	checkCmd.Dir = m.BaseDir
+// branchSlug returns the name used for {branch}: the slug recorded in the
+// grove state, or the sanitized branch name for branches grove doesn't know
+func (m *Manager) branchSlug(branchName string) string {
+	if state, err := m.loadState(); err == nil {
+		if wt, ok := state.Worktrees[branchName]; ok && wt.Slug != "" {
+			return wt.Slug
+		}
+	}
+	return m.sanitizeBranchName(branchName)
+}
 
-	branchExists := checkCmd.Run() == nil
+// reserveBranchSlug picks the slug for a new worktree. Branches that sanitize
+// to a slug already used by another worktree, or whose directory is already
+// taken, get a hash suffix derived from the branch name so the choice is
+// deterministic.
+func (m *Manager) reserveBranchSlug(branchName string) (string, error) {
+	state, err := m.loadState()
+	if err != nil {
+		return "", err
+	}
+	if wt, ok := state.Worktrees[branchName]; ok && wt.Slug != "" {
+		return wt.Slug, nil
+	}
 
-	if branchExists {
-		// Add worktree for existing branch
-		cmd := exec.Command("git", "worktree", "add", path, branchName)
-		cmd.Dir = m.BaseDir
-		if output, err := cmd.CombinedOutput(); err != nil {
-			return fmt.Errorf("git worktree add failed: %s", output)
+	taken := func(slug string) bool {
+		for branch, wt := range state.Worktrees {
+			if branch != branchName && wt.Slug == slug {
+				return true
+			}
 		}
-	} else {
-		// Create new branch and worktree
-		cmd := exec.Command("git", "worktree", "add", "-b", branchName, path, baseBranch)
-		cmd.Dir = m.BaseDir
-		if output, err := cmd.CombinedOutput(); err != nil {
-			return fmt.Errorf("git worktree add failed: %s", output)
+		path := m.getWorktreePath(m.expandSlug(m.worktreeNamePattern(), branchName, slug))
+		_, err := os.Stat(path)
+		return err == nil
+	}
+
+	slug := m.sanitizeBranchName(branchName)
+	if !taken(slug) {
+		return slug, nil
+	}
+
+	disambiguated := withHashSuffix(slug, branchName)
+	if taken(disambiguated) {
+		return "", fmt.Errorf("branch '%s' collides with an existing worktree as '%s'", branchName, slug)
+	}
+
+	fmt.Printf("Branch '%s' collides with an existing worktree, using '%s'\n", branchName, disambiguated)
+	return disambiguated, nil
+}
+
+// getWorktreePath returns the full path for a worktree
+func (m *Manager) getWorktreePath(worktreeName string) string {
+	return filepath.Join(m.resolvePath(m.Config.Worktree.BasePath), worktreeName)
+}
+
+// createGitWorktree creates the actual git worktree, checking out the
+// branch or creating it from baseBranch, and adds its removal to undo
+func (m *Manager) createGitWorktree(ctx context.Context, undo *rollback, path, branchName, baseBranch string) error {
+	repo := m.git()
+
+	var exists bool
+	err := m.withTimeout(ctx, stepGit, "git show-ref", func(ctx context.Context) error {
+		var err error
+		exists, err = repo.BranchExists(ctx, branchName)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	err = m.withTimeout(ctx, stepGit, "git worktree add", func(ctx context.Context) error {
+		if exists {
+			return repo.AddWorktree(ctx, path, branchName)
 		}
+		return repo.AddWorktreeNewBranch(ctx, path, branchName, baseBranch)
+	})
+	// An interrupted git may have registered the worktree already, but any
+	// other failure means git left nothing behind
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		undo.add("remove the git worktree", func(ctx context.Context) error {
+			return m.removeGitWorktree(ctx, path, branchName, !exists)
+		})
 	}
+	return err
+}
 
-	return nil
+// removeGitWorktree undoes createGitWorktree, deleting the branch too when
+// it was created with the worktree
+func (m *Manager) removeGitWorktree(ctx context.Context, path, branchName string, deleteBranch bool) error {
+	repo := m.git()
+
+	err := m.withTimeout(ctx, stepGit, "git worktree remove", func(ctx context.Context) error {
+		return repo.RemoveWorktree(ctx, path, true)
+	})
+	if err != nil {
+		return err
+	}
+	if !deleteBranch {
+		return nil
+	}
+	return m.withTimeout(ctx, stepGit, "git branch", func(ctx context.Context) error {
+		return repo.DeleteBranch(ctx, branchName, true)
+	})
 }
 
 // processTemplates processes all template files for the worktree
-func (m *Manager) processTemplates(worktreePath, branchName, templateName string) error {
+func (m *Manager) processTemplates(ctx context.Context, worktreePath, branchName, templateName string) error {
 	if templateName == "" {
 		templateName = m.Config.Templates.Default
 	}
@@ -156,11 +516,15 @@ func (m *Manager) processTemplates(worktreePath, branchName, templateName string
 		return nil
 	}
 
+	if err := m.checkGenerated(branchName); err != nil {
+		return err
+	}
+
 	// Build template context
-	ctx := m.buildTemplateContext(worktreePath, branchName)
+	vars := m.buildTemplateContext(ctx, worktreePath, branchName)
 
 	for _, file := range templateDef.Files {
-		if err := m.processTemplateFile(worktreePath, file, ctx); err != nil {
+		if err := m.processTemplateFile(worktreePath, file, vars); err != nil {
 			return fmt.Errorf("failed to process template %s: %w", file.Src, err)
 		}
 	}
@@ -169,30 +533,63 @@ func (m *Manager) processTemplates(worktreePath, branchName, templateName string
 }
 
 // buildTemplateContext creates the context for template processing
-func (m *Manager) buildTemplateContext(worktreePath, branchName string) map[string]interface{} {
-	safeBranchName := m.sanitizeBranchName(branchName)
+func (m *Manager) buildTemplateContext(ctx context.Context, worktreePath, branchName string) map[string]interface{} {
+	safeBranchName := m.branchSlug(branchName)
 
-	ctx := make(map[string]interface{})
+	vars := make(map[string]interface{})
 
 	// Standard variables
-	ctx["BranchName"] = safeBranchName
-	ctx["OriginalBranchName"] = branchName
-	ctx["WorktreePath"] = worktreePath
-	ctx["ProjectName"] = m.Config.Project.Name
-	ctx["ProjectDomain"] = m.Config.Project.Domain
+	vars["BranchName"] = safeBranchName
+	vars["OriginalBranchName"] = branchName
+	vars["WorktreePath"] = worktreePath
+	vars["ProjectName"] = m.Config.Project.Name
+	vars["ProjectDomain"] = m.Config.Project.Domain
+	vars["Environment"] = m.Env
+	vars["BranchID"] = m.branchID(branchName)
+	if db, err := m.redisDB(branchName); err == nil {
+		vars["RedisDB"] = db
+	}
 
 	// Docker variables
 	if m.Config.Docker.Enabled {
-		ctx["NetworkName"] = strings.ReplaceAll(m.Config.Docker.NetworkName, "{project_name}", m.Config.Project.Name)
-		ctx["WebPort"] = m.calculatePort(safeBranchName)
+		vars["NetworkName"] = m.networkName(branchName)
+		vars["ContainerPrefix"] = m.containerPrefix(branchName)
+		vars["WebPort"] = m.calculatePort(safeBranchName)
+		vars["BuildArgs"] = m.Config.Docker.BuildArgs
+	}
+
+	// Database variables
+	if m.Config.Database.Enabled {
+		vars["DatabaseName"] = m.databaseName(branchName)
+		if driver, err := m.database(ctx, worktreePath); err == nil {
+			vars["DatabaseURL"] = driver.URL(m.databaseName(branchName))
+		}
 	}
 
-	// Custom variables
+	// Proxy variables
+	if m.Config.Web.Enabled && m.Config.Web.ProxyType == "traefik" && m.Config.Web.Traefik.Labels {
+		p := &traefikProxy{m: m}
+		vars["TraefikLabels"] = p.labels(m.route(worktreePath, branchName))
+	}
+
+	// Custom variables; secret references resolve when a template uses them
+	// and generated values come from the grove state
+	var generated map[string]string
+	if m.hasGeneratedVariables() {
+		generated = m.generatedValues(branchName)
+	}
 	for k, v := range m.Config.Variables {
-		ctx[k] = v
+		if _, ok, _ := parseGenerateSpec(v); ok {
+			// Missing values are reported by checkGenerated before rendering
+			if value, exists := generated[k]; exists {
+				vars[k] = value
+			}
+			continue
+		}
+		vars[k] = m.wrapSecrets(ctx, v)
 	}
 
-	return ctx
+	return vars
 }
 
 // processTemplateFile processes a single template file
@@ -226,34 +623,37 @@ func (m *Manager) processTemplateFile(worktreePath string, file TemplateFile, ct
 	defer destFile.Close()
 
 	if err := tmpl.Execute(destFile, ctx); err != nil {
-		return fmt.Errorf("failed to execute template: %w", err)
+		return fmt.Errorf("failed to execute template: %s", m.redact(err.Error()))
 	}
 
-	return nil
+	return secretError(ctx)
 }
 
 // calculatePort generates a unique port based on branch name
 func (m *Manager) calculatePort(branchName string) int {
-	// Simple hash-based port assignment
+	// Simple hash-based port assignment, wrapped to fit the range
+	ports := m.Config.Docker.Ports
+	offset := branchHash(branchName)
+	if span := ports.RangeEnd - ports.RangeStart + 1; ports.RangeEnd != 0 && offset >= span {
+		offset %= span
+	}
+	return ports.RangeStart + offset
+}
+
+// branchHash maps a branch name to a stable number below 1000
+func branchHash(branchName string) int {
 	hash := 0
 	for _, c := range branchName {
 		hash = (hash*31 + int(c)) % 1000
 	}
-	return m.Config.Docker.PortOffset + hash
+	return hash
 }
 
 // setupDocker sets up Docker containers for the worktree
-func (m *Manager) setupDocker(worktreePath, branchName string) error {
+func (m *Manager) setupDocker(ctx context.Context, worktreePath, branchName string) error {
 	// Ensure Docker network exists
-	networkName := strings.ReplaceAll(m.Config.Docker.NetworkName, "{project_name}", m.Config.Project.Name)
-
-	checkCmd := exec.Command("docker", "network", "inspect", networkName)
-	if err := checkCmd.Run(); err != nil {
-		// Create network if it doesn't exist
-		createCmd := exec.Command("docker", "network", "create", networkName)
-		if output, err := createCmd.CombinedOutput(); err != nil {
-			return fmt.Errorf("failed to create Docker network: %s", output)
-		}
+	if err := m.ensureNetwork(ctx, m.networkName(branchName)); err != nil {
+		return err
 	}
 
 	// Start containers (optional - could be manual)
@@ -266,76 +666,303 @@ func (m *Manager) setupDocker(worktreePath, branchName string) error {
 	return nil
 }
 
+// ensureNetwork creates a Docker network if it doesn't exist yet
+func (m *Manager) ensureNetwork(ctx context.Context, networkName string) error {
+	if _, err := m.runStep(ctx, stepDocker, runner.Command("docker", "network", "inspect", networkName)); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		// Create network if it doesn't exist
+		result, err := m.runStep(ctx, stepDocker, runner.Command("docker", "network", "create", networkName))
+		if err != nil {
+			return fmt.Errorf("failed to create Docker network: %s", commandOutput(result, err))
+		}
+	}
+	return nil
+}
+
+// compose returns a docker-compose command for the worktree's compose file
+func (m *Manager) compose(worktreePath string, args ...string) runner.Cmd {
+	cmd := runner.Command("docker-compose", append([]string{"-f", m.Config.Docker.ComposeFile}, args...)...)
+	cmd.Dir = worktreePath
+	return cmd
+}
+
+// commandOutput describes a failed command by its output, or by the error
+// when it printed nothing
+func commandOutput(result runner.Result, err error) string {
+	if output := result.Output(); output != "" {
+		return output
+	}
+	return err.Error()
+}
+
 // setupWebProxy configures the web proxy for the worktree
-func (m *Manager) setupWebProxy(branchName string) error {
-	subdomain := strings.ReplaceAll(m.Config.Web.SubdomainPattern, "{branch}", branchName)
-	subdomain = strings.ReplaceAll(subdomain, "{project_domain}", m.Config.Project.Domain)
+func (m *Manager) setupWebProxy(ctx context.Context, worktreePath, branchName string) error {
+	route := m.route(worktreePath, branchName)
+
+	backend, err := m.proxyBackend()
+	if err != nil {
+		return err
+	}
+
+	if m.localCertificates() {
+		if err := m.ensureCertificate(ctx, route); err != nil {
+			return fmt.Errorf("failed to issue certificate: %w", err)
+		}
+	}
+
+	if backend != nil {
+		err := m.withTimeout(ctx, stepProxy, "registering "+route.Host, func(ctx context.Context) error {
+			return backend.Register(ctx, route)
+		})
+		if err != nil {
+			return err
+		}
+	}
 
-	fmt.Printf("Web URL: https://%s\n", subdomain)
+	if m.useHostsFile() {
+		if err := m.addHostsEntry(ctx, route); err != nil {
+			return fmt.Errorf("failed to update hosts file: %w", err)
+		}
+	}
+
+	fmt.Printf("Web URL: https://%s\n", route.Host)
+
+	return nil
+}
+
+// teardownWebProxy removes the proxy route for the worktree
+func (m *Manager) teardownWebProxy(ctx context.Context, wt WorktreeInfo) error {
+	route := m.route(wt.Path, worktreeBranch(wt))
+
+	backend, err := m.proxyBackend()
+	if err != nil {
+		return err
+	}
+	if backend != nil {
+		err := m.withTimeout(ctx, stepProxy, "removing "+route.Host, func(ctx context.Context) error {
+			return backend.Unregister(ctx, route)
+		})
+		if err != nil {
+			return err
+		}
+	}
 
-	// In a real implementation, this would:
-	// - Update nginx-proxy configuration
-	// - Or update Traefik labels
-	// - Or update /etc/hosts
+	if m.useHostsFile() {
+		if err := m.removeHostsEntry(ctx, route); err != nil {
+			return fmt.Errorf("failed to update hosts file: %w", err)
+		}
+	}
 
+	if m.localCertificates() {
+		return m.removeCertificate(route)
+	}
 	return nil
 }
 
 // ListWorktrees lists all active worktrees
 func (m *Manager) ListWorktrees() ([]WorktreeInfo, error) {
-	cmd := exec.Command("git", "worktree", "list", "--porcelain")
-	cmd.Dir = m.BaseDir
+	return m.ListWorktreesContext(context.Background())
+}
 
-	output, err := cmd.Output()
+// ListWorktreesContext is ListWorktrees with a context
+func (m *Manager) ListWorktreesContext(ctx context.Context) ([]WorktreeInfo, error) {
+	// A shared lock keeps writers out while git is read, but listing never
+	// waits for one to finish
+	release, locked, err := m.tryLock(false)
+	if err != nil {
+		return nil, err
+	}
+	if locked {
+		defer release()
+	}
+
+	var entries []git.Worktree
+	err = m.withTimeout(ctx, stepGit, "git worktree list", func(ctx context.Context) error {
+		var err error
+		entries, err = m.git().ListWorktrees(ctx)
+		return err
+	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to list worktrees: %w", err)
 	}
 
-	// Parse the output and build WorktreeInfo list
-	// This is simplified - real implementation would properly parse porcelain output
-	var worktrees []WorktreeInfo
+	worktrees := make([]WorktreeInfo, 0, len(entries))
+	for _, entry := range entries {
+		wt := WorktreeInfo{Path: entry.Path, Branch: entry.Branch}
+		if m.Config.Web.Enabled {
+			wt.URL = "https://" + m.subdomain(worktreeBranch(wt))
+		}
+		worktrees = append(worktrees, wt)
+	}
+
+	return worktrees, nil
+}
 
-	lines := strings.Split(string(output), "\n")
-	for i := 0; i < len(lines); i += 4 {
-		if i+2 >= len(lines) {
-			break
+// findWorktree looks up a worktree by directory or branch name
+func (m *Manager) findWorktree(ctx context.Context, name string) (WorktreeInfo, error) {
+	worktrees, err := m.ListWorktreesContext(ctx)
+	if err != nil {
+		return WorktreeInfo{}, err
+	}
+
+	for _, wt := range worktrees {
+		if filepath.Base(wt.Path) == name || wt.Branch == name {
+			return wt, nil
 		}
+	}
 
-		if strings.HasPrefix(lines[i], "worktree ") {
-			path := strings.TrimPrefix(lines[i], "worktree ")
-			branch := ""
-			if strings.HasPrefix(lines[i+2], "branch ") {
-				branch = strings.TrimPrefix(lines[i+2], "branch refs/heads/")
-			}
+	return WorktreeInfo{}, fmt.Errorf("worktree '%s' not found", name)
+}
 
-			worktrees = append(worktrees, WorktreeInfo{
-				Path:   path,
-				Branch: branch,
+// worktreeBranch returns the branch a worktree's names are derived from,
+// falling back to the directory name for detached checkouts
+func worktreeBranch(wt WorktreeInfo) string {
+	if wt.Branch != "" {
+		return wt.Branch
+	}
+	return filepath.Base(wt.Path)
+}
+
+// Up starts the worktree's containers and finishes proxy setup that needs
+// running containers
+func (m *Manager) Up(name string) error {
+	return m.UpContext(context.Background(), name)
+}
+
+// UpContext is Up with a context
+func (m *Manager) UpContext(ctx context.Context, name string) error {
+	release, err := m.lock(ctx, true)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	wt, err := m.findWorktree(ctx, name)
+	if err != nil {
+		return err
+	}
+	worktreePath := wt.Path
+
+	vars := m.buildTemplateContext(ctx, worktreePath, worktreeBranch(wt))
+	if err := m.runHook(ctx, HookPreUp, worktreePath, vars); err != nil {
+		return err
+	}
+
+	up := m.compose(worktreePath, "up", "-d")
+	up.Stdout, up.Stderr = os.Stdout, os.Stderr
+	if _, err := m.runStep(ctx, stepDocker, up); err != nil {
+		return fmt.Errorf("docker-compose up failed: %w", err)
+	}
+
+	if m.Config.Database.Enabled && m.Config.Database.Service != "" {
+		// Wait for the database service before creating and seeding it
+		if err := m.waitHealthy(ctx, worktreePath); err != nil {
+			return err
+		}
+		if err := m.provisionDatabase(ctx, nil, worktreePath, worktreeBranch(wt)); err != nil {
+			return fmt.Errorf("failed to provision database: %w", err)
+		}
+	}
+
+	if m.Config.Web.Enabled {
+		backend, err := m.proxyBackend()
+		if err != nil {
+			return err
+		}
+		if starter, ok := backend.(proxyStarter); ok {
+			route := m.route(worktreePath, worktreeBranch(wt))
+			err := m.withTimeout(ctx, stepProxy, "proxy setup for "+route.Host, func(ctx context.Context) error {
+				return starter.AfterUp(ctx, route)
 			})
+			if err != nil {
+				return fmt.Errorf("failed to finish web proxy setup: %w", err)
+			}
 		}
 	}
 
-	return worktrees, nil
+	m.runPostHook(ctx, HookPostUp, worktreePath, vars)
+	return nil
+}
+
+// Down stops the worktree's containers
+func (m *Manager) Down(name string) error {
+	return m.DownContext(context.Background(), name)
+}
+
+// DownContext is Down with a context
+func (m *Manager) DownContext(ctx context.Context, name string) error {
+	release, err := m.lock(ctx, true)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	wt, err := m.findWorktree(ctx, name)
+	if err != nil {
+		return err
+	}
+	worktreePath := wt.Path
+
+	vars := m.buildTemplateContext(ctx, worktreePath, worktreeBranch(wt))
+	if err := m.runHook(ctx, HookPreDown, worktreePath, vars); err != nil {
+		return err
+	}
+
+	down := m.compose(worktreePath, "down")
+	down.Stdout, down.Stderr = os.Stdout, os.Stderr
+	if _, err := m.runStep(ctx, stepDocker, down); err != nil {
+		return fmt.Errorf("docker-compose down failed: %w", err)
+	}
+
+	m.runPostHook(ctx, HookPostDown, worktreePath, vars)
+	return nil
 }
 
 // RemoveWorktree removes a worktree and cleans up resources
 func (m *Manager) RemoveWorktree(name string, force bool) error {
-	// Find worktree path
-	worktrees, err := m.ListWorktrees()
+	return m.RemoveWorktreeContext(context.Background(), name, force)
+}
+
+// RemoveWorktreeContext is RemoveWorktree with a context. Cancelling ctx
+// stops before the next step; removal is safe to run again.
+func (m *Manager) RemoveWorktreeContext(ctx context.Context, name string, force bool) error {
+	release, err := m.lock(ctx, true)
 	if err != nil {
 		return err
 	}
+	defer release()
 
-	var worktreePath string
-	for _, wt := range worktrees {
-		if filepath.Base(wt.Path) == name || wt.Branch == name {
-			worktreePath = wt.Path
-			break
+	// Find worktree
+	wt, err := m.findWorktree(ctx, name)
+	if err != nil {
+		return err
+	}
+	worktreePath := wt.Path
+
+	vars := m.buildTemplateContext(ctx, worktreePath, worktreeBranch(wt))
+	if err := m.runHook(ctx, HookPreRemove, worktreePath, vars); err != nil {
+		return err
+	}
+
+	// Drop the database while its server is still running
+	if m.Config.Database.Enabled && m.Config.Cleanup.DropDatabase {
+		if err := m.dropDatabase(ctx, worktreePath, worktreeBranch(wt)); err != nil {
+			if !force {
+				return err
+			}
+			fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
 		}
 	}
 
-	if worktreePath == "" {
-		return fmt.Errorf("worktree '%s' not found", name)
+	if m.Config.Cache.Redis.Enabled && m.Config.Cleanup.FlushRedis {
+		if err := m.flushRedis(ctx, worktreeBranch(wt)); err != nil {
+			if !force {
+				return err
+			}
+			fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+		}
 	}
 
 	// Stop Docker containers if running
@@ -343,26 +970,44 @@ func (m *Manager) RemoveWorktree(name string, force bool) error {
 		composeFile := filepath.Join(worktreePath, m.Config.Docker.ComposeFile)
 		if _, err := os.Stat(composeFile); err == nil {
 			fmt.Printf("Stopping Docker containers...\n")
-			stopCmd := exec.Command("docker-compose", "down")
-			stopCmd.Dir = worktreePath
-			stopCmd.Run() // Ignore errors
+			downArgs := []string{"down"}
+			if m.Config.Cleanup.RemoveVolumes {
+				downArgs = append(downArgs, "--volumes")
+			}
+			m.runStep(ctx, stepDocker, m.compose(worktreePath, downArgs...)) // Ignore errors
 		}
 	}
 
-	// Remove git worktree
-	args := []string{"worktree", "remove"}
-	if force {
-		args = append(args, "--force")
+	// Remove proxy route
+	if m.Config.Web.Enabled {
+		if err := m.teardownWebProxy(ctx, wt); err != nil {
+			if !force {
+				return fmt.Errorf("failed to remove web proxy route: %w", err)
+			}
+			fmt.Fprintf(os.Stderr, "Warning: failed to remove web proxy route: %v\n", err)
+		}
 	}
-	args = append(args, worktreePath)
 
-	cmd := exec.Command("git", args...)
-	cmd.Dir = m.BaseDir
+	// Remove git worktree
+	err = m.withTimeout(ctx, stepGit, "git worktree remove", func(ctx context.Context) error {
+		return m.git().RemoveWorktree(ctx, worktreePath, force)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to remove worktree: %w", err)
+	}
 
-	if output, err := cmd.CombinedOutput(); err != nil {
-		return fmt.Errorf("failed to remove worktree: %s", output)
+	if wt.Branch != "" {
+		err := m.updateState(func(state *State) error {
+			delete(state.Worktrees, wt.Branch)
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("failed to update state: %w", err)
+		}
 	}
 
+	m.runPostHook(ctx, HookPostRemove, m.BaseDir, vars)
+
 	fmt.Printf("Worktree '%s' removed successfully\n", name)
 	return nil
 }
@@ -1,9 +1,18 @@
 package worktree
 
 import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/glanotte/grove/pkg/runner"
 )
 
 func TestNewManager(t *testing.T) {
@@ -78,6 +87,26 @@ func TestManager_sanitizeBranchName(t *testing.T) {
 			branchName: "Feature/User-Auth",
 			want:       "feature-user-auth",
 		},
+		{
+			name:       "dots and symbols",
+			branchName: "feature/Foo.Bar@2",
+			want:       "feature-foo-bar-2",
+		},
+		{
+			name:       "leading and repeated separators",
+			branchName: "-fix//double__dash-",
+			want:       "fix-double-dash",
+		},
+		{
+			name:       "no usable characters",
+			branchName: "@@@",
+			want:       shortHash("@@@"),
+		},
+		{
+			name:       "too long for a DNS label",
+			branchName: "feature/" + strings.Repeat("a", 80),
+			want:       "feature-" + strings.Repeat("a", 48) + "-" + shortHash("feature/"+strings.Repeat("a", 80)),
+		},
 	}
 
 	for _, tt := range tests {
@@ -90,6 +119,56 @@ func TestManager_sanitizeBranchName(t *testing.T) {
 	}
 }
 
+func TestManager_reserveBranchSlug(t *testing.T) {
+	tempDir := t.TempDir()
+	manager := &Manager{
+		BaseDir: tempDir,
+		Config: &Config{
+			Worktree: WorktreeConfig{BasePath: "./worktrees"},
+		},
+	}
+
+	err := manager.updateState(func(state *State) error {
+		state.Worktrees["feature/a_b"] = WorktreeState{Branch: "feature/a_b", Slug: "feature-a-b"}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A known branch keeps its slug
+	slug, err := manager.reserveBranchSlug("feature/a_b")
+	if err != nil || slug != "feature-a-b" {
+		t.Errorf("reserveBranchSlug(feature/a_b) = %q, %v", slug, err)
+	}
+
+	// A different branch with the same sanitized name is disambiguated
+	slug, err = manager.reserveBranchSlug("feature/a-b")
+	if err != nil {
+		t.Fatalf("reserveBranchSlug() error = %v", err)
+	}
+	if want := "feature-a-b-" + shortHash("feature/a-b"); slug != want {
+		t.Errorf("reserveBranchSlug(feature/a-b) = %q, want %q", slug, want)
+	}
+
+	// Directories grove doesn't know about aren't overwritten
+	if err := os.MkdirAll(filepath.Join(tempDir, "worktrees", "hotfix"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	slug, err = manager.reserveBranchSlug("hotfix")
+	if err != nil {
+		t.Fatalf("reserveBranchSlug() error = %v", err)
+	}
+	if slug == "hotfix" {
+		t.Error("Expected an existing directory to be disambiguated")
+	}
+
+	// Unrelated branches are untouched
+	if slug, _ := manager.reserveBranchSlug("main"); slug != "main" {
+		t.Errorf("reserveBranchSlug(main) = %q, want main", slug)
+	}
+}
+
 func TestManager_getWorktreePath(t *testing.T) {
 	tempDir := t.TempDir()
 
@@ -133,7 +212,7 @@ func TestManager_calculatePort(t *testing.T) {
 	manager := &Manager{
 		Config: &Config{
 			Docker: DockerConfig{
-				PortOffset: 10000,
+				Ports: PortsConfig{RangeStart: 10000},
 			},
 		},
 	}
@@ -182,9 +261,9 @@ func TestManager_buildTemplateContext(t *testing.T) {
 				Domain: "app.test",
 			},
 			Docker: DockerConfig{
-				Enabled:     true,
-				NetworkName: "{project_name}_network",
-				PortOffset:  10000,
+				Enabled: true,
+				Network: NetworkConfig{Name: "{project_name}_network"},
+				Ports:   PortsConfig{RangeStart: 10000},
 			},
 			Variables: map[string]interface{}{
 				"db_name_prefix": "testapp",
@@ -196,7 +275,7 @@ func TestManager_buildTemplateContext(t *testing.T) {
 	worktreePath := "/tmp/worktrees/feature-auth"
 	branchName := "feature/auth"
 
-	ctx := manager.buildTemplateContext(worktreePath, branchName)
+	ctx := manager.buildTemplateContext(context.Background(), worktreePath, branchName)
 
 	// Test required fields
 	if ctx["BranchName"] != "feature-auth" {
@@ -247,7 +326,7 @@ func BenchmarkManager_calculatePort(b *testing.B) {
 	manager := &Manager{
 		Config: &Config{
 			Docker: DockerConfig{
-				PortOffset: 10000,
+				Ports: PortsConfig{RangeStart: 10000},
 			},
 		},
 	}
@@ -259,6 +338,286 @@ func BenchmarkManager_calculatePort(b *testing.B) {
 	}
 }
 
+func TestManager_CreateRemove(t *testing.T) {
+	manager, tempDir := setupTestManager(t)
+	manager.Config.Web.Enabled = false
+	path := filepath.Join(tempDir, "worktrees", "feature-login")
+
+	fake := runner.NewFake()
+	fake.Strict = true
+	fake.On("git show-ref", runner.Response{ExitCode: 1})
+	fake.On("git worktree add", runner.Response{Do: func(cmd runner.Cmd) error {
+		return os.MkdirAll(cmd.Args[4], 0755)
+	}})
+	fake.On("docker network inspect", runner.Response{ExitCode: 1, Stderr: "no such network"})
+	fake.On("docker network create", runner.Response{})
+	fake.On("git worktree list", runner.Response{Stdout: fmt.Sprintf(
+		"worktree %s\nbare\n\nworktree %s\nHEAD abc123\nbranch refs/heads/feature/login\n\n", tempDir, path)})
+	fake.On("git worktree remove", runner.Response{Do: func(cmd runner.Cmd) error {
+		return os.RemoveAll(cmd.Args[len(cmd.Args)-1])
+	}})
+	manager.Runner = fake
+
+	if err := manager.Create("feature/login", CreateOptions{BaseBranch: "main"}); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("worktree directory not created: %v", err)
+	}
+	state, err := manager.loadState()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if wt := state.Worktrees["feature/login"]; wt.BaseBranch != "main" || wt.Port == 0 {
+		t.Errorf("state = %+v, want base branch main and a port", wt)
+	}
+
+	if err := manager.RemoveWorktree("feature-login", false); err != nil {
+		t.Fatalf("RemoveWorktree() error = %v", err)
+	}
+	if state, _ := manager.loadState(); len(state.Worktrees) != 0 {
+		t.Errorf("state still has %v after removal", state.Worktrees)
+	}
+
+	want := []string{
+		"git show-ref --verify --quiet refs/heads/feature/login",
+		"git worktree add -b feature/login " + path + " main",
+		"docker network inspect myapp_network",
+		"docker network create myapp_network",
+		"git worktree list --porcelain",
+		"git worktree remove " + path,
+	}
+	if got := fake.Commands(); !reflect.DeepEqual(got, want) {
+		t.Errorf("commands =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestManager_RemoveForceProxyFailure(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "loading config failed", http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	manager, tempDir := setupTestManager(t)
+	manager.Config.Docker.Enabled = false
+	manager.Config.Web.ProxyType = "caddy"
+	manager.Config.Web.Caddy = CaddyConfig{Mode: "api", AdminAddress: server.URL}
+	path := filepath.Join(tempDir, "worktrees", "feature-login")
+
+	fake := runner.NewFake()
+	fake.On("git worktree list", runner.Response{Stdout: fmt.Sprintf(
+		"worktree %s\nbare\n\nworktree %s\nHEAD abc123\nbranch refs/heads/feature/login\n\n", tempDir, path)})
+	manager.Runner = fake
+
+	if err := manager.RemoveWorktree("feature-login", false); err == nil {
+		t.Fatal("RemoveWorktree() should fail when the proxy route can't be removed")
+	}
+	if fake.Ran("git worktree remove") {
+		t.Error("RemoveWorktree() removed the worktree after the proxy failed")
+	}
+
+	// --force removes the worktree anyway
+	if err := manager.RemoveWorktree("feature-login", true); err != nil {
+		t.Fatalf("RemoveWorktree(force) error = %v", err)
+	}
+	if !fake.Ran("git worktree remove --force " + path) {
+		t.Errorf("commands = %v, want a forced worktree remove", fake.Commands())
+	}
+}
+
+func TestManager_CreateRollback(t *testing.T) {
+	manager, tempDir := setupTestManager(t)
+	manager.Config.Web.Enabled = false
+	path := filepath.Join(tempDir, "worktrees", "feature-login")
+
+	// Interrupt the create while the Docker network is being set up
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	fake := runner.NewFake()
+	fake.Strict = true
+	fake.On("git show-ref", runner.Response{ExitCode: 1})
+	fake.On("git worktree add", runner.Response{Do: func(cmd runner.Cmd) error {
+		return os.MkdirAll(cmd.Args[4], 0755)
+	}})
+	fake.On("docker network inspect", runner.Response{ExitCode: 1, Stderr: "no such network"})
+	fake.On("docker network create", runner.Response{Do: func(runner.Cmd) error {
+		cancel()
+		return context.Canceled
+	}})
+	fake.On("git worktree remove", runner.Response{Do: func(cmd runner.Cmd) error {
+		return os.RemoveAll(cmd.Args[len(cmd.Args)-1])
+	}})
+	fake.On("git branch", runner.Response{})
+	manager.Runner = fake
+
+	if err := manager.CreateContext(ctx, "feature/login", CreateOptions{BaseBranch: "main"}); err == nil {
+		t.Fatal("CreateContext() should fail when cancelled")
+	}
+
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("worktree directory left behind: %v", err)
+	}
+	if state, _ := manager.loadState(); len(state.Worktrees) != 0 {
+		t.Errorf("state still has %v after rollback", state.Worktrees)
+	}
+
+	want := []string{
+		"git show-ref --verify --quiet refs/heads/feature/login",
+		"git worktree add -b feature/login " + path + " main",
+		"docker network inspect myapp_network",
+		"docker network create myapp_network",
+		"git worktree remove --force " + path,
+		"git branch -D feature/login",
+	}
+	if got := fake.Commands(); !reflect.DeepEqual(got, want) {
+		t.Errorf("commands =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestManager_CreateRollbackKeepsExistingBranch(t *testing.T) {
+	manager, tempDir := setupTestManager(t)
+	manager.Config.Web.Enabled = false
+	manager.Config.Docker.Enabled = false
+	path := filepath.Join(tempDir, "worktrees", "feature-login")
+
+	// A template that doesn't exist fails the create after git has run
+	manager.Config.Templates = TemplateConfig{
+		Default: "broken",
+		Available: map[string]TemplateDefinition{
+			"broken": {Files: []TemplateFile{{Src: "missing.tmpl", Dest: "out"}}},
+		},
+	}
+
+	fake := runner.NewFake()
+	fake.Strict = true
+	fake.On("git show-ref", runner.Response{})
+	fake.On("git worktree add", runner.Response{Do: func(cmd runner.Cmd) error {
+		return os.MkdirAll(cmd.Args[2], 0755)
+	}})
+	fake.On("git worktree remove", runner.Response{Do: func(cmd runner.Cmd) error {
+		return os.RemoveAll(cmd.Args[len(cmd.Args)-1])
+	}})
+	manager.Runner = fake
+
+	if err := manager.Create("feature/login", CreateOptions{}); err == nil {
+		t.Fatal("Create() should fail on a missing template")
+	}
+
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("worktree directory left behind: %v", err)
+	}
+
+	want := []string{
+		"git show-ref --verify --quiet refs/heads/feature/login",
+		"git worktree add " + path + " feature/login",
+		"git worktree remove --force " + path,
+	}
+	if got := fake.Commands(); !reflect.DeepEqual(got, want) {
+		t.Errorf("commands =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestManager_CreateExistingBranch(t *testing.T) {
+	manager, tempDir := setupTestManager(t)
+	manager.Config.Web.Enabled = false
+	manager.Config.Docker.Enabled = false
+	path := filepath.Join(tempDir, "worktrees", "feature-login")
+
+	existing := WorktreeState{
+		Branch:    "feature/login",
+		Slug:      "feature-login",
+		BranchID:  3,
+		Path:      path,
+		CreatedAt: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+		Generated: map[string]string{"db_password": "s3cret"},
+	}
+	err := manager.updateState(func(state *State) error {
+		state.Worktrees[existing.Branch] = existing
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stateOf := func() WorktreeState {
+		state, err := manager.loadState()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return state.Worktrees[existing.Branch]
+	}
+
+	t.Run("live worktree", func(t *testing.T) {
+		if err := os.MkdirAll(path, 0755); err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(path)
+
+		fake := runner.NewFake()
+		fake.Strict = true
+		manager.Runner = fake
+
+		err := manager.Create(existing.Branch, CreateOptions{})
+		if err == nil || !strings.Contains(err.Error(), "already has a worktree") {
+			t.Fatalf("Create() error = %v, want an existing worktree error", err)
+		}
+		if got := fake.Commands(); len(got) != 0 {
+			t.Errorf("Create() ran %v", got)
+		}
+		if got := stateOf(); !reflect.DeepEqual(got, existing) {
+			t.Errorf("state = %+v, want %+v", got, existing)
+		}
+	})
+
+	t.Run("stale record restored", func(t *testing.T) {
+		fake := runner.NewFake()
+		fake.On("git show-ref", runner.Response{})
+		fake.On("git worktree add", runner.Response{ExitCode: 128, Stderr: "fatal: 'feature/login' is already checked out"})
+		manager.Runner = fake
+
+		if err := manager.Create(existing.Branch, CreateOptions{}); err == nil {
+			t.Fatal("Create() should fail when git does")
+		}
+		if got := stateOf(); !reflect.DeepEqual(got, existing) {
+			t.Errorf("state = %+v, want %+v", got, existing)
+		}
+	})
+}
+
+func TestManager_CreateBranchIDPattern(t *testing.T) {
+	manager, tempDir := setupTestManager(t)
+	manager.Config.Web.Enabled = false
+	manager.Config.Docker.Enabled = false
+	manager.Config.Worktree.NamingPattern = "wt-{branch_id}"
+
+	fake := runner.NewFake()
+	fake.On("git show-ref", runner.Response{ExitCode: 1})
+	fake.On("git worktree add", runner.Response{Do: func(cmd runner.Cmd) error {
+		return os.MkdirAll(cmd.Args[4], 0755)
+	}})
+	manager.Runner = fake
+
+	for _, branch := range []string{"feature/a", "feature/b"} {
+		if err := manager.Create(branch, CreateOptions{BaseBranch: "main"}); err != nil {
+			t.Fatalf("Create(%s) error = %v", branch, err)
+		}
+	}
+
+	state, err := manager.loadState()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for branch, want := range map[string]string{"feature/a": "wt-1", "feature/b": "wt-2"} {
+		path := filepath.Join(tempDir, "worktrees", want)
+		if got := state.Worktrees[branch].Path; got != path {
+			t.Errorf("%s path = %s, want %s", branch, got, path)
+		}
+		if _, err := os.Stat(path); err != nil {
+			t.Errorf("%s worktree directory not created: %v", branch, err)
+		}
+	}
+}
+
 // Test helper functions
 func setupTestManager(t *testing.T) (*Manager, string) {
 	tempDir := t.TempDir()
@@ -278,8 +637,15 @@ func setupTestManager(t *testing.T) (*Manager, string) {
 }
 
 func TestMain(m *testing.M) {
-	// Setup code here if needed
+	// Keep the developer's own grove config out of the tests
+	home, err := os.MkdirTemp("", "grove-config")
+	if err != nil {
+		panic(err)
+	}
+	os.Setenv("XDG_CONFIG_HOME", home)
+
 	code := m.Run()
+	os.RemoveAll(home)
 	// Teardown code here if needed
 	os.Exit(code)
 }
@@ -0,0 +1,250 @@
+package worktree
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// CurrentConfigVersion is the config schema version this grove reads and
+// writes
+const CurrentConfigVersion = 2
+
+// configMigration upgrades a config to version by moving keys from their
+// old dotted path to the new one
+type configMigration struct {
+	version int
+	moves   [][2]string
+}
+
+var configMigrations = []configMigration{
+	{
+		version: 2,
+		moves: [][2]string{
+			{"docker.port_offset", "docker.ports.range_start"},
+			{"docker.network_name", "docker.network.name"},
+		},
+	},
+}
+
+// migrateConfig upgrades a parsed config document to CurrentConfigVersion,
+// returning the version it started at. Configs without a version are
+// treated as version 1.
+func migrateConfig(doc *yaml.Node, path string) (int, error) {
+	if doc.Kind != yaml.DocumentNode || len(doc.Content) == 0 {
+		return CurrentConfigVersion, nil
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return 0, fmt.Errorf("%s: config must be a mapping", path)
+	}
+
+	version := 1
+	if _, value := lookupKey(root, "version"); value != nil {
+		v, err := strconv.Atoi(value.Value)
+		if err != nil || v < 1 {
+			return 0, fmt.Errorf("%s: invalid config version '%s'", path, value.Value)
+		}
+		version = v
+	}
+	if version > CurrentConfigVersion {
+		return 0, fmt.Errorf("%s: config version %d is newer than this grove supports (%d); upgrade grove", path, version, CurrentConfigVersion)
+	}
+	if version == CurrentConfigVersion {
+		return version, nil
+	}
+
+	// Environment overlays hold partial configs and migrate the same way
+	targets := []*yaml.Node{root}
+	if _, envs := lookupKey(root, "environments"); envs != nil && envs.Kind == yaml.MappingNode {
+		for i := 1; i < len(envs.Content); i += 2 {
+			if envs.Content[i].Kind == yaml.MappingNode {
+				targets = append(targets, envs.Content[i])
+			}
+		}
+	}
+
+	for _, migration := range configMigrations {
+		if migration.version <= version {
+			continue
+		}
+		for _, target := range targets {
+			for _, move := range migration.moves {
+				moveKey(target, strings.Split(move[0], "."), strings.Split(move[1], "."))
+			}
+		}
+	}
+
+	setKey(root, "version", &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!int", Value: strconv.Itoa(CurrentConfigVersion)})
+	return version, nil
+}
+
+// lookupKey returns the key and value nodes for key in a mapping
+func lookupKey(mapping *yaml.Node, key string) (*yaml.Node, *yaml.Node) {
+	if mapping == nil || mapping.Kind != yaml.MappingNode {
+		return nil, nil
+	}
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			return mapping.Content[i], mapping.Content[i+1]
+		}
+	}
+	return nil, nil
+}
+
+// setKey replaces the value of key in a mapping, adding it first when missing
+func setKey(mapping *yaml.Node, key string, value *yaml.Node) {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			mapping.Content[i+1] = value
+			return
+		}
+	}
+	keyNode := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}
+	mapping.Content = append([]*yaml.Node{keyNode, value}, mapping.Content...)
+}
+
+// moveKey moves the value at from to to, keeping its comments. A value
+// already at to wins and the old key is dropped.
+func moveKey(root *yaml.Node, from, to []string) {
+	parent := root
+	for _, key := range from[:len(from)-1] {
+		if _, parent = lookupKey(parent, key); parent == nil {
+			return
+		}
+	}
+	last := from[len(from)-1]
+
+	index := -1
+	for i := 0; i+1 < len(parent.Content); i += 2 {
+		if parent.Content[i].Value == last {
+			index = i
+			break
+		}
+	}
+	if index < 0 {
+		return
+	}
+
+	dst := root
+	for _, key := range to[:len(to)-1] {
+		_, next := lookupKey(dst, key)
+		if next == nil {
+			next = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+			dst.Content = append(dst.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}, next)
+		}
+		if next.Kind != yaml.MappingNode {
+			return
+		}
+		dst = next
+	}
+
+	key, value := parent.Content[index], parent.Content[index+1]
+	parent.Content = append(parent.Content[:index], parent.Content[index+2:]...)
+	if k, _ := lookupKey(dst, to[len(to)-1]); k != nil {
+		return
+	}
+	key.Value = to[len(to)-1]
+	dst.Content = append(dst.Content, key, value)
+}
+
+// MigratedConfig describes a config file upgraded by MigrateConfig
+type MigratedConfig struct {
+	Path        string
+	FromVersion int
+	// Backup is the copy of the original file
+	Backup string
+}
+
+// MigrateConfig upgrades every config file loadConfig reads to
+// CurrentConfigVersion in place, keeping a copy of each original next to it
+func (m *Manager) MigrateConfig() ([]MigratedConfig, error) {
+	return m.MigrateConfigContext(context.Background())
+}
+
+// MigrateConfigContext is MigrateConfig with a context
+func (m *Manager) MigrateConfigContext(ctx context.Context) ([]MigratedConfig, error) {
+	release, err := m.lock(ctx, true)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	paths := []string{
+		userConfigPath(),
+		m.ConfigPath,
+		filepath.Join(filepath.Dir(m.ConfigPath), localConfigFile),
+	}
+	if m.worktreeDir != "" {
+		paths = append(paths, filepath.Join(m.worktreeDir, worktreeConfigFile))
+	}
+
+	var migrated []MigratedConfig
+	for _, path := range paths {
+		if path == "" {
+			continue
+		}
+		result, err := migrateConfigFile(path)
+		if err != nil {
+			return migrated, err
+		}
+		if result != nil {
+			migrated = append(migrated, *result)
+		}
+	}
+	return migrated, nil
+}
+
+// migrateConfigFile rewrites an outdated config file, returning nil when it
+// is missing or already current
+func migrateConfigFile(path string) (*MigratedConfig, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	from, err := migrateConfig(&doc, path)
+	if err != nil {
+		return nil, err
+	}
+	if from == CurrentConfigVersion {
+		return nil, nil
+	}
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(&doc); err != nil {
+		return nil, fmt.Errorf("failed to encode %s: %w", path, err)
+	}
+	if err := enc.Close(); err != nil {
+		return nil, fmt.Errorf("failed to encode %s: %w", path, err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	backup := fmt.Sprintf("%s.v%d.bak", path, from)
+	if err := os.WriteFile(backup, data, info.Mode().Perm()); err != nil {
+		return nil, fmt.Errorf("failed to back up %s: %w", path, err)
+	}
+	if err := writeFileAtomic(path, buf.Bytes(), info.Mode().Perm()); err != nil {
+		return nil, err
+	}
+
+	return &MigratedConfig{Path: path, FromVersion: from, Backup: backup}, nil
+}
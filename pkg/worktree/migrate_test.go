@@ -0,0 +1,148 @@
+package worktree
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const v1Config = `version: 1
+project:
+  name: shop
+docker:
+  # Web ports start here
+  port_offset: 12000
+  network_name: "{project_name}_net"
+environments:
+  staging:
+    docker:
+      network_name: staging_net
+`
+
+func TestManager_loadConfig_migratesInMemory(t *testing.T) {
+	dir := writeConfig(t, v1Config)
+
+	m, err := NewManager(dir)
+	if err != nil {
+		t.Fatalf("NewManager() error = %v", err)
+	}
+	if m.Config.Version != CurrentConfigVersion {
+		t.Errorf("Version = %d, want %d", m.Config.Version, CurrentConfigVersion)
+	}
+	if m.Config.Docker.Ports.RangeStart != 12000 {
+		t.Errorf("Ports.RangeStart = %d, want 12000", m.Config.Docker.Ports.RangeStart)
+	}
+	if m.Config.Docker.Network.Name != "{project_name}_net" {
+		t.Errorf("Network.Name = %q, want {project_name}_net", m.Config.Docker.Network.Name)
+	}
+
+	staging, err := NewManagerWithOptions(dir, Options{Env: "staging"})
+	if err != nil {
+		t.Fatalf("NewManagerWithOptions() error = %v", err)
+	}
+	if staging.Config.Docker.Network.Name != "staging_net" {
+		t.Errorf("staging Network.Name = %q, want staging_net", staging.Config.Docker.Network.Name)
+	}
+
+	// Loading never touches the file
+	data, _ := os.ReadFile(filepath.Join(dir, ".grove", "config.yaml"))
+	if string(data) != v1Config {
+		t.Error("loadConfig() rewrote the config file")
+	}
+}
+
+func TestManager_loadConfig_newerVersion(t *testing.T) {
+	dir := writeConfig(t, "version: 99\n")
+
+	_, err := NewManager(dir)
+	if err == nil || !strings.Contains(err.Error(), "upgrade grove") {
+		t.Errorf("NewManager() error = %v, want a newer version error", err)
+	}
+}
+
+func TestManager_MigrateConfig(t *testing.T) {
+	dir := writeConfig(t, v1Config)
+	path := filepath.Join(dir, ".grove", "config.yaml")
+
+	m, err := NewManager(dir)
+	if err != nil {
+		t.Fatalf("NewManager() error = %v", err)
+	}
+
+	migrated, err := m.MigrateConfig()
+	if err != nil {
+		t.Fatalf("MigrateConfig() error = %v", err)
+	}
+	if len(migrated) != 1 || migrated[0].FromVersion != 1 {
+		t.Fatalf("MigrateConfig() = %+v, want one file from version 1", migrated)
+	}
+
+	backup, err := os.ReadFile(migrated[0].Backup)
+	if err != nil || string(backup) != v1Config {
+		t.Errorf("backup = %q, %v; want the original file", backup, err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := string(data)
+	for _, want := range []string{"version: 2", "ports:", "# Web ports start here", "range_start: 12000", "name: staging_net"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("migrated config missing %q:\n%s", want, got)
+		}
+	}
+	for _, old := range []string{"port_offset", "network_name"} {
+		if strings.Contains(got, old) {
+			t.Errorf("migrated config still has %s:\n%s", old, got)
+		}
+	}
+
+	// A second run has nothing to do
+	migrated, err = m.MigrateConfig()
+	if err != nil || len(migrated) != 0 {
+		t.Errorf("second MigrateConfig() = %+v, %v; want nothing", migrated, err)
+	}
+}
+
+func TestManager_MigrateConfig_allLayers(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	dir := writeConfig(t, v1Config)
+	worktreeDir := filepath.Join(dir, "worktrees", "feature-auth")
+
+	layers := []string{
+		userConfigPath(),
+		filepath.Join(dir, ".grove", "config.yaml"),
+		filepath.Join(dir, ".grove", localConfigFile),
+		filepath.Join(worktreeDir, worktreeConfigFile),
+	}
+	for _, path := range layers {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("version: 1\ndocker:\n  port_offset: 12000\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	m, err := NewManagerWithOptions(dir, Options{WorktreeDir: worktreeDir})
+	if err != nil {
+		t.Fatalf("NewManagerWithOptions() error = %v", err)
+	}
+	migrated, err := m.MigrateConfig()
+	if err != nil {
+		t.Fatalf("MigrateConfig() error = %v", err)
+	}
+	if len(migrated) != len(layers) {
+		t.Fatalf("MigrateConfig() = %+v, want all %d layers", migrated, len(layers))
+	}
+	for i, path := range layers {
+		if migrated[i].Path != path {
+			t.Errorf("migrated[%d] = %s, want %s", i, migrated[i].Path, path)
+		}
+		if data, _ := os.ReadFile(path); strings.Contains(string(data), "port_offset") {
+			t.Errorf("%s not migrated:\n%s", path, data)
+		}
+	}
+}
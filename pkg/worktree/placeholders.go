@@ -0,0 +1,161 @@
+package worktree
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// defaultTicketPattern extracts issue keys such as ABC-123 from branch names
+const defaultTicketPattern = `[A-Za-z][A-Za-z0-9]*-[0-9]+`
+
+// placeholderRe matches {name} placeholders in config patterns
+var placeholderRe = regexp.MustCompile(`\{([^{}]*)\}`)
+
+// knownPlaceholders lists every placeholder config patterns may use
+var knownPlaceholders = map[string]bool{
+	"project_name":   true,
+	"project_domain": true,
+	"branch":         true,
+	"branch_name":    true,
+	"branch_short":   true,
+	"ticket":         true,
+	"user":           true,
+	"date":           true,
+	"branch_id":      true,
+}
+
+// maxLabelLength is the longest name allowed in a single DNS label
+const maxLabelLength = 63
+
+// placeholderValues returns the value of every known placeholder for a
+// branch, with {branch} set to slug
+func (m *Manager) placeholderValues(branchName, slug string) map[string]string {
+	var wt WorktreeState
+	if state, err := m.loadState(); err == nil {
+		wt = state.Worktrees[branchName]
+	}
+	return m.worktreePlaceholders(branchName, slug, wt)
+}
+
+// worktreePlaceholders returns the placeholder values for a branch. {user}
+// and {date} come from its state entry once created, so names built from
+// them don't change the next day or for another user.
+func (m *Manager) worktreePlaceholders(branchName, slug string, wt WorktreeState) map[string]string {
+	safe := slug
+
+	short := m.sanitizeBranchName(path.Base(branchName))
+	if branchName == "" {
+		short = ""
+	}
+
+	// Branches without a ticket key fall back to the sanitized branch
+	ticket := safe
+	if match := m.ticketRegexp().FindString(branchName); match != "" {
+		ticket = m.sanitizeBranchName(match)
+	}
+
+	userName, date := wt.User, wt.Date
+	if userName == "" {
+		userName = m.sanitizeBranchName(currentUser())
+	}
+	if date == "" {
+		date = placeholderDate(time.Now())
+	}
+
+	return map[string]string{
+		"project_name":   m.Config.Project.Name,
+		"project_domain": m.Config.Project.Domain,
+		"branch":         safe,
+		"branch_name":    safe,
+		"branch_short":   short,
+		"ticket":         ticket,
+		"user":           userName,
+		"date":           date,
+		"branch_id":      fmt.Sprint(wt.BranchID),
+	}
+}
+
+// placeholderDate formats t as a {date} value
+func placeholderDate(t time.Time) string {
+	return t.Format("20060102")
+}
+
+// expand replaces the placeholders in pattern with values for a branch
+func (m *Manager) expand(pattern, branchName string) string {
+	return m.expandSlug(pattern, branchName, m.branchSlug(branchName))
+}
+
+// expandSlug expands pattern using slug as the branch's {branch} value
+func (m *Manager) expandSlug(pattern, branchName, slug string) string {
+	return expandPlaceholders(pattern, m.placeholderValues(branchName, slug))
+}
+
+// expandPlaceholders replaces {name} placeholders with their values, leaving
+// unknown placeholders untouched
+func expandPlaceholders(pattern string, values map[string]string) string {
+	return placeholderRe.ReplaceAllStringFunc(pattern, func(match string) string {
+		if value, ok := values[match[1:len(match)-1]]; ok {
+			return value
+		}
+		return match
+	})
+}
+
+// validatePattern rejects patterns that use unknown placeholders
+func validatePattern(field, pattern string) error {
+	for _, match := range placeholderRe.FindAllStringSubmatch(pattern, -1) {
+		if !knownPlaceholders[match[1]] {
+			return fmt.Errorf("%s: unknown placeholder {%s}", field, match[1])
+		}
+	}
+	return nil
+}
+
+// worktreeName returns the directory name of a branch's worktree
+func (m *Manager) worktreeName(branchName string) string {
+	return m.expand(m.worktreeNamePattern(), branchName)
+}
+
+func (m *Manager) worktreeNamePattern() string {
+	if m.Config.Worktree.NamingPattern == "" {
+		return "{branch}"
+	}
+	return m.Config.Worktree.NamingPattern
+}
+
+// networkName returns the Docker network a branch's containers join
+func (m *Manager) networkName(branchName string) string {
+	return m.expand(m.Config.Docker.Network.Name, branchName)
+}
+
+// containerPrefix returns the prefix for a branch's container names
+func (m *Manager) containerPrefix(branchName string) string {
+	return m.expand(m.Config.Docker.ContainerPrefix, branchName)
+}
+
+// ticketRegexp returns the configured expression used to extract {ticket}
+func (m *Manager) ticketRegexp() *regexp.Regexp {
+	if m.Config.Worktree.TicketPattern != "" {
+		if re, err := regexp.Compile(m.Config.Worktree.TicketPattern); err == nil {
+			return re
+		}
+	}
+	return regexp.MustCompile(defaultTicketPattern)
+}
+
+// currentUser returns the login name of the user running grove
+func currentUser() string {
+	if u, err := user.Current(); err == nil && u.Username != "" {
+		// Windows usernames are DOMAIN\user
+		if i := strings.LastIndex(u.Username, `\`); i >= 0 {
+			return u.Username[i+1:]
+		}
+		return u.Username
+	}
+	return os.Getenv("USER")
+}
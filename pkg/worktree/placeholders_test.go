@@ -0,0 +1,124 @@
+package worktree
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestManager_expand(t *testing.T) {
+	manager := &Manager{Config: &Config{
+		Project: ProjectConfig{Name: "testapp", Domain: "app.test"},
+	}}
+
+	tests := []struct {
+		name    string
+		pattern string
+		branch  string
+		want    string
+	}{
+		{name: "branch", pattern: "{branch}.{project_domain}", branch: "feature/auth", want: "feature-auth.app.test"},
+		{name: "branch_name alias", pattern: "{branch_name}", branch: "Feature_Auth", want: "feature-auth"},
+		{name: "branch_short", pattern: "{branch_short}", branch: "feature/team/auth", want: "auth"},
+		{name: "ticket", pattern: "{ticket}", branch: "feature/ABC-123-login", want: "abc-123"},
+		{name: "ticket fallback", pattern: "{ticket}", branch: "hotfix/login", want: "hotfix-login"},
+		{name: "project name", pattern: "{project_name}_{branch}", branch: "main", want: "testapp_main"},
+		{name: "date", pattern: "{date}", branch: "main", want: time.Now().Format("20060102")},
+		{name: "literal text", pattern: "static", branch: "main", want: "static"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := manager.expand(tt.pattern, tt.branch); got != tt.want {
+				t.Errorf("expand(%q, %q) = %q, want %q", tt.pattern, tt.branch, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestManager_expandBranchID(t *testing.T) {
+	manager := &Manager{Config: &Config{Docker: DockerConfig{Ports: PortsConfig{RangeStart: 10000}}}}
+
+	id := manager.expand("{branch_id}", "feature/auth")
+	if id != manager.expand("{branch_id}", "feature/auth") {
+		t.Error("Expected {branch_id} to be stable")
+	}
+	if strings.Contains(id, "{") {
+		t.Errorf("Expected {branch_id} to be expanded, got %q", id)
+	}
+}
+
+func TestManager_expandFrozen(t *testing.T) {
+	manager := &Manager{BaseDir: t.TempDir(), Config: &Config{}}
+	err := manager.updateState(func(state *State) error {
+		state.Worktrees["feature/auth"] = WorktreeState{Branch: "feature/auth", Slug: "feature-auth", User: "alice", Date: "20240102"}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Recorded worktrees keep the values from their creation
+	if got := manager.expand("{user}-{date}", "feature/auth"); got != "alice-20240102" {
+		t.Errorf("expand() = %q, want alice-20240102", got)
+	}
+	want := manager.sanitizeBranchName(currentUser()) + "-" + placeholderDate(time.Now())
+	if got := manager.expand("{user}-{date}", "feature/other"); got != want {
+		t.Errorf("expand() = %q, want %q", got, want)
+	}
+}
+
+func TestManager_ticketPattern(t *testing.T) {
+	manager := &Manager{Config: &Config{
+		Worktree: WorktreeConfig{TicketPattern: `#[0-9]+`},
+	}}
+
+	if got := manager.expand("{ticket}", "fix/#42-crash"); got != "42" {
+		t.Errorf("expand({ticket}) = %q, want 42", got)
+	}
+}
+
+func TestManager_worktreeName(t *testing.T) {
+	tests := []struct {
+		pattern string
+		branch  string
+		want    string
+	}{
+		{pattern: "", branch: "feature/auth", want: "feature-auth"},
+		{pattern: "{branch}", branch: "feature/auth", want: "feature-auth"},
+		{pattern: "{ticket}-{branch_short}", branch: "feature/ABC-1-auth", want: "abc-1-abc-1-auth"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pattern, func(t *testing.T) {
+			manager := &Manager{Config: &Config{
+				Worktree: WorktreeConfig{NamingPattern: tt.pattern},
+			}}
+			if got := manager.worktreeName(tt.branch); got != tt.want {
+				t.Errorf("worktreeName(%q) = %q, want %q", tt.branch, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidatePattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		wantErr bool
+	}{
+		{pattern: "{branch}.{project_domain}"},
+		{pattern: "{user}-{date}-{branch_id}"},
+		{pattern: "no-placeholders"},
+		{pattern: "{branch}.{domain}", wantErr: true},
+		{pattern: "{}", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pattern, func(t *testing.T) {
+			err := validatePattern("test", tt.pattern)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validatePattern(%q) error = %v, wantErr %v", tt.pattern, err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,110 @@
+package worktree
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Route describes how a worktree is reached through the web proxy
+type Route struct {
+	Name         string `json:"name"`
+	Host         string `json:"host"`
+	Port         int    `json:"port"`
+	WorktreePath string `json:"worktree_path"`
+}
+
+// ProxyBackend publishes worktree routes to a reverse proxy. Calls are
+// bounded by the proxy timeout through ctx.
+type ProxyBackend interface {
+	// Register makes the route reachable through the proxy
+	Register(ctx context.Context, route Route) error
+	// Unregister removes everything Register created for the route
+	Unregister(ctx context.Context, route Route) error
+}
+
+// proxyStarter is implemented by backends that need running containers to
+// finish setting up a route
+type proxyStarter interface {
+	AfterUp(ctx context.Context, route Route) error
+}
+
+// proxyBackend returns the backend selected by web.proxy_type. A nil backend
+// means no proxy is configured.
+func (m *Manager) proxyBackend() (ProxyBackend, error) {
+	switch m.Config.Web.ProxyType {
+	case "":
+		return nil, nil
+	case "nginx-proxy":
+		return newNginxProxy(m), nil
+	case "traefik":
+		return &traefikProxy{m: m}, nil
+	case "caddy":
+		return newCaddyProxy(m), nil
+	case "builtin":
+		return &builtinProxy{m: m}, nil
+	default:
+		return nil, fmt.Errorf("unsupported proxy type '%s'", m.Config.Web.ProxyType)
+	}
+}
+
+// subdomain returns the hostname a branch's worktree is served on
+func (m *Manager) subdomain(branchName string) string {
+	return m.expand(m.Config.Web.SubdomainPattern, branchName)
+}
+
+// route builds the proxy route for a worktree
+func (m *Manager) route(worktreePath, branchName string) Route {
+	return Route{
+		Name:         filepath.Base(worktreePath),
+		Host:         m.subdomain(branchName),
+		Port:         m.calculatePort(m.branchSlug(branchName)),
+		WorktreePath: worktreePath,
+	}
+}
+
+// upstreamHost returns the host the proxy uses to reach worktree ports
+func (m *Manager) upstreamHost() string {
+	if m.Config.Web.UpstreamHost != "" {
+		return m.Config.Web.UpstreamHost
+	}
+	return "localhost"
+}
+
+// resolvePath resolves a configured path relative to the base directory
+func (m *Manager) resolvePath(path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(m.BaseDir, path)
+}
+
+// writeFileAtomic writes data to a temporary file and renames it into place
+// so that watchers never observe a partially written file
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".tmp-")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write temporary file: %w", err)
+	}
+	if err := tmp.Chmod(perm); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to set permissions: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to close temporary file: %w", err)
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
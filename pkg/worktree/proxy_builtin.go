@@ -0,0 +1,339 @@
+package worktree
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultBuiltinListen    = ":80"
+	defaultBuiltinTLSListen = ":443"
+)
+
+// routeRegistry is the file shared between grove and the `grove proxy` daemon
+type routeRegistry struct {
+	Routes []Route `json:"routes"`
+}
+
+// builtinProxy records routes in the registry read by `grove proxy`
+type builtinProxy struct {
+	m *Manager
+}
+
+// Register adds or replaces the route in the registry
+func (p *builtinProxy) Register(_ context.Context, route Route) error {
+	return p.update(func(reg *routeRegistry) {
+		reg.remove(route.Name)
+		reg.Routes = append(reg.Routes, route)
+	})
+}
+
+// Unregister removes the route from the registry
+func (p *builtinProxy) Unregister(_ context.Context, route Route) error {
+	return p.update(func(reg *routeRegistry) {
+		reg.remove(route.Name)
+	})
+}
+
+func (p *builtinProxy) update(fn func(reg *routeRegistry)) error {
+	path := p.m.routesFile()
+
+	reg, err := readRouteRegistry(path)
+	if err != nil {
+		return err
+	}
+
+	fn(reg)
+	sort.Slice(reg.Routes, func(i, j int) bool { return reg.Routes[i].Host < reg.Routes[j].Host })
+
+	data, err := json.MarshalIndent(reg, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode route registry: %w", err)
+	}
+
+	if err := writeFileAtomic(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write route registry: %w", err)
+	}
+
+	return nil
+}
+
+func (reg *routeRegistry) remove(name string) {
+	routes := reg.Routes[:0]
+	for _, r := range reg.Routes {
+		if r.Name != name {
+			routes = append(routes, r)
+		}
+	}
+	reg.Routes = routes
+}
+
+// readRouteRegistry loads the registry, treating a missing file as empty
+func readRouteRegistry(path string) (*routeRegistry, error) {
+	reg := &routeRegistry{}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return reg, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read route registry: %w", err)
+	}
+
+	if err := json.Unmarshal(data, reg); err != nil {
+		return nil, fmt.Errorf("failed to parse route registry: %w", err)
+	}
+
+	return reg, nil
+}
+
+// routesFile returns the path of the builtin proxy's route registry
+func (m *Manager) routesFile() string {
+	path := m.Config.Web.Builtin.RoutesFile
+	if path == "" {
+		path = filepath.Join(".grove", "proxy", "routes.json")
+	}
+	return m.resolvePath(path)
+}
+
+// ProxyServer routes requests to worktrees by Host header
+type ProxyServer struct {
+	registryPath string
+	upstreamHost string
+
+	mu      sync.RWMutex
+	modTime time.Time
+	routes  map[string]Route
+	proxies map[string]*httputil.ReverseProxy
+}
+
+// NewProxyServer creates a proxy server reading the manager's route registry
+func (m *Manager) NewProxyServer() (*ProxyServer, error) {
+	s := &ProxyServer{
+		registryPath: m.routesFile(),
+		upstreamHost: m.upstreamHost(),
+	}
+
+	if err := s.Reload(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Reload re-reads the route registry if it changed since the last load
+func (s *ProxyServer) Reload() error {
+	var modTime time.Time
+	if info, err := os.Stat(s.registryPath); err == nil {
+		modTime = info.ModTime()
+	} else if !os.IsNotExist(err) {
+		return fmt.Errorf("failed to stat route registry: %w", err)
+	}
+
+	s.mu.RLock()
+	unchanged := s.routes != nil && modTime.Equal(s.modTime)
+	s.mu.RUnlock()
+	if unchanged {
+		return nil
+	}
+
+	reg, err := readRouteRegistry(s.registryPath)
+	if err != nil {
+		return err
+	}
+
+	routes := make(map[string]Route, len(reg.Routes))
+	proxies := make(map[string]*httputil.ReverseProxy, len(reg.Routes))
+	for _, route := range reg.Routes {
+		host := strings.ToLower(route.Host)
+		target := &url.URL{Scheme: "http", Host: net.JoinHostPort(s.upstreamHost, fmt.Sprint(route.Port))}
+
+		proxy := httputil.NewSingleHostReverseProxy(target)
+		proxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+			http.Error(w, fmt.Sprintf("grove: %s is not responding on port %d: %v", host, route.Port, err), http.StatusBadGateway)
+		}
+
+		routes[host] = route
+		proxies[host] = proxy
+	}
+
+	s.mu.Lock()
+	s.routes = routes
+	s.proxies = proxies
+	s.modTime = modTime
+	s.mu.Unlock()
+
+	return nil
+}
+
+// Watch reloads the registry every interval until ctx is done
+func (s *ProxyServer) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.Reload(); err != nil {
+				fmt.Fprintf(os.Stderr, "grove proxy: %v\n", err)
+			}
+		}
+	}
+}
+
+// ServeHTTP proxies the request to the worktree matching its host, or
+// serves the landing page when no worktree matches
+func (s *ProxyServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.ToLower(host)
+
+	s.mu.RLock()
+	proxy, ok := s.proxies[host]
+	s.mu.RUnlock()
+
+	if ok {
+		proxy.ServeHTTP(w, r)
+		return
+	}
+
+	s.serveLanding(w, r)
+}
+
+var landingTemplate = template.Must(template.New("landing").Parse(`<!DOCTYPE html>
+<html>
+<head><title>grove</title></head>
+<body>
+<h1>grove worktrees</h1>
+{{- if .Routes}}
+<ul>
+{{- range .Routes}}
+<li><a href="{{$.Scheme}}://{{.Host}}{{$.Port}}/">{{.Name}}</a> &rarr; port {{.Port}}</li>
+{{- end}}
+</ul>
+{{- else}}
+<p>No worktrees are registered.</p>
+{{- end}}
+</body>
+</html>
+`))
+
+// serveLanding lists all registered worktrees with links
+func (s *ProxyServer) serveLanding(w http.ResponseWriter, r *http.Request) {
+	s.mu.RLock()
+	routes := make([]Route, 0, len(s.routes))
+	for _, route := range s.routes {
+		routes = append(routes, route)
+	}
+	s.mu.RUnlock()
+	sort.Slice(routes, func(i, j int) bool { return routes[i].Host < routes[j].Host })
+
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	port := ""
+	if _, p, err := net.SplitHostPort(r.Host); err == nil {
+		port = ":" + p
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusNotFound)
+	landingTemplate.Execute(w, map[string]interface{}{
+		"Routes": routes,
+		"Scheme": scheme,
+		"Port":   port,
+	})
+}
+
+// RunProxy serves the builtin proxy until ctx is cancelled. HTTP/2 is
+// negotiated on the TLS listener when a certificate is configured or grove
+// issues certificates itself.
+func (m *Manager) RunProxy(ctx context.Context) error {
+	server, err := m.NewProxyServer()
+	if err != nil {
+		return err
+	}
+
+	cfg := m.Config.Web.Builtin
+	listen := cfg.Listen
+	if listen == "" {
+		listen = defaultBuiltinListen
+	}
+
+	servers := []*http.Server{{Addr: listen, Handler: server}}
+	staticCert := cfg.TLSCert != "" && cfg.TLSKey != ""
+	if staticCert || m.localCertificates() {
+		tlsListen := cfg.TLSListen
+		if tlsListen == "" {
+			tlsListen = defaultBuiltinTLSListen
+		}
+		tlsServer := &http.Server{Addr: tlsListen, Handler: server}
+		if !staticCert {
+			tlsServer.TLSConfig = &tls.Config{GetCertificate: m.worktreeCertificate}
+		}
+		servers = append(servers, tlsServer)
+	}
+
+	watchCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go server.Watch(watchCtx, time.Second)
+
+	errs := make(chan error, len(servers))
+	for i, srv := range servers {
+		fmt.Printf("grove proxy listening on %s\n", srv.Addr)
+		go func(srv *http.Server, useTLS bool) {
+			var err error
+			if useTLS && srv.TLSConfig != nil {
+				err = srv.ListenAndServeTLS("", "")
+			} else if useTLS {
+				err = srv.ListenAndServeTLS(m.resolvePath(cfg.TLSCert), m.resolvePath(cfg.TLSKey))
+			} else {
+				err = srv.ListenAndServe()
+			}
+			if err != http.ErrServerClosed {
+				errs <- err
+			}
+		}(srv, i > 0)
+	}
+
+	select {
+	case err = <-errs:
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer shutdownCancel()
+	for _, srv := range servers {
+		srv.Shutdown(shutdownCtx)
+	}
+
+	return err
+}
+
+// worktreeCertificate loads the certificate grove issued for the requested host
+func (m *Manager) worktreeCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	certPath, keyPath := m.certPaths(Route{Host: strings.ToLower(hello.ServerName)})
+	cert, err := tls.LoadX509KeyPair(certPath, keyPath)
+	if err != nil {
+		return nil, fmt.Errorf("no certificate for %s: %w", hello.ServerName, err)
+	}
+	return &cert, nil
+}
@@ -0,0 +1,177 @@
+package worktree
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func newBuiltinTestManager(t *testing.T) *Manager {
+	return &Manager{
+		BaseDir: t.TempDir(),
+		Config: &Config{
+			Project: ProjectConfig{
+				Name:   "testapp",
+				Domain: "app.test",
+			},
+			Web: WebConfig{
+				Enabled:          true,
+				ProxyType:        "builtin",
+				SubdomainPattern: "{branch}.{project_domain}",
+				UpstreamHost:     "127.0.0.1",
+			},
+		},
+	}
+}
+
+// backendPort starts a test server and returns its port
+func backendPort(t *testing.T, handler http.Handler) int {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	u, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	port, err := strconv.Atoi(u.Port())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return port
+}
+
+func proxyGet(t *testing.T, proxy http.Handler, host string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "http://"+host+"/", nil)
+	rec := httptest.NewRecorder()
+	proxy.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestProxyServer_Routing(t *testing.T) {
+	manager := newBuiltinTestManager(t)
+	backend := &builtinProxy{m: manager}
+
+	port := backendPort(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "hello from %s", r.Host)
+	}))
+
+	if err := backend.Register(context.Background(), Route{Name: "feature-auth", Host: "feature-auth.app.test", Port: port}); err != nil {
+		t.Fatalf("Register() error = %v", err)
+	}
+
+	server, err := manager.NewProxyServer()
+	if err != nil {
+		t.Fatalf("NewProxyServer() error = %v", err)
+	}
+
+	rec := proxyGet(t, server, "Feature-Auth.app.test:8080")
+	if rec.Code != http.StatusOK || rec.Body.String() != "hello from Feature-Auth.app.test:8080" {
+		t.Errorf("Expected proxied response, got %d %q", rec.Code, rec.Body.String())
+	}
+
+	rec = proxyGet(t, server, "unknown.app.test:8080")
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected landing page status 404, got %d", rec.Code)
+	}
+	if !strings.Contains(rec.Body.String(), `href="http://feature-auth.app.test:8080/"`) {
+		t.Errorf("Expected landing page to link the worktree, got:\n%s", rec.Body.String())
+	}
+}
+
+func TestProxyServer_Reload(t *testing.T) {
+	manager := newBuiltinTestManager(t)
+	backend := &builtinProxy{m: manager}
+
+	server, err := manager.NewProxyServer()
+	if err != nil {
+		t.Fatalf("NewProxyServer() error = %v", err)
+	}
+
+	port := backendPort(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "main")
+	}))
+	route := Route{Name: "main", Host: "main.app.test", Port: port}
+
+	if rec := proxyGet(t, server, route.Host); rec.Code != http.StatusNotFound {
+		t.Fatalf("Expected unknown host before registration, got %d", rec.Code)
+	}
+
+	if err := backend.Register(context.Background(), route); err != nil {
+		t.Fatalf("Register() error = %v", err)
+	}
+	if err := server.Reload(); err != nil {
+		t.Fatalf("Reload() error = %v", err)
+	}
+	if rec := proxyGet(t, server, route.Host); rec.Body.String() != "main" {
+		t.Errorf("Expected route after reload, got %d %q", rec.Code, rec.Body.String())
+	}
+
+	if err := backend.Unregister(context.Background(), route); err != nil {
+		t.Fatalf("Unregister() error = %v", err)
+	}
+	if err := server.Reload(); err != nil {
+		t.Fatalf("Reload() error = %v", err)
+	}
+	if rec := proxyGet(t, server, route.Host); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected route to be gone after reload, got %d", rec.Code)
+	}
+}
+
+func TestProxyServer_WebSocketUpgrade(t *testing.T) {
+	manager := newBuiltinTestManager(t)
+
+	// The backend completes the upgrade handshake and echoes one line
+	port := backendPort(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, rw, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		rw.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n\r\n")
+		rw.Flush()
+		line, _ := rw.ReadString('\n')
+		rw.WriteString("echo: " + line)
+		rw.Flush()
+	}))
+
+	if err := (&builtinProxy{m: manager}).Register(context.Background(), Route{Name: "main", Host: "main.app.test", Port: port}); err != nil {
+		t.Fatal(err)
+	}
+
+	server, err := manager.NewProxyServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	front := httptest.NewServer(server)
+	defer front.Close()
+
+	conn, err := net.Dial("tcp", strings.TrimPrefix(front.URL, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	fmt.Fprint(conn, "GET / HTTP/1.1\r\nHost: main.app.test\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n\r\n")
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, nil)
+	if err != nil {
+		t.Fatalf("Failed to read upgrade response: %v", err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("Expected 101 Switching Protocols, got %s", resp.Status)
+	}
+
+	fmt.Fprint(conn, "ping\n")
+	line, err := reader.ReadString('\n')
+	if err != nil || line != "echo: ping\n" {
+		t.Errorf("Expected echoed frame, got %q (%v)", line, err)
+	}
+}
@@ -0,0 +1,205 @@
+package worktree
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/glanotte/grove/pkg/runner"
+)
+
+const (
+	defaultCaddyAdminAddress  = "http://localhost:2019"
+	defaultCaddyServer        = "srv0"
+	defaultCaddyReloadCommand = "caddy reload --config /etc/caddy/Caddyfile"
+)
+
+// caddyProxy publishes routes as Caddyfile fragments or through the admin API
+type caddyProxy struct {
+	m      *Manager
+	client *http.Client
+}
+
+func newCaddyProxy(m *Manager) *caddyProxy {
+	return &caddyProxy{
+		m:      m,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Register publishes the route to Caddy
+func (p *caddyProxy) Register(ctx context.Context, route Route) error {
+	if p.useAPI() {
+		return p.registerAPI(ctx, route)
+	}
+
+	if err := writeFileAtomic(p.sitePath(route), []byte(p.siteBlock(route)), 0644); err != nil {
+		return fmt.Errorf("failed to write caddy site: %w", err)
+	}
+
+	return p.reload(ctx)
+}
+
+// Unregister removes the route from Caddy
+func (p *caddyProxy) Unregister(ctx context.Context, route Route) error {
+	if p.useAPI() {
+		// Caddy forgets routes added through the API when it restarts
+		err := p.adminRequest(ctx, http.MethodDelete, "/id/"+p.routeID(route), nil)
+		var apiErr *caddyAPIError
+		if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound {
+			return nil
+		}
+		return err
+	}
+
+	if err := os.Remove(p.sitePath(route)); err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to remove caddy site: %w", err)
+	}
+
+	return p.reload(ctx)
+}
+
+// siteBlock renders the Caddyfile site block for a route
+func (p *caddyProxy) siteBlock(route Route) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s {\n", route.Host)
+	if p.m.localCertificates() {
+		certPath, keyPath := p.m.certPaths(route)
+		fmt.Fprintf(&b, "\ttls %s %s\n", certPath, keyPath)
+	}
+	fmt.Fprintf(&b, "\treverse_proxy %s:%d\n}\n", p.m.upstreamHost(), route.Port)
+	return b.String()
+}
+
+// sitePath returns the Caddyfile fragment for a route
+func (p *caddyProxy) sitePath(route Route) string {
+	dir := p.m.Config.Web.Caddy.SitesDir
+	if dir == "" {
+		dir = filepath.Join(".grove", "caddy")
+	}
+	return filepath.Join(p.m.resolvePath(dir), fmt.Sprintf("%s-%s.caddy", p.m.Config.Project.Name, route.Name))
+}
+
+// reload asks Caddy to pick up changed fragments. The command runs through
+// the shell, as hooks do.
+func (p *caddyProxy) reload(ctx context.Context) error {
+	command := p.m.Config.Web.Caddy.ReloadCommand
+	if strings.TrimSpace(command) == "" {
+		command = defaultCaddyReloadCommand
+	}
+
+	cmd := runner.Command("sh", "-c", command)
+	cmd.Dir = p.m.BaseDir
+	if result, err := p.m.run(ctx, cmd); err != nil {
+		return fmt.Errorf("caddy reload failed: %s", commandOutput(result, err))
+	}
+
+	return nil
+}
+
+func (p *caddyProxy) useAPI() bool {
+	return p.m.Config.Web.Caddy.Mode == "api"
+}
+
+// routeID returns the @id used to address a route through the admin API
+func (p *caddyProxy) routeID(route Route) string {
+	return fmt.Sprintf("grove-%s-%s", p.m.Config.Project.Name, route.Name)
+}
+
+// registerAPI adds the route to the configured server, replacing any route
+// previously registered for the same worktree
+func (p *caddyProxy) registerAPI(ctx context.Context, route Route) error {
+	// A missing route is reported as an error by Caddy, so ignore it here
+	_ = p.adminRequest(ctx, http.MethodDelete, "/id/"+p.routeID(route), nil)
+
+	body := map[string]interface{}{
+		"@id": p.routeID(route),
+		"match": []map[string]interface{}{
+			{"host": []string{route.Host}},
+		},
+		"handle": []map[string]interface{}{
+			{
+				"handler": "reverse_proxy",
+				"upstreams": []map[string]interface{}{
+					{"dial": fmt.Sprintf("%s:%d", p.m.upstreamHost(), route.Port)},
+				},
+			},
+		},
+		"terminal": true,
+	}
+
+	server := p.m.Config.Web.Caddy.Server
+	if server == "" {
+		server = defaultCaddyServer
+	}
+
+	return p.adminRequest(ctx, http.MethodPost, fmt.Sprintf("/config/apps/http/servers/%s/routes", server), body)
+}
+
+// adminRequest sends a JSON request to the Caddy admin API
+func (p *caddyProxy) adminRequest(ctx context.Context, method, path string, body interface{}) error {
+	address := p.m.Config.Web.Caddy.AdminAddress
+	if address == "" {
+		address = defaultCaddyAdminAddress
+	}
+
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("failed to encode caddy route: %w", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimRight(address, "/")+path, reader)
+	if err != nil {
+		return fmt.Errorf("failed to build caddy request: %w", err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("caddy admin API unreachable: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(resp.Body)
+		return &caddyAPIError{
+			Method:     method,
+			Path:       path,
+			Status:     resp.Status,
+			StatusCode: resp.StatusCode,
+			Message:    strings.TrimSpace(string(msg)),
+		}
+	}
+
+	return nil
+}
+
+// caddyAPIError reports a request the Caddy admin API rejected
+type caddyAPIError struct {
+	Method     string
+	Path       string
+	Status     string
+	StatusCode int
+	Message    string
+}
+
+func (e *caddyAPIError) Error() string {
+	return fmt.Sprintf("caddy admin API %s %s failed: %s: %s", e.Method, e.Path, e.Status, e.Message)
+}
@@ -0,0 +1,195 @@
+package worktree
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/glanotte/grove/pkg/runner"
+)
+
+func newCaddyTestManager(t *testing.T, caddy CaddyConfig) *Manager {
+	return &Manager{
+		BaseDir: t.TempDir(),
+		Config: &Config{
+			Project: ProjectConfig{
+				Name:   "testapp",
+				Domain: "app.test",
+			},
+			Docker: DockerConfig{
+				Ports: PortsConfig{RangeStart: 10000},
+			},
+			Web: WebConfig{
+				Enabled:          true,
+				ProxyType:        "caddy",
+				SubdomainPattern: "{branch}.{project_domain}",
+				Caddy:            caddy,
+			},
+		},
+	}
+}
+
+func TestCaddyProxy_File(t *testing.T) {
+	manager := newCaddyTestManager(t, CaddyConfig{ReloadCommand: "true"})
+	route := Route{Name: "feature-auth", Host: "feature-auth.app.test", Port: 10123}
+	backend := newCaddyProxy(manager)
+
+	if err := backend.Register(context.Background(), route); err != nil {
+		t.Fatalf("Register() error = %v", err)
+	}
+
+	path := backend.sitePath(route)
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Expected site fragment at %s: %v", path, err)
+	}
+
+	want := "feature-auth.app.test {\n\treverse_proxy localhost:10123\n}\n"
+	if string(content) != want {
+		t.Errorf("site fragment = %q, want %q", content, want)
+	}
+
+	if err := backend.Unregister(context.Background(), route); err != nil {
+		t.Fatalf("Unregister() error = %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Error("Expected site fragment to be removed")
+	}
+}
+
+func TestCaddyProxy_FileReloadFailure(t *testing.T) {
+	manager := newCaddyTestManager(t, CaddyConfig{ReloadCommand: "false"})
+	backend := newCaddyProxy(manager)
+
+	if err := backend.Register(context.Background(), Route{Name: "main", Host: "main.app.test", Port: 10001}); err == nil {
+		t.Error("Expected Register() to report the failed reload")
+	}
+}
+
+func TestCaddyProxy_reloadCommand(t *testing.T) {
+	tests := []struct {
+		name    string
+		command string
+		want    string
+	}{
+		{name: "default", command: "", want: "sh -c 'caddy reload --config /etc/caddy/Caddyfile'"},
+		{name: "blank", command: "  ", want: "sh -c 'caddy reload --config /etc/caddy/Caddyfile'"},
+		{name: "custom", command: "docker exec caddy caddy reload", want: "sh -c 'docker exec caddy caddy reload'"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := runner.NewFake()
+			manager := newCaddyTestManager(t, CaddyConfig{ReloadCommand: tt.command})
+			manager.Runner = fake
+
+			if err := newCaddyProxy(manager).reload(context.Background()); err != nil {
+				t.Fatalf("reload() error = %v", err)
+			}
+			if got := fake.Commands(); len(got) != 1 || got[0] != tt.want {
+				t.Errorf("reload() ran %v, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+type caddyRequest struct {
+	Method string
+	Path   string
+	Body   map[string]interface{}
+}
+
+func TestCaddyProxy_API(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		requests []caddyRequest
+	)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req := caddyRequest{Method: r.Method, Path: r.URL.Path}
+		if r.Method == http.MethodPost {
+			if err := json.NewDecoder(r.Body).Decode(&req.Body); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+
+		mu.Lock()
+		requests = append(requests, req)
+		first := len(requests) == 1
+		mu.Unlock()
+
+		if r.Method == http.MethodDelete && first {
+			// Caddy rejects deletes of unknown ids
+			http.Error(w, "unknown object ID", http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	manager := newCaddyTestManager(t, CaddyConfig{Mode: "api", AdminAddress: server.URL})
+	route := Route{Name: "feature-auth", Host: "feature-auth.app.test", Port: 10123}
+	backend := newCaddyProxy(manager)
+
+	if err := backend.Register(context.Background(), route); err != nil {
+		t.Fatalf("Register() error = %v", err)
+	}
+	if err := backend.Unregister(context.Background(), route); err != nil {
+		t.Fatalf("Unregister() error = %v", err)
+	}
+
+	if len(requests) != 3 {
+		t.Fatalf("Expected 3 admin requests, got %d: %v", len(requests), requests)
+	}
+
+	post := requests[1]
+	if post.Method != http.MethodPost || post.Path != "/config/apps/http/servers/srv0/routes" {
+		t.Errorf("Expected POST to srv0 routes, got %s %s", post.Method, post.Path)
+	}
+	if post.Body["@id"] != "grove-testapp-feature-auth" {
+		t.Errorf("Expected route id grove-testapp-feature-auth, got %v", post.Body["@id"])
+	}
+
+	handle := post.Body["handle"].([]interface{})[0].(map[string]interface{})
+	upstream := handle["upstreams"].([]interface{})[0].(map[string]interface{})
+	if upstream["dial"] != "localhost:10123" {
+		t.Errorf("Expected upstream localhost:10123, got %v", upstream["dial"])
+	}
+
+	del := requests[2]
+	if del.Method != http.MethodDelete || del.Path != "/id/grove-testapp-feature-auth" {
+		t.Errorf("Expected DELETE of route id, got %s %s", del.Method, del.Path)
+	}
+}
+
+func TestCaddyProxy_APIUnregisterMissing(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unknown object ID", http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	manager := newCaddyTestManager(t, CaddyConfig{Mode: "api", AdminAddress: server.URL})
+	backend := newCaddyProxy(manager)
+
+	// A route Caddy lost on restart is already gone
+	if err := backend.Unregister(context.Background(), Route{Name: "main", Host: "main.app.test", Port: 10001}); err != nil {
+		t.Errorf("Unregister() error = %v", err)
+	}
+}
+
+func TestCaddyProxy_APIError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "invalid traversal path", http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	manager := newCaddyTestManager(t, CaddyConfig{Mode: "api", AdminAddress: server.URL})
+	backend := newCaddyProxy(manager)
+
+	if err := backend.Register(context.Background(), Route{Name: "main", Host: "main.app.test", Port: 10001}); err == nil {
+		t.Error("Expected Register() to fail when the admin API rejects the route")
+	}
+}
@@ -0,0 +1,302 @@
+package worktree
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/rand"
+	"fmt"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/glanotte/grove/pkg/runner"
+)
+
+const (
+	defaultNginxProxyNetwork = "nginx-proxy"
+	defaultNginxProxyService = "app"
+	defaultNginxProxyAddress = "http://localhost"
+)
+
+// defaultVhostTemplate is used when nginx_proxy.custom_nginx_conf is not set
+const defaultVhostTemplate = `# Generated by grove for {{.Host}}
+{{- if .ClientMaxBodySize}}
+client_max_body_size {{.ClientMaxBodySize}};
+{{- end}}
+{{- if .Websockets}}
+proxy_http_version 1.1;
+proxy_set_header Upgrade $http_upgrade;
+proxy_set_header Connection "upgrade";
+{{- end}}
+`
+
+// nginxProxy customizes nginx-proxy through its vhost.d and htpasswd
+// directories. Routing itself comes from the VIRTUAL_HOST container variable.
+type nginxProxy struct {
+	m            *Manager
+	client       *http.Client
+	verifyWindow time.Duration
+}
+
+func newNginxProxy(m *Manager) *nginxProxy {
+	return &nginxProxy{
+		m:            m,
+		client:       &http.Client{Timeout: 5 * time.Second},
+		verifyWindow: 30 * time.Second,
+	}
+}
+
+// Register renders the vhost.d snippet for the route and ensures the proxy
+// network exists
+func (p *nginxProxy) Register(ctx context.Context, route Route) error {
+	cfg := p.m.Config.Web.NginxProxy
+
+	snippet, err := p.renderVhost(route)
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(p.vhostPath(route), snippet, 0644); err != nil {
+		return fmt.Errorf("failed to write vhost snippet: %w", err)
+	}
+
+	if cfg.BasicAuth.User != "" {
+		entry, err := htpasswdEntry(cfg.BasicAuth.User, cfg.BasicAuth.Password)
+		if err != nil {
+			return err
+		}
+		// Readable by the group nginx-proxy's workers run with, not by everyone
+		if err := writeFileAtomic(p.htpasswdPath(route), []byte(entry), 0640); err != nil {
+			return fmt.Errorf("failed to write htpasswd file: %w", err)
+		}
+	}
+
+	return p.m.ensureNetwork(ctx, p.network())
+}
+
+// Unregister removes the vhost.d snippet and htpasswd file for the route
+func (p *nginxProxy) Unregister(_ context.Context, route Route) error {
+	for _, path := range []string{p.vhostPath(route), p.htpasswdPath(route)} {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove %s: %w", path, err)
+		}
+	}
+	return nil
+}
+
+// AfterUp attaches the worktree's app to the proxy network and waits until
+// the proxy serves the host
+func (p *nginxProxy) AfterUp(ctx context.Context, route Route) error {
+	if err := p.attach(ctx, route); err != nil {
+		return err
+	}
+	return p.verify(ctx, route)
+}
+
+// renderVhost executes the custom conf template for a route
+func (p *nginxProxy) renderVhost(route Route) ([]byte, error) {
+	cfg := p.m.Config.Web.NginxProxy
+
+	content := defaultVhostTemplate
+	name := "vhost"
+	if cfg.CustomNginxConf != "" {
+		data, err := os.ReadFile(p.m.resolvePath(cfg.CustomNginxConf))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read custom nginx conf: %w", err)
+		}
+		content = string(data)
+		name = filepath.Base(cfg.CustomNginxConf)
+	}
+
+	tmpl, err := template.New(name).Parse(content)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse custom nginx conf: %w", err)
+	}
+
+	data := map[string]interface{}{
+		"Host":              route.Host,
+		"Port":              route.Port,
+		"BranchName":        route.Name,
+		"WorktreePath":      route.WorktreePath,
+		"ClientMaxBodySize": cfg.ClientMaxBodySize,
+		"Websockets":        cfg.Websockets,
+		"BasicAuth":         cfg.BasicAuth.User != "",
+		"HtpasswdFile":      "/etc/nginx/htpasswd/" + route.Host,
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return nil, fmt.Errorf("failed to execute custom nginx conf: %w", err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// attach connects the worktree's app container to the proxy network
+func (p *nginxProxy) attach(ctx context.Context, route Route) error {
+	service := p.m.Config.Web.NginxProxy.Service
+	if service == "" {
+		service = defaultNginxProxyService
+	}
+
+	ps, err := p.m.run(ctx, p.m.compose(route.WorktreePath, "ps", "-q", service))
+	if err != nil {
+		return fmt.Errorf("failed to find %s container: %w", service, err)
+	}
+
+	containerID := strings.TrimSpace(string(ps.Stdout))
+	if containerID == "" {
+		return fmt.Errorf("service '%s' is not running", service)
+	}
+
+	inspect, err := p.m.run(ctx, runner.Command("docker", "inspect", "-f", "{{json .NetworkSettings.Networks}}", containerID))
+	if err == nil && strings.Contains(string(inspect.Stdout), fmt.Sprintf("%q", p.network())) {
+		return nil
+	}
+
+	if result, err := p.m.run(ctx, runner.Command("docker", "network", "connect", p.network(), containerID)); err != nil {
+		return fmt.Errorf("failed to attach %s to %s: %s", service, p.network(), commandOutput(result, err))
+	}
+
+	return nil
+}
+
+// verify polls the proxy until it answers for the route's host. nginx-proxy
+// answers 503 for hosts it doesn't know and 502 while the app is starting.
+func (p *nginxProxy) verify(ctx context.Context, route Route) error {
+	address := p.m.Config.Web.NginxProxy.Address
+	if address == "" {
+		address = defaultNginxProxyAddress
+	}
+
+	deadline := time.Now().Add(p.verifyWindow)
+	lastStatus := "no response"
+	for {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, address, nil)
+		if err != nil {
+			return fmt.Errorf("invalid nginx-proxy address: %w", err)
+		}
+		req.Host = route.Host
+
+		resp, err := p.client.Do(req)
+		if err == nil {
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusBadGateway && resp.StatusCode != http.StatusServiceUnavailable {
+				return nil
+			}
+			lastStatus = resp.Status
+		} else {
+			lastStatus = err.Error()
+		}
+
+		if time.Now().After(deadline) {
+			return fmt.Errorf("nginx-proxy did not serve %s: %s", route.Host, lastStatus)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+func (p *nginxProxy) network() string {
+	if p.m.Config.Web.NginxProxy.Network != "" {
+		return p.m.Config.Web.NginxProxy.Network
+	}
+	return defaultNginxProxyNetwork
+}
+
+func (p *nginxProxy) vhostPath(route Route) string {
+	dir := p.m.Config.Web.NginxProxy.VhostDir
+	if dir == "" {
+		dir = filepath.Join(".grove", "nginx", "vhost.d")
+	}
+	return filepath.Join(p.m.resolvePath(dir), route.Host)
+}
+
+func (p *nginxProxy) htpasswdPath(route Route) string {
+	dir := p.m.Config.Web.NginxProxy.HtpasswdDir
+	if dir == "" {
+		dir = filepath.Join(".grove", "nginx", "htpasswd")
+	}
+	return filepath.Join(p.m.resolvePath(dir), route.Host)
+}
+
+// htpasswdEntry returns an htpasswd line hashing the password with a random
+// salt in the APR1 scheme nginx accepts
+func htpasswdEntry(user, password string) (string, error) {
+	salt := make([]byte, 8)
+	max := big.NewInt(int64(len(apr1Alphabet)))
+	for i := range salt {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", fmt.Errorf("failed to generate salt: %w", err)
+		}
+		salt[i] = apr1Alphabet[n.Int64()]
+	}
+	return fmt.Sprintf("%s:%s\n", user, apr1Hash(password, string(salt))), nil
+}
+
+const apr1Alphabet = "./0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+// apr1Hash implements Apache's MD5-based $apr1$ password hash
+func apr1Hash(password, salt string) string {
+	const magic = "$apr1$"
+	pw := []byte(password)
+
+	alt := md5.Sum([]byte(password + salt + password))
+	h := md5.New()
+	h.Write([]byte(password + magic + salt))
+	for i := len(pw); i > 0; i -= 16 {
+		h.Write(alt[:min(i, 16)])
+	}
+	for i := len(pw); i > 0; i >>= 1 {
+		if i&1 == 1 {
+			h.Write([]byte{0})
+		} else {
+			h.Write(pw[:1])
+		}
+	}
+	sum := h.Sum(nil)
+
+	// Stretch the hash as the scheme requires
+	for i := 0; i < 1000; i++ {
+		h := md5.New()
+		if i&1 == 1 {
+			h.Write(pw)
+		} else {
+			h.Write(sum)
+		}
+		if i%3 != 0 {
+			h.Write([]byte(salt))
+		}
+		if i%7 != 0 {
+			h.Write(pw)
+		}
+		if i&1 == 1 {
+			h.Write(sum)
+		} else {
+			h.Write(pw)
+		}
+		sum = h.Sum(nil)
+	}
+
+	var b strings.Builder
+	b.WriteString(magic + salt + "$")
+	encode := func(v uint, n int) {
+		for ; n > 0; n-- {
+			b.WriteByte(apr1Alphabet[v&0x3f])
+			v >>= 6
+		}
+	}
+	for _, g := range [][3]int{{0, 6, 12}, {1, 7, 13}, {2, 8, 14}, {3, 9, 15}, {4, 10, 5}} {
+		encode(uint(sum[g[0]])<<16|uint(sum[g[1]])<<8|uint(sum[g[2]]), 4)
+	}
+	encode(uint(sum[11]), 2)
+	return b.String()
+}
@@ -0,0 +1,187 @@
+package worktree
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/glanotte/grove/pkg/runner"
+)
+
+func newNginxTestManager(t *testing.T, cfg NginxProxyConfig) *Manager {
+	return &Manager{
+		BaseDir: t.TempDir(),
+		Config: &Config{
+			Project: ProjectConfig{
+				Name:   "testapp",
+				Domain: "app.test",
+			},
+			Web: WebConfig{
+				Enabled:          true,
+				ProxyType:        "nginx-proxy",
+				SubdomainPattern: "{branch}.{project_domain}",
+				NginxProxy:       cfg,
+			},
+		},
+	}
+}
+
+func TestNginxProxy_renderVhost(t *testing.T) {
+	route := Route{Name: "feature-auth", Host: "feature-auth.app.test", Port: 10123}
+
+	t.Run("default template", func(t *testing.T) {
+		manager := newNginxTestManager(t, NginxProxyConfig{
+			ClientMaxBodySize: "100m",
+			Websockets:        true,
+		})
+
+		got, err := newNginxProxy(manager).renderVhost(route)
+		if err != nil {
+			t.Fatalf("renderVhost() error = %v", err)
+		}
+
+		for _, want := range []string{"client_max_body_size 100m;", "proxy_set_header Upgrade $http_upgrade;"} {
+			if !strings.Contains(string(got), want) {
+				t.Errorf("Expected snippet to contain %q, got:\n%s", want, got)
+			}
+		}
+	})
+
+	t.Run("custom template", func(t *testing.T) {
+		manager := newNginxTestManager(t, NginxProxyConfig{
+			CustomNginxConf: ".grove/nginx/custom.conf",
+			BasicAuth:       BasicAuthConfig{User: "dev", Password: "secret"},
+		})
+
+		custom := "# {{.Host}} -> {{.Port}}\n{{if .BasicAuth}}auth_basic_user_file {{.HtpasswdFile}};{{end}}\n"
+		path := filepath.Join(manager.BaseDir, ".grove", "nginx", "custom.conf")
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(custom), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := newNginxProxy(manager).renderVhost(route)
+		if err != nil {
+			t.Fatalf("renderVhost() error = %v", err)
+		}
+
+		want := "# feature-auth.app.test -> 10123\nauth_basic_user_file /etc/nginx/htpasswd/feature-auth.app.test;\n"
+		if string(got) != want {
+			t.Errorf("renderVhost() = %q, want %q", got, want)
+		}
+	})
+}
+
+func TestNginxProxy_RegisterBasicAuth(t *testing.T) {
+	manager := newNginxTestManager(t, NginxProxyConfig{BasicAuth: BasicAuthConfig{User: "dev", Password: "secret"}})
+	manager.Runner = runner.NewFake()
+	backend := newNginxProxy(manager)
+	route := Route{Name: "main", Host: "main.app.test", Port: 10001}
+
+	if err := backend.Register(context.Background(), route); err != nil {
+		t.Fatalf("Register() error = %v", err)
+	}
+
+	info, err := os.Stat(backend.htpasswdPath(route))
+	if err != nil {
+		t.Fatalf("Expected an htpasswd file: %v", err)
+	}
+	if info.Mode().Perm() != 0640 {
+		t.Errorf("htpasswd mode = %v, want 0640", info.Mode().Perm())
+	}
+}
+
+func TestNginxProxy_Unregister(t *testing.T) {
+	manager := newNginxTestManager(t, NginxProxyConfig{})
+	backend := newNginxProxy(manager)
+	route := Route{Name: "main", Host: "main.app.test"}
+
+	for _, path := range []string{backend.vhostPath(route), backend.htpasswdPath(route)} {
+		if err := writeFileAtomic(path, []byte("x"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := backend.Unregister(context.Background(), route); err != nil {
+		t.Fatalf("Unregister() error = %v", err)
+	}
+
+	for _, path := range []string{backend.vhostPath(route), backend.htpasswdPath(route)} {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("Expected %s to be removed", path)
+		}
+	}
+}
+
+func TestNginxProxy_verify(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Host != "main.app.test" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		// Simulate the app still starting on the first request
+		if atomic.AddInt32(&requests, 1) == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	manager := newNginxTestManager(t, NginxProxyConfig{Address: server.URL})
+	backend := newNginxProxy(manager)
+	backend.verifyWindow = 5 * time.Second
+
+	if err := backend.verify(context.Background(), Route{Host: "main.app.test"}); err != nil {
+		t.Errorf("verify() error = %v", err)
+	}
+
+	backend.verifyWindow = 0
+	if err := backend.verify(context.Background(), Route{Host: "unknown.app.test"}); err == nil {
+		t.Error("Expected verify() to fail for a host the proxy doesn't serve")
+	}
+}
+
+func TestApr1Hash(t *testing.T) {
+	tests := []struct {
+		password string
+		salt     string
+		want     string
+	}{
+		{"secret", "abcdefgh", "$apr1$abcdefgh$h9FWgUz3n9YxylKLlR5SQ/"},
+		{"a much longer password than sixteen", "xyz", "$apr1$xyz$0Oxkg6Mx1XYzpHgDNzsQY/"},
+	}
+
+	for _, tt := range tests {
+		if got := apr1Hash(tt.password, tt.salt); got != tt.want {
+			t.Errorf("apr1Hash(%q, %q) = %q, want %q", tt.password, tt.salt, got, tt.want)
+		}
+	}
+}
+
+func TestHtpasswdEntry(t *testing.T) {
+	a, err := htpasswdEntry("dev", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := htpasswdEntry("dev", "secret")
+	if !strings.HasPrefix(a, "dev:$apr1$") || a == b {
+		t.Errorf("htpasswdEntry() = %q, %q, want salted APR1 entries", a, b)
+	}
+
+	// The entry verifies against its own salt
+	hash := strings.TrimSuffix(strings.TrimPrefix(a, "dev:"), "\n")
+	salt := strings.Split(hash, "$")[2]
+	if apr1Hash("secret", salt) != hash {
+		t.Errorf("htpasswdEntry() hash %q doesn't verify", hash)
+	}
+}
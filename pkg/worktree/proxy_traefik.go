@@ -0,0 +1,184 @@
+package worktree
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// defaultContainerPort is the port the web service in the default compose
+// template listens on
+const defaultContainerPort = 3000
+
+// traefikProxy publishes routes through Traefik's file provider
+type traefikProxy struct {
+	m *Manager
+}
+
+type traefikDynamicConfig struct {
+	HTTP *traefikHTTPConfig `yaml:"http,omitempty"`
+	TLS  *traefikTLSConfig  `yaml:"tls,omitempty"`
+}
+
+type traefikHTTPConfig struct {
+	Routers  map[string]traefikRouter  `yaml:"routers"`
+	Services map[string]traefikService `yaml:"services"`
+}
+
+type traefikRouter struct {
+	Rule        string    `yaml:"rule"`
+	EntryPoints []string  `yaml:"entryPoints,omitempty"`
+	Middlewares []string  `yaml:"middlewares,omitempty"`
+	Service     string    `yaml:"service"`
+	TLS         *struct{} `yaml:"tls,omitempty"`
+}
+
+type traefikService struct {
+	LoadBalancer traefikLoadBalancer `yaml:"loadBalancer"`
+}
+
+type traefikLoadBalancer struct {
+	Servers []traefikServer `yaml:"servers"`
+}
+
+type traefikServer struct {
+	URL string `yaml:"url"`
+}
+
+type traefikTLSConfig struct {
+	Certificates []traefikCertificate `yaml:"certificates"`
+}
+
+type traefikCertificate struct {
+	CertFile string `yaml:"certFile"`
+	KeyFile  string `yaml:"keyFile"`
+}
+
+// Register writes the dynamic configuration file for the route
+func (p *traefikProxy) Register(_ context.Context, route Route) error {
+	dynamic := p.dynamicConfig(route)
+	if p.m.Config.Web.Traefik.Labels {
+		// Routing is carried by the compose labels rendered into templates,
+		// but certificates can only be loaded through the file provider
+		if dynamic.TLS == nil {
+			return nil
+		}
+		dynamic.HTTP = nil
+	}
+
+	data, err := yaml.Marshal(dynamic)
+	if err != nil {
+		return fmt.Errorf("failed to encode traefik config: %w", err)
+	}
+
+	if err := writeFileAtomic(p.configPath(route), data, 0644); err != nil {
+		return fmt.Errorf("failed to write traefik config: %w", err)
+	}
+
+	return nil
+}
+
+// Unregister deletes the dynamic configuration file for the route
+func (p *traefikProxy) Unregister(_ context.Context, route Route) error {
+	if err := os.Remove(p.configPath(route)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove traefik config: %w", err)
+	}
+	return nil
+}
+
+// dynamicConfig builds the router and service for a route
+func (p *traefikProxy) dynamicConfig(route Route) traefikDynamicConfig {
+	name := p.routerName(route)
+	cfg := p.m.Config.Web.Traefik
+
+	router := traefikRouter{
+		Rule:        fmt.Sprintf("Host(`%s`)", route.Host),
+		Middlewares: cfg.Middlewares,
+		Service:     name,
+	}
+	if cfg.Entrypoint != "" {
+		router.EntryPoints = []string{cfg.Entrypoint}
+	}
+	if p.m.localCertificates() {
+		router.TLS = &struct{}{}
+	}
+
+	dynamic := traefikDynamicConfig{
+		HTTP: &traefikHTTPConfig{
+			Routers: map[string]traefikRouter{name: router},
+			Services: map[string]traefikService{
+				name: {
+					LoadBalancer: traefikLoadBalancer{
+						Servers: []traefikServer{
+							{URL: fmt.Sprintf("http://%s:%d", p.m.upstreamHost(), route.Port)},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	if router.TLS != nil {
+		certPath, keyPath := p.m.certPaths(route)
+		dynamic.TLS = &traefikTLSConfig{
+			Certificates: []traefikCertificate{{CertFile: certPath, KeyFile: keyPath}},
+		}
+	}
+
+	return dynamic
+}
+
+// labels returns the docker provider labels equivalent to the dynamic config
+func (p *traefikProxy) labels(route Route) []string {
+	name := p.routerName(route)
+	cfg := p.m.Config.Web.Traefik
+
+	labels := []string{
+		"traefik.enable=true",
+		fmt.Sprintf("traefik.http.routers.%s.rule=Host(`%s`)", name, route.Host),
+		fmt.Sprintf("traefik.http.routers.%s.service=%s", name, name),
+		fmt.Sprintf("traefik.http.services.%s.loadbalancer.server.port=%d", name, p.containerPort()),
+	}
+	if cfg.Entrypoint != "" {
+		labels = append(labels, fmt.Sprintf("traefik.http.routers.%s.entrypoints=%s", name, cfg.Entrypoint))
+	}
+	if len(cfg.Middlewares) > 0 {
+		labels = append(labels, fmt.Sprintf("traefik.http.routers.%s.middlewares=%s", name, strings.Join(cfg.Middlewares, ",")))
+	}
+	if p.m.localCertificates() {
+		labels = append(labels, fmt.Sprintf("traefik.http.routers.%s.tls=true", name))
+	}
+	if cfg.Network != "" {
+		labels = append(labels, fmt.Sprintf("traefik.docker.network=%s", cfg.Network))
+	}
+
+	return labels
+}
+
+// containerPort returns the port Traefik dials on the web container. Labels
+// route over the docker network, so the host port published for the
+// worktree doesn't apply
+func (p *traefikProxy) containerPort() int {
+	if port := p.m.Config.Web.Traefik.ContainerPort; port != 0 {
+		return port
+	}
+	return defaultContainerPort
+}
+
+// routerName returns the router and service name used for a route
+func (p *traefikProxy) routerName(route Route) string {
+	return fmt.Sprintf("%s-%s", p.m.Config.Project.Name, route.Name)
+}
+
+// configPath returns the dynamic configuration file for a route
+func (p *traefikProxy) configPath(route Route) string {
+	dir := p.m.Config.Web.Traefik.DynamicDir
+	if dir == "" {
+		dir = filepath.Join(".grove", "traefik")
+	}
+	return filepath.Join(p.m.resolvePath(dir), p.routerName(route)+".yml")
+}
@@ -0,0 +1,151 @@
+package worktree
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func newTraefikTestManager(t *testing.T) *Manager {
+	return &Manager{
+		BaseDir: t.TempDir(),
+		Config: &Config{
+			Project: ProjectConfig{
+				Name:   "testapp",
+				Domain: "app.test",
+			},
+			Docker: DockerConfig{
+				Ports: PortsConfig{RangeStart: 10000},
+			},
+			Web: WebConfig{
+				Enabled:          true,
+				ProxyType:        "traefik",
+				SubdomainPattern: "{branch}.{project_domain}",
+				Traefik: TraefikConfig{
+					Network:     "traefik",
+					Entrypoint:  "websecure",
+					Middlewares: []string{"redirect-to-https", "security-headers"},
+				},
+			},
+		},
+	}
+}
+
+func TestTraefikProxy_Register(t *testing.T) {
+	manager := newTraefikTestManager(t)
+	route := manager.route("/tmp/worktrees/feature-auth", "feature-auth")
+
+	backend, err := manager.proxyBackend()
+	if err != nil {
+		t.Fatalf("proxyBackend() error = %v", err)
+	}
+
+	if err := backend.Register(context.Background(), route); err != nil {
+		t.Fatalf("Register() error = %v", err)
+	}
+
+	path := filepath.Join(manager.BaseDir, ".grove", "traefik", "testapp-feature-auth.yml")
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Expected dynamic config at %s: %v", path, err)
+	}
+
+	var got traefikDynamicConfig
+	if err := yaml.Unmarshal(data, &got); err != nil {
+		t.Fatalf("Failed to parse dynamic config: %v", err)
+	}
+
+	router, ok := got.HTTP.Routers["testapp-feature-auth"]
+	if !ok {
+		t.Fatalf("Expected router testapp-feature-auth, got %v", got.HTTP.Routers)
+	}
+	if router.Rule != "Host(`feature-auth.app.test`)" {
+		t.Errorf("Expected host rule, got %s", router.Rule)
+	}
+	if !reflect.DeepEqual(router.EntryPoints, []string{"websecure"}) {
+		t.Errorf("Expected websecure entrypoint, got %v", router.EntryPoints)
+	}
+	if !reflect.DeepEqual(router.Middlewares, []string{"redirect-to-https", "security-headers"}) {
+		t.Errorf("Expected middlewares to be copied, got %v", router.Middlewares)
+	}
+
+	servers := got.HTTP.Services["testapp-feature-auth"].LoadBalancer.Servers
+	wantURL := fmt.Sprintf("http://localhost:%d", route.Port)
+	if len(servers) != 1 || servers[0].URL != wantURL {
+		t.Errorf("Expected server %s, got %v", wantURL, servers)
+	}
+
+	if err := backend.Unregister(context.Background(), route); err != nil {
+		t.Fatalf("Unregister() error = %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("Expected dynamic config to be removed")
+	}
+
+	// Unregistering twice is not an error
+	if err := backend.Unregister(context.Background(), route); err != nil {
+		t.Errorf("Unregister() of missing route error = %v", err)
+	}
+}
+
+func TestTraefikProxy_Labels(t *testing.T) {
+	manager := newTraefikTestManager(t)
+	manager.Config.Web.Traefik.Labels = true
+
+	route := manager.route("/tmp/worktrees/feature-auth", "feature-auth")
+	backend := &traefikProxy{m: manager}
+
+	if err := backend.Register(context.Background(), route); err != nil {
+		t.Fatalf("Register() error = %v", err)
+	}
+	if _, err := os.Stat(backend.configPath(route)); !os.IsNotExist(err) {
+		t.Error("Expected no dynamic config to be written in labels mode")
+	}
+
+	want := []string{
+		"traefik.enable=true",
+		"traefik.http.routers.testapp-feature-auth.rule=Host(`feature-auth.app.test`)",
+		"traefik.http.routers.testapp-feature-auth.service=testapp-feature-auth",
+		"traefik.http.services.testapp-feature-auth.loadbalancer.server.port=3000",
+		"traefik.http.routers.testapp-feature-auth.entrypoints=websecure",
+		"traefik.http.routers.testapp-feature-auth.middlewares=redirect-to-https,security-headers",
+		"traefik.docker.network=traefik",
+	}
+
+	ctx := manager.buildTemplateContext(context.Background(), route.WorktreePath, "feature/auth")
+	if !reflect.DeepEqual(ctx["TraefikLabels"], want) {
+		t.Errorf("TraefikLabels = %v, want %v", ctx["TraefikLabels"], want)
+	}
+}
+
+func TestManager_proxyBackend(t *testing.T) {
+	tests := []struct {
+		proxyType string
+		wantNil   bool
+		wantErr   bool
+	}{
+		{proxyType: "", wantNil: true},
+		{proxyType: "nginx-proxy"},
+		{proxyType: "traefik"},
+		{proxyType: "caddy"},
+		{proxyType: "unknown", wantNil: true, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.proxyType, func(t *testing.T) {
+			manager := &Manager{Config: &Config{Web: WebConfig{ProxyType: tt.proxyType}}}
+			backend, err := manager.proxyBackend()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("proxyBackend() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if (backend == nil) != tt.wantNil {
+				t.Errorf("proxyBackend() = %v, wantNil %v", backend, tt.wantNil)
+			}
+		})
+	}
+}
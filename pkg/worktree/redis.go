@@ -0,0 +1,112 @@
+package worktree
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/glanotte/grove/pkg/runner"
+)
+
+const (
+	defaultRedisDatabases       = 16
+	defaultRedisDatabasePattern = "{branch_id}"
+)
+
+// branchID returns the ID allocated to a branch's worktree. Branches grove
+// didn't create, such as the main checkout, use 0.
+func (m *Manager) branchID(branchName string) int {
+	if state, err := m.loadState(); err == nil {
+		return state.Worktrees[branchName].BranchID
+	}
+	return 0
+}
+
+// allocateBranchID returns the branch's existing ID, or the lowest ID not used
+// by another worktree so IDs are reused after removal
+func (m *Manager) allocateBranchID(state *State, branchName string) (int, error) {
+	if wt, ok := state.Worktrees[branchName]; ok && wt.BranchID > 0 {
+		return wt.BranchID, nil
+	}
+
+	used := make(map[int]bool)
+	for branch, wt := range state.Worktrees {
+		if branch != branchName {
+			used[wt.BranchID] = true
+		}
+	}
+
+	id := 1
+	for used[id] {
+		id++
+	}
+
+	// Redis only has a fixed number of databases, and 0 belongs to the main
+	// checkout
+	if m.Config.Cache.Redis.Enabled && id >= m.redisDatabases() {
+		return 0, fmt.Errorf("no free Redis database: all %d are in use (raise cache.redis.databases)", m.redisDatabases()-1)
+	}
+	return id, nil
+}
+
+func (m *Manager) redisDatabases() int {
+	if m.Config.Cache.Redis.Databases > 0 {
+		return m.Config.Cache.Redis.Databases
+	}
+	return defaultRedisDatabases
+}
+
+// redisDB returns the Redis database index for a branch
+func (m *Manager) redisDB(branchName string) (int, error) {
+	pattern := m.Config.Cache.Redis.DatabasePattern
+	if pattern == "" {
+		pattern = defaultRedisDatabasePattern
+	}
+
+	db, err := strconv.Atoi(m.expand(pattern, branchName))
+	if err != nil || db < 0 || db >= m.redisDatabases() {
+		return 0, fmt.Errorf("cache.redis.database_pattern must expand to a database index below %d", m.redisDatabases())
+	}
+	return db, nil
+}
+
+// redisCommand returns the redis-cli invocation for a database, run in the
+// shared container or against host and port
+func (m *Manager) redisCommand(db int, args ...string) []string {
+	cfg := m.Config.Cache.Redis
+
+	cli := []string{"redis-cli"}
+	if cfg.Container != "" {
+		cli = []string{"docker", "exec", cfg.Container, "redis-cli"}
+	} else {
+		if cfg.Host != "" {
+			cli = append(cli, "-h", cfg.Host)
+		}
+		if cfg.Port != 0 {
+			cli = append(cli, "-p", strconv.Itoa(cfg.Port))
+		}
+	}
+
+	return append(append(cli, "-n", strconv.Itoa(db)), args...)
+}
+
+// flushRedis empties the branch's Redis database
+func (m *Manager) flushRedis(ctx context.Context, branchName string) error {
+	db, err := m.redisDB(branchName)
+	if err != nil {
+		return err
+	}
+	if db == 0 {
+		// Never flush the database shared with the main checkout
+		return nil
+	}
+
+	args := m.redisCommand(db, "FLUSHDB")
+	result, err := m.run(ctx, runner.Command(args[0], args[1:]...))
+	if err != nil {
+		return fmt.Errorf("failed to flush Redis database %d: %s", db, commandOutput(result, err))
+	}
+
+	fmt.Printf("Flushed Redis database %d\n", db)
+	return nil
+}
@@ -0,0 +1,92 @@
+package worktree
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestManager_allocateBranchID(t *testing.T) {
+	manager := &Manager{Config: &Config{
+		Cache: CacheConfig{Redis: RedisConfig{Enabled: true, Databases: 4}},
+	}}
+
+	state := &State{Worktrees: map[string]WorktreeState{
+		"feature/a": {Branch: "feature/a", BranchID: 1},
+		"feature/c": {Branch: "feature/c", BranchID: 3},
+	}}
+
+	// The lowest free ID is reused
+	id, err := manager.allocateBranchID(state, "feature/b")
+	if err != nil || id != 2 {
+		t.Fatalf("allocateBranchID(feature/b) = %d, %v, want 2", id, err)
+	}
+	state.Worktrees["feature/b"] = WorktreeState{Branch: "feature/b", BranchID: id}
+
+	// Known branches keep their ID
+	if id, _ := manager.allocateBranchID(state, "feature/c"); id != 3 {
+		t.Errorf("allocateBranchID(feature/c) = %d, want 3", id)
+	}
+
+	// Databases 1-3 are taken and 0 belongs to the main checkout
+	if _, err := manager.allocateBranchID(state, "feature/d"); err == nil {
+		t.Error("Expected an error once every Redis database is in use")
+	}
+
+	// Without Redis there is no cap
+	manager.Config.Cache.Redis.Enabled = false
+	if id, err := manager.allocateBranchID(state, "feature/d"); err != nil || id != 4 {
+		t.Errorf("allocateBranchID(feature/d) = %d, %v, want 4", id, err)
+	}
+}
+
+func TestManager_redisDB(t *testing.T) {
+	manager := &Manager{
+		BaseDir: t.TempDir(),
+		Config:  &Config{Cache: CacheConfig{Redis: RedisConfig{Enabled: true}}},
+	}
+
+	err := manager.updateState(func(state *State) error {
+		state.Worktrees["feature/auth"] = WorktreeState{Branch: "feature/auth", Slug: "feature-auth", BranchID: 5}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := manager.buildTemplateContext(context.Background(), "/tmp/worktrees/feature-auth", "feature/auth")
+	if ctx["BranchID"] != 5 || ctx["RedisDB"] != 5 {
+		t.Errorf("BranchID = %v, RedisDB = %v, want 5", ctx["BranchID"], ctx["RedisDB"])
+	}
+
+	// Branches grove didn't create share database 0
+	if db, err := manager.redisDB("main"); err != nil || db != 0 {
+		t.Errorf("redisDB(main) = %d, %v, want 0", db, err)
+	}
+
+	manager.Config.Cache.Redis.DatabasePattern = "{branch}"
+	if _, err := manager.redisDB("feature/auth"); err == nil {
+		t.Error("Expected an error for a non-numeric database pattern")
+	}
+}
+
+func TestManager_redisCommand(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  RedisConfig
+		want []string
+	}{
+		{name: "local", cfg: RedisConfig{}, want: []string{"redis-cli", "-n", "3", "FLUSHDB"}},
+		{name: "host and port", cfg: RedisConfig{Host: "cache", Port: 6380}, want: []string{"redis-cli", "-h", "cache", "-p", "6380", "-n", "3", "FLUSHDB"}},
+		{name: "container", cfg: RedisConfig{Container: "shared-redis"}, want: []string{"docker", "exec", "shared-redis", "redis-cli", "-n", "3", "FLUSHDB"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			manager := &Manager{Config: &Config{Cache: CacheConfig{Redis: tt.cfg}}}
+			if got := manager.redisCommand(3, "FLUSHDB"); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("redisCommand() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,47 @@
+package worktree
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+)
+
+// rollbackTimeout bounds undoing a failed operation, which keeps running
+// after the operation itself was cancelled
+const rollbackTimeout = 2 * time.Minute
+
+// rollback collects the undo steps of an operation in progress
+type rollback []undoStep
+
+type undoStep struct {
+	label string
+	undo  func(context.Context) error
+}
+
+// add records how to undo a step. Helpers shared with operations that don't
+// roll back are passed a nil rollback, which ignores it.
+func (r *rollback) add(label string, undo func(context.Context) error) {
+	if r == nil {
+		return
+	}
+	*r = append(*r, undoStep{label: label, undo: undo})
+}
+
+// run undoes the recorded steps, newest first. It runs even when ctx was
+// cancelled, and reports steps it can't undo rather than stopping.
+func (r rollback) run(ctx context.Context) {
+	if len(r) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), rollbackTimeout)
+	defer cancel()
+
+	fmt.Fprintln(os.Stderr, "Rolling back...")
+	for i := len(r) - 1; i >= 0; i-- {
+		if err := r[i].undo(ctx); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to %s: %v\n", r[i].label, err)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package worktree
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+)
+
+// schemaEnums lists the accepted values of config keys with a fixed set
+var schemaEnums = map[string][]string{
+	"web.proxy_type":   {"nginx-proxy", "traefik", "caddy", "builtin"},
+	"web.ssl.provider": {"letsencrypt", "self-signed", "mkcert"},
+	"web.hosts.mode":   {"auto", "always", "never"},
+	"web.caddy.mode":   {"file", "api"},
+	"database.type":    {"postgres", "postgresql", "mysql", "mariadb"},
+}
+
+// ConfigSchema returns a JSON Schema describing .grove/config.yaml for
+// editor completion and validation
+func ConfigSchema() ([]byte, error) {
+	schema := typeSchema(reflect.TypeOf(Config{}), "")
+	schema["$schema"] = "https://json-schema.org/draft/2020-12/schema"
+	schema["title"] = "grove configuration"
+
+	properties := schema["properties"].(map[string]interface{})
+	properties["version"] = map[string]interface{}{
+		"type":    "integer",
+		"minimum": 1,
+		"maximum": CurrentConfigVersion,
+	}
+	// Overlays are partial configs
+	properties["environments"] = map[string]interface{}{
+		"type":                 "object",
+		"additionalProperties": map[string]interface{}{"$ref": "#"},
+	}
+
+	return json.MarshalIndent(schema, "", "  ")
+}
+
+// typeSchema describes a config type; path is its dotted key
+func typeSchema(t reflect.Type, path string) map[string]interface{} {
+	if values := schemaEnums[path]; values != nil {
+		return map[string]interface{}{"type": "string", "enum": values}
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		properties := make(map[string]interface{})
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			name, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+			if name == "" || name == "-" {
+				continue
+			}
+			key := name
+			if path != "" {
+				key = path + "." + name
+			}
+			properties[name] = typeSchema(field.Type, key)
+		}
+		return map[string]interface{}{"type": "object", "properties": properties}
+	case reflect.Map:
+		return map[string]interface{}{
+			"type":                 "object",
+			"additionalProperties": typeSchema(t.Elem(), ""),
+		}
+	case reflect.Slice:
+		return map[string]interface{}{"type": "array", "items": typeSchema(t.Elem(), "")}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int64:
+		return map[string]interface{}{"type": "integer"}
+	}
+	// interface{} values, such as custom variables, can be anything
+	return map[string]interface{}{}
+}
@@ -0,0 +1,40 @@
+package worktree
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestConfigSchema(t *testing.T) {
+	data, err := ConfigSchema()
+	if err != nil {
+		t.Fatalf("ConfigSchema() error = %v", err)
+	}
+
+	var schema struct {
+		Properties map[string]struct {
+			Type       string `json:"type"`
+			Maximum    int    `json:"maximum"`
+			Properties map[string]struct {
+				Type string   `json:"type"`
+				Enum []string `json:"enum"`
+			} `json:"properties"`
+		} `json:"properties"`
+	}
+	if err := json.Unmarshal(data, &schema); err != nil {
+		t.Fatalf("ConfigSchema() is not valid JSON: %v", err)
+	}
+
+	if got := schema.Properties["version"].Maximum; got != CurrentConfigVersion {
+		t.Errorf("version maximum = %d, want %d", got, CurrentConfigVersion)
+	}
+	if got := schema.Properties["docker"].Properties["ports"].Type; got != "object" {
+		t.Errorf("docker.ports type = %q, want object", got)
+	}
+	if got := schema.Properties["worktree"].Properties["base_path"].Type; got != "string" {
+		t.Errorf("worktree.base_path type = %q, want string", got)
+	}
+	if got := schema.Properties["web"].Properties["proxy_type"].Enum; len(got) == 0 {
+		t.Error("web.proxy_type should list its values")
+	}
+}
@@ -0,0 +1,460 @@
+package worktree
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/glanotte/grove/pkg/runner"
+)
+
+const (
+	secretsFile     = "secrets.enc"
+	secretsMagic    = "GROVESEC1"
+	passphraseEnv   = "GROVE_SECRETS_PASSPHRASE"
+	redactedValue   = "********"
+	secretSaltSize  = 16
+	secretKeyLength = 32
+)
+
+// secretIterations is the PBKDF2 work factor for new secret stores
+var secretIterations = 210000
+
+// Stores outside this range of PBKDF2 iterations are refused, as too few
+// make the passphrase easy to guess and too many hang grove
+const (
+	minSecretIterations = 1000
+	maxSecretIterations = 10000000
+)
+
+// secretPrefixes are the sources a variable value can reference
+var secretPrefixes = []string{"env:", "file:", "cmd:", "secret:"}
+
+// isSecretRef reports whether a variable value references a secret source
+func isSecretRef(value string) bool {
+	for _, prefix := range secretPrefixes {
+		if strings.HasPrefix(value, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Secret is a template variable read from its source the first time it is
+// used. It prints as the secret in templates and hook environments, and as
+// a mask anywhere it is serialized.
+type Secret struct {
+	Ref string
+	m   *Manager
+	// ctx bounds cmd: references run while rendering
+	ctx context.Context
+	err error
+}
+
+// String resolves the secret, returning "" when it can't be read
+func (s *Secret) String() string {
+	value, err := s.m.resolveSecret(s.ctx, s.Ref)
+	if err != nil {
+		s.err = err
+		return ""
+	}
+	return value
+}
+
+// GoString keeps the secret out of debug output
+func (s *Secret) GoString() string {
+	return redactedValue
+}
+
+func (s *Secret) MarshalJSON() ([]byte, error) {
+	return json.Marshal(redactedValue)
+}
+
+func (s *Secret) MarshalYAML() (interface{}, error) {
+	return redactedValue, nil
+}
+
+// secretResult caches a resolved secret reference
+type secretResult struct {
+	value string
+	err   error
+}
+
+// wrapSecrets replaces secret references in a variable value, including
+// inside nested mappings and lists, with lazily resolved Secrets
+func (m *Manager) wrapSecrets(ctx context.Context, value interface{}) interface{} {
+	switch v := value.(type) {
+	case string:
+		if isSecretRef(v) {
+			return &Secret{Ref: v, m: m, ctx: ctx}
+		}
+	case map[string]interface{}:
+		wrapped := make(map[string]interface{}, len(v))
+		for k, item := range v {
+			wrapped[k] = m.wrapSecrets(ctx, item)
+		}
+		return wrapped
+	case []interface{}:
+		wrapped := make([]interface{}, len(v))
+		for i, item := range v {
+			wrapped[i] = m.wrapSecrets(ctx, item)
+		}
+		return wrapped
+	}
+	return value
+}
+
+// secretError returns the first failure among the Secrets in ctx that were
+// used
+func secretError(ctx interface{}) error {
+	switch v := ctx.(type) {
+	case *Secret:
+		if v.err != nil {
+			return fmt.Errorf("failed to resolve secret '%s': %w", v.Ref, v.err)
+		}
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if err := secretError(v[k]); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		for _, item := range v {
+			if err := secretError(item); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// resolveSecret reads a secret reference, once per Manager
+func (m *Manager) resolveSecret(ctx context.Context, ref string) (string, error) {
+	m.secretsMu.Lock()
+	defer m.secretsMu.Unlock()
+
+	if result, ok := m.secretCache[ref]; ok {
+		return result.value, result.err
+	}
+
+	kind, arg, _ := strings.Cut(ref, ":")
+	var value string
+	var err error
+	switch kind {
+	case "env":
+		var ok bool
+		if value, ok = os.LookupEnv(arg); !ok {
+			err = fmt.Errorf("environment variable %s is not set", arg)
+		}
+	case "file":
+		var data []byte
+		data, err = os.ReadFile(m.resolvePath(arg))
+		value = strings.TrimRight(string(data), "\r\n")
+	case "cmd":
+		value, err = m.secretCommand(ctx, arg)
+	case "secret":
+		value, err = m.storedSecret(arg)
+	default:
+		err = fmt.Errorf("unknown secret source '%s'", kind)
+	}
+
+	if m.secretCache == nil {
+		m.secretCache = make(map[string]secretResult)
+	}
+	m.secretCache[ref] = secretResult{value: value, err: err}
+	return value, err
+}
+
+// secretCommand runs a cmd: reference in the project root, returning its
+// output without the trailing newline
+func (m *Manager) secretCommand(ctx context.Context, command string) (string, error) {
+	cmd := runner.Command("sh", "-c", command)
+	cmd.Dir = m.BaseDir
+	result, err := m.run(ctx, cmd)
+	if err != nil {
+		return "", fmt.Errorf("'%s' failed: %s", command, commandOutput(result, err))
+	}
+	return strings.TrimRight(string(result.Stdout), "\r\n"), nil
+}
+
+// redact masks every secret resolved so far in text
+func (m *Manager) redact(text string) string {
+	m.secretsMu.Lock()
+	defer m.secretsMu.Unlock()
+
+	for _, result := range m.secretCache {
+		// Masking very short values would mangle unrelated output
+		if result.err == nil && len(result.value) >= 4 {
+			text = strings.ReplaceAll(text, result.value, redactedValue)
+		}
+	}
+	return text
+}
+
+// redactWriter masks resolved secrets in command output before passing it on
+type redactWriter struct {
+	m *Manager
+	w io.Writer
+}
+
+func (r redactWriter) Write(p []byte) (int, error) {
+	if _, err := io.WriteString(r.w, r.m.redact(string(p))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// secretsPath returns the encrypted secret store
+func (m *Manager) secretsPath() string {
+	return filepath.Join(m.BaseDir, ".grove", secretsFile)
+}
+
+// storedSecret reads a secret: reference from the encrypted store
+func (m *Manager) storedSecret(name string) (string, error) {
+	// Unlock the store once rather than for every reference
+	if m.secretStore == nil {
+		secrets, err := m.loadSecrets()
+		if err != nil {
+			return "", err
+		}
+		m.secretStore = secrets
+	}
+	value, ok := m.secretStore[name]
+	if !ok {
+		return "", fmt.Errorf("secret '%s' is not in %s", name, secretsFile)
+	}
+	return value, nil
+}
+
+// passphrase returns the secret store passphrase from Passphrase or
+// GROVE_SECRETS_PASSPHRASE
+func (m *Manager) passphrase() (string, error) {
+	if m.Passphrase != nil {
+		return m.Passphrase()
+	}
+	if p := os.Getenv(passphraseEnv); p != "" {
+		return p, nil
+	}
+	return "", fmt.Errorf("set %s to unlock .grove/%s", passphraseEnv, secretsFile)
+}
+
+// loadSecrets decrypts the secret store; a missing store is empty
+func (m *Manager) loadSecrets() (map[string]string, error) {
+	data, err := os.ReadFile(m.secretsPath())
+	if os.IsNotExist(err) {
+		return make(map[string]string), nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read secrets: %w", err)
+	}
+
+	passphrase, err := m.passphrase()
+	if err != nil {
+		return nil, err
+	}
+	plain, err := decryptSecrets(data, passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	secrets := make(map[string]string)
+	if err := json.Unmarshal(plain, &secrets); err != nil {
+		return nil, fmt.Errorf("failed to read secrets: %w", err)
+	}
+	return secrets, nil
+}
+
+// saveSecrets encrypts and writes the secret store, dropping the unlocked
+// copy so later references read the new values
+func (m *Manager) saveSecrets(secrets map[string]string) error {
+	m.secretsMu.Lock()
+	defer m.secretsMu.Unlock()
+
+	passphrase, err := m.passphrase()
+	if err != nil {
+		return err
+	}
+
+	plain, err := json.Marshal(secrets)
+	if err != nil {
+		return fmt.Errorf("failed to encode secrets: %w", err)
+	}
+	data, err := encryptSecrets(plain, passphrase)
+	if err != nil {
+		return err
+	}
+	if err := m.ensureGroveIgnore(); err != nil {
+		return err
+	}
+	if err := writeFileAtomic(m.secretsPath(), data, 0600); err != nil {
+		return err
+	}
+	m.secretStore = nil
+	return nil
+}
+
+// SetSecret stores a value in the encrypted secret store
+func (m *Manager) SetSecret(name, value string) error {
+	return m.SetSecretContext(context.Background(), name, value)
+}
+
+// SetSecretContext is SetSecret with a context
+func (m *Manager) SetSecretContext(ctx context.Context, name, value string) error {
+	release, err := m.lock(ctx, true)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	if name == "" {
+		return fmt.Errorf("secret name must not be empty")
+	}
+	secrets, err := m.loadSecrets()
+	if err != nil {
+		return err
+	}
+	secrets[name] = value
+	return m.saveSecrets(secrets)
+}
+
+// DeleteSecret removes a value from the encrypted secret store
+func (m *Manager) DeleteSecret(name string) error {
+	return m.DeleteSecretContext(context.Background(), name)
+}
+
+// DeleteSecretContext is DeleteSecret with a context
+func (m *Manager) DeleteSecretContext(ctx context.Context, name string) error {
+	release, err := m.lock(ctx, true)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	secrets, err := m.loadSecrets()
+	if err != nil {
+		return err
+	}
+	if _, ok := secrets[name]; !ok {
+		return fmt.Errorf("secret '%s' not found", name)
+	}
+	delete(secrets, name)
+	return m.saveSecrets(secrets)
+}
+
+// SecretNames lists the names in the encrypted secret store
+func (m *Manager) SecretNames() ([]string, error) {
+	secrets, err := m.loadSecrets()
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(secrets))
+	for name := range secrets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// encryptSecrets seals plain with AES-256-GCM under a key derived from the
+// passphrase. The file is the magic, PBKDF2 iteration count, salt, nonce and
+// ciphertext; the header is authenticated too.
+func encryptSecrets(plain []byte, passphrase string) ([]byte, error) {
+	salt := make([]byte, secretSaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, fmt.Errorf("failed to generate salt: %w", err)
+	}
+
+	header := make([]byte, 0, len(secretsMagic)+4+secretSaltSize)
+	header = append(header, secretsMagic...)
+	header = binary.BigEndian.AppendUint32(header, uint32(secretIterations))
+	header = append(header, salt...)
+
+	gcm, err := secretsCipher(passphrase, salt, secretIterations)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	out := append(header, nonce...)
+	return gcm.Seal(out, nonce, plain, header), nil
+}
+
+func decryptSecrets(data []byte, passphrase string) ([]byte, error) {
+	headerSize := len(secretsMagic) + 4 + secretSaltSize
+	if len(data) < headerSize || string(data[:len(secretsMagic)]) != secretsMagic {
+		return nil, fmt.Errorf("%s is not a grove secret store", secretsFile)
+	}
+	header := data[:headerSize]
+	iterations := int(binary.BigEndian.Uint32(data[len(secretsMagic):]))
+	salt := data[len(secretsMagic)+4 : headerSize]
+	if iterations < minSecretIterations || iterations > maxSecretIterations {
+		return nil, fmt.Errorf("%s has an invalid key derivation work factor (%d)", secretsFile, iterations)
+	}
+
+	gcm, err := secretsCipher(passphrase, salt, iterations)
+	if err != nil {
+		return nil, err
+	}
+	rest := data[headerSize:]
+	if len(rest) < gcm.NonceSize() {
+		return nil, fmt.Errorf("%s is truncated", secretsFile)
+	}
+
+	plain, err := gcm.Open(nil, rest[:gcm.NonceSize()], rest[gcm.NonceSize():], header)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt %s: wrong passphrase or corrupted file", secretsFile)
+	}
+	return plain, nil
+}
+
+func secretsCipher(passphrase string, salt []byte, iterations int) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(pbkdf2SHA256([]byte(passphrase), salt, iterations, secretKeyLength))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
+
+// pbkdf2SHA256 derives a key from a passphrase as in RFC 8018
+func pbkdf2SHA256(password, salt []byte, iterations, keyLen int) []byte {
+	prf := hmac.New(sha256.New, password)
+	var key []byte
+	for block := uint32(1); len(key) < keyLen; block++ {
+		prf.Reset()
+		prf.Write(salt)
+		prf.Write(binary.BigEndian.AppendUint32(nil, block))
+		u := prf.Sum(nil)
+
+		t := make([]byte, len(u))
+		copy(t, u)
+		for i := 1; i < iterations; i++ {
+			prf.Reset()
+			prf.Write(u)
+			u = prf.Sum(u[:0])
+			for j := range t {
+				t[j] ^= u[j]
+			}
+		}
+		key = append(key, t...)
+	}
+	return key[:keyLen]
+}
@@ -0,0 +1,228 @@
+package worktree
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newSecretsTestManager(t *testing.T) *Manager {
+	t.Helper()
+	old := secretIterations
+	secretIterations = 1000
+	t.Cleanup(func() { secretIterations = old })
+
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, ".grove", "templates"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return &Manager{
+		BaseDir:    dir,
+		Config:     &Config{Project: ProjectConfig{Name: "testapp", Domain: "app.test"}},
+		Passphrase: func() (string, error) { return "correct horse", nil },
+	}
+}
+
+func TestPBKDF2SHA256(t *testing.T) {
+	tests := []struct {
+		iterations int
+		want       string
+	}{
+		{1, "120fb6cffcf8b32c43e7225256c4f837a86548c92ccc35480805987cb70be17b"},
+		{2, "ae4d0c95af6b46d32d0adff928f06dd02a303f8ef3c251dfd6e2d85a95474c43"},
+	}
+
+	for _, tt := range tests {
+		got := hex.EncodeToString(pbkdf2SHA256([]byte("password"), []byte("salt"), tt.iterations, 32))
+		if got != tt.want {
+			t.Errorf("pbkdf2SHA256(%d iterations) = %s, want %s", tt.iterations, got, tt.want)
+		}
+	}
+}
+
+func TestManager_secretStore(t *testing.T) {
+	m := newSecretsTestManager(t)
+
+	if err := m.SetSecret("stripe_key", "sk_test_123"); err != nil {
+		t.Fatalf("SetSecret() error = %v", err)
+	}
+	if err := m.SetSecret("db_password", "hunter22"); err != nil {
+		t.Fatalf("SetSecret() error = %v", err)
+	}
+
+	data, err := os.ReadFile(m.secretsPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "hunter22") || strings.Contains(string(data), "db_password") {
+		t.Error("secret store is not encrypted")
+	}
+	if info, _ := os.Stat(m.secretsPath()); info.Mode().Perm() != 0600 {
+		t.Errorf("secret store mode = %v, want 0600", info.Mode().Perm())
+	}
+
+	names, err := m.SecretNames()
+	if err != nil || strings.Join(names, ",") != "db_password,stripe_key" {
+		t.Errorf("SecretNames() = %v, %v", names, err)
+	}
+
+	if err := m.DeleteSecret("stripe_key"); err != nil {
+		t.Fatalf("DeleteSecret() error = %v", err)
+	}
+	if err := m.DeleteSecret("stripe_key"); err == nil {
+		t.Error("DeleteSecret() of a missing secret should fail")
+	}
+
+	m.Passphrase = func() (string, error) { return "wrong", nil }
+	if _, err := m.SecretNames(); err == nil {
+		t.Error("SecretNames() with the wrong passphrase should fail")
+	}
+}
+
+func TestManager_secretStoreConcurrent(t *testing.T) {
+	m := newSecretsTestManager(t)
+	if err := m.SetSecret("api_key", "v0"); err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 50; i++ {
+			if err := m.saveSecrets(map[string]string{"api_key": fmt.Sprintf("v%d", i)}); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 50; i++ {
+			// A new reference each time reads through to the store
+			if _, err := m.resolveSecret(context.Background(), fmt.Sprintf("secret:api_key#%d", i)); err == nil {
+				t.Error("resolveSecret() of a missing secret succeeded")
+			}
+		}
+	}()
+	wg.Wait()
+}
+
+func TestManager_buildTemplateContext_secrets(t *testing.T) {
+	m := newSecretsTestManager(t)
+	if err := m.SetSecret("stripe_key", "sk_test_123"); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(m.BaseDir, ".grove", "api_token"), []byte("tok-file\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("TEST_DB_PASSWORD", "from-env")
+
+	m.Config.Variables = map[string]interface{}{
+		"db_password": "env:TEST_DB_PASSWORD",
+		"api_token":   "file:.grove/api_token",
+		"signing_key": "cmd:echo from-cmd",
+		"payments": map[string]interface{}{
+			"stripe_key": "secret:stripe_key",
+		},
+		"plain": "not-a-secret",
+	}
+
+	tmpl := "{{.db_password}} {{.api_token}} {{.signing_key}} {{.payments.stripe_key}} {{.plain}}"
+	if err := os.WriteFile(filepath.Join(m.BaseDir, ".grove", "templates", "env.tmpl"), []byte(tmpl), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	worktreePath := filepath.Join(m.BaseDir, "worktrees", "feature")
+	ctx := m.buildTemplateContext(context.Background(), worktreePath, "feature")
+	if err := m.processTemplateFile(worktreePath, TemplateFile{Src: "env.tmpl", Dest: ".env"}, ctx); err != nil {
+		t.Fatalf("processTemplateFile() error = %v", err)
+	}
+
+	got, err := os.ReadFile(filepath.Join(worktreePath, ".env"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "from-env tok-file from-cmd sk_test_123 not-a-secret"; string(got) != want {
+		t.Errorf("rendered %q, want %q", got, want)
+	}
+
+	// Resolved values are masked in output and never serialized
+	if got := m.redact("password is from-env"); got != "password is "+redactedValue {
+		t.Errorf("redact() = %q", got)
+	}
+	if got, _ := ctx["db_password"].(*Secret).MarshalJSON(); string(got) != `"`+redactedValue+`"` {
+		t.Errorf("MarshalJSON() = %s", got)
+	}
+}
+
+func TestManager_buildTemplateContext_missingSecret(t *testing.T) {
+	m := newSecretsTestManager(t)
+	m.Config.Variables = map[string]interface{}{
+		"db_password": "env:GROVE_TEST_UNSET_SECRET",
+		"unused":      "cmd:exit 1",
+	}
+
+	if err := os.WriteFile(filepath.Join(m.BaseDir, ".grove", "templates", "env.tmpl"), []byte("{{.db_password}}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	worktreePath := filepath.Join(m.BaseDir, "worktrees", "feature")
+	ctx := m.buildTemplateContext(context.Background(), worktreePath, "feature")
+	err := m.processTemplateFile(worktreePath, TemplateFile{Src: "env.tmpl", Dest: ".env"}, ctx)
+	if err == nil || !strings.Contains(err.Error(), "GROVE_TEST_UNSET_SECRET") {
+		t.Errorf("processTemplateFile() error = %v, want the unset variable", err)
+	}
+}
+
+func TestManager_buildTemplateContext_cancelledSecretCommand(t *testing.T) {
+	m := newSecretsTestManager(t)
+	m.Config.Variables = map[string]interface{}{"signing_key": "cmd:sleep 30"}
+
+	if err := os.WriteFile(filepath.Join(m.BaseDir, ".grove", "templates", "env.tmpl"), []byte("{{.signing_key}}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	worktreePath := filepath.Join(m.BaseDir, "worktrees", "feature")
+	vars := m.buildTemplateContext(ctx, worktreePath, "feature")
+	start := time.Now()
+	err := m.processTemplateFile(worktreePath, TemplateFile{Src: "env.tmpl", Dest: ".env"}, vars)
+	if err == nil || !strings.Contains(err.Error(), "context canceled") {
+		t.Errorf("processTemplateFile() error = %v, want the cancellation", err)
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("cmd: reference ran for %s after cancellation", elapsed)
+	}
+}
+
+func TestDecryptSecrets_iterations(t *testing.T) {
+	old := secretIterations
+	secretIterations = minSecretIterations
+	defer func() { secretIterations = old }()
+
+	data, err := encryptSecrets([]byte("{}"), "correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := decryptSecrets(data, "correct horse"); err != nil {
+		t.Fatalf("decryptSecrets() error = %v", err)
+	}
+
+	for _, iterations := range []uint32{0, 1, 4000000000} {
+		tampered := append([]byte(nil), data...)
+		binary.BigEndian.PutUint32(tampered[len(secretsMagic):], iterations)
+		if _, err := decryptSecrets(tampered, "correct horse"); err == nil || !strings.Contains(err.Error(), "work factor") {
+			t.Errorf("decryptSecrets(%d iterations) error = %v, want a work factor error", iterations, err)
+		}
+	}
+}
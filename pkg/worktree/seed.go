@@ -0,0 +1,178 @@
+package worktree
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/glanotte/grove/pkg/runner"
+)
+
+// healthPollInterval is how often waitHealthy checks the containers
+const healthPollInterval = 2 * time.Second
+
+// seedDatabase fills the branch's freshly created database from the
+// configured seed sources and records it in the grove state
+func (m *Manager) seedDatabase(ctx context.Context, worktreePath, branchName string) error {
+	seed := m.Config.Database.Seed
+	if seed.Source == "" && seed.Command == "" && seed.Service == "" {
+		return nil
+	}
+
+	driver, err := m.database(ctx, worktreePath)
+	if err != nil {
+		return err
+	}
+	name := m.databaseName(branchName)
+
+	if seed.Source != "" {
+		fmt.Printf("Seeding %s from %s...\n", name, seed.Source)
+		f, err := os.Open(m.resolvePath(seed.Source))
+		if err != nil {
+			return fmt.Errorf("failed to open seed source: %w", err)
+		}
+		err = driver.ImportSQL(name, f)
+		f.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	if seed.Command != "" {
+		fmt.Printf("Seeding %s with '%s'...\n", name, seed.Command)
+		vars := m.buildTemplateContext(ctx, worktreePath, branchName)
+		if err := m.runShell(ctx, "seed command", seed.Command, worktreePath, hookEnv("seed", m.BaseDir, vars), 0); err != nil {
+			return err
+		}
+	}
+
+	if seed.Service != "" {
+		fmt.Printf("Seeding %s with the %s service...\n", name, seed.Service)
+		cmd := m.compose(worktreePath, "run", "--rm", seed.Service)
+		cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+		if _, err := m.run(ctx, cmd); err != nil {
+			return fmt.Errorf("seed service %s failed: %w", seed.Service, err)
+		}
+	}
+
+	return m.updateState(func(state *State) error {
+		wt := state.Worktrees[branchName]
+		if wt.Branch == "" {
+			wt = WorktreeState{Branch: branchName, Path: worktreePath}
+		}
+		now := time.Now()
+		wt.SeededAt = &now
+		state.Worktrees[branchName] = wt
+		return nil
+	})
+}
+
+// Reseed drops a worktree's database and recreates it from the seed sources
+func (m *Manager) Reseed(name string) error {
+	return m.ReseedContext(context.Background(), name)
+}
+
+// ReseedContext is Reseed with a context
+func (m *Manager) ReseedContext(ctx context.Context, name string) error {
+	release, err := m.lock(ctx, true)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	if !m.Config.Database.Enabled || !m.Config.Database.Seed.Enabled {
+		return fmt.Errorf("database seeding is not enabled in the grove config")
+	}
+
+	wt, err := m.findWorktree(ctx, name)
+	if err != nil {
+		return err
+	}
+	branchName := worktreeBranch(wt)
+
+	driver, err := m.database(ctx, wt.Path)
+	if err != nil {
+		return err
+	}
+
+	dbName := m.databaseName(branchName)
+	if err := driver.DropDatabase(dbName); err != nil {
+		return err
+	}
+	if err := driver.CreateDatabase(dbName); err != nil {
+		return err
+	}
+
+	if err := m.seedDatabase(ctx, wt.Path, branchName); err != nil {
+		return err
+	}
+	fmt.Printf("Reseeded database %s\n", dbName)
+	return nil
+}
+
+// waitHealthy waits until every container of the worktree's compose project
+// is healthy, or running when it has no health check, for up to the health
+// timeout
+func (m *Manager) waitHealthy(ctx context.Context, worktreePath string) error {
+	timeout := m.stepTimeout(stepHealth)
+	var deadline <-chan time.Time
+	if timeout > 0 {
+		deadline = time.After(timeout)
+	}
+
+	for {
+		pending, err := m.unhealthyContainers(ctx, worktreePath)
+		if err != nil {
+			return err
+		}
+		if len(pending) == 0 {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-deadline:
+			return fmt.Errorf("containers not healthy after %s: %s", timeout, strings.Join(pending, ", "))
+		case <-time.After(healthPollInterval):
+		}
+	}
+}
+
+// unhealthyContainers lists the worktree's containers that aren't ready yet
+func (m *Manager) unhealthyContainers(ctx context.Context, worktreePath string) ([]string, error) {
+	ps, err := m.runStep(ctx, stepDocker, m.compose(worktreePath, "ps", "-q"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list containers: %w", err)
+	}
+
+	ids := strings.Fields(string(ps.Stdout))
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	args := append([]string{"inspect", "-f", "{{.Name}} {{if .State.Health}}{{.State.Health.Status}}{{else}}{{.State.Status}}{{end}}"}, ids...)
+	inspect, err := m.runStep(ctx, stepDocker, runner.Command("docker", args...))
+	if err != nil {
+		return nil, fmt.Errorf("failed to inspect containers: %s", commandOutput(inspect, err))
+	}
+
+	return pendingContainers(string(inspect.Stdout)), nil
+}
+
+// pendingContainers parses "name status" lines from docker inspect
+func pendingContainers(output string) []string {
+	var pending []string
+	for _, line := range strings.Split(strings.TrimSpace(output), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+		if fields[1] != "healthy" && fields[1] != "running" {
+			pending = append(pending, strings.TrimPrefix(fields[0], "/")+" ("+fields[1]+")")
+		}
+	}
+	return pending
+}
@@ -0,0 +1,77 @@
+package worktree
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestManager_seedOnCreate(t *testing.T) {
+	db := newFakeDatabase()
+	manager := newDatabaseTestManager(t, db)
+
+	seedsDir := filepath.Join(manager.BaseDir, ".grove", "seeds")
+	if err := os.MkdirAll(seedsDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(seedsDir, "development.sql"), []byte("INSERT INTO users VALUES (1);"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	worktreePath := filepath.Join(manager.BaseDir, "worktrees", "feature-auth")
+	if err := os.MkdirAll(worktreePath, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	manager.Config.Database.Seed = SeedConfig{
+		Enabled:  true,
+		OnCreate: true,
+		Source:   ".grove/seeds/development.sql",
+		Command:  `echo "$GROVE_DATABASE_NAME" > seeded`,
+	}
+
+	if err := manager.provisionDatabase(context.Background(), nil, worktreePath, "feature/auth"); err != nil {
+		t.Fatalf("provisionDatabase() error = %v", err)
+	}
+
+	if got := db.imported["testapp_feature_auth"]; got != "INSERT INTO users VALUES (1);" {
+		t.Errorf("Expected the seed file to be imported, got %q", got)
+	}
+
+	out, err := os.ReadFile(filepath.Join(worktreePath, "seeded"))
+	if err != nil {
+		t.Fatalf("Expected the seed command to run: %v", err)
+	}
+	if string(out) != "testapp_feature_auth\n" {
+		t.Errorf("seed command saw database %q", out)
+	}
+
+	state, err := manager.loadState()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state.Worktrees["feature/auth"].SeededAt == nil {
+		t.Error("Expected the worktree to be recorded as seeded")
+	}
+
+	// An existing database isn't seeded again
+	db.imported = make(map[string]string)
+	if err := manager.provisionDatabase(context.Background(), nil, worktreePath, "feature/auth"); err != nil {
+		t.Fatal(err)
+	}
+	if len(db.imported) != 0 {
+		t.Errorf("Expected no seeding for an existing database, got %v", db.imported)
+	}
+}
+
+func TestPendingContainers(t *testing.T) {
+	output := "/app_web_1 running\n/app_db_1 starting\n/app_redis_1 healthy\n/app_worker_1 exited\n"
+
+	got := pendingContainers(output)
+	want := []string{"app_db_1 (starting)", "app_worker_1 (exited)"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("pendingContainers() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,295 @@
+package worktree
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// stateVersion is the state file format this grove reads and writes
+const stateVersion = 1
+
+// groveIgnore keeps the files grove writes at runtime out of git, since
+// .grove also holds the committed config. The state holds generated
+// credentials, and the certs directory private keys.
+const groveIgnore = `# Written by grove: local files that must not be committed
+config.local.yaml
+state.json
+state.lock
+grove.lock
+secrets.enc
+backups/
+certs/
+proxy/
+traefik/
+caddy/
+nginx/
+`
+
+// State records what grove knows about the worktrees it created
+type State struct {
+	Version   int                      `json:"version"`
+	Worktrees map[string]WorktreeState `json:"worktrees"`
+}
+
+// WorktreeState is grove's record of a single worktree, keyed by branch
+type WorktreeState struct {
+	Branch string `json:"branch"`
+	// Slug is the sanitized, collision-free name used for {branch}
+	Slug string `json:"slug"`
+	// BranchID is a small integer unique among live worktrees, used for
+	// {branch_id} and the Redis database index
+	BranchID  int       `json:"branch_id"`
+	Path      string    `json:"path"`
+	CreatedAt time.Time `json:"created_at"`
+	// BaseBranch is the --from branch a new branch was created from
+	BaseBranch string `json:"base_branch,omitempty"`
+	// Template is the template set the worktree was rendered with
+	Template string `json:"template,omitempty"`
+	// User and Date are the {user} and {date} values at creation
+	User string `json:"user,omitempty"`
+	Date string `json:"date,omitempty"`
+	// Env is the environment overlay selected at creation
+	Env  string `json:"env,omitempty"`
+	Port int    `json:"port,omitempty"`
+	// Host is the proxy route's hostname
+	Host string `json:"host,omitempty"`
+	// SeededAt is when the worktree's database was last seeded
+	SeededAt *time.Time `json:"seeded_at,omitempty"`
+	// Generated holds the values of generated variables, such as passwords
+	Generated map[string]string `json:"generated,omitempty"`
+}
+
+// statePath returns the location of the grove state file
+func (m *Manager) statePath() string {
+	return filepath.Join(m.BaseDir, ".grove", "state.json")
+}
+
+// stateLockPath returns the lock file serializing state updates
+func (m *Manager) stateLockPath() string {
+	return filepath.Join(m.BaseDir, ".grove", "state.lock")
+}
+
+// loadState reads the grove state, returning an empty state if none exists.
+// Writes replace the file atomically, so reads need no lock.
+func (m *Manager) loadState() (*State, error) {
+	state := &State{Version: stateVersion, Worktrees: make(map[string]WorktreeState)}
+
+	data, err := os.ReadFile(m.statePath())
+	if os.IsNotExist(err) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read state: %w", err)
+	}
+
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, fmt.Errorf("failed to parse state: %w", err)
+	}
+	if state.Version > stateVersion {
+		return nil, fmt.Errorf("state file version %d is newer than this grove supports (%d); upgrade grove", state.Version, stateVersion)
+	}
+	if state.Worktrees == nil {
+		state.Worktrees = make(map[string]WorktreeState)
+	}
+
+	return state, nil
+}
+
+// saveState writes the grove state atomically. It holds generated
+// credentials, so only the owner can read it.
+func (m *Manager) saveState(state *State) error {
+	state.Version = stateVersion
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode state: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(m.statePath()), 0755); err != nil {
+		return fmt.Errorf("failed to create state directory: %w", err)
+	}
+	if err := m.ensureGroveIgnore(); err != nil {
+		return err
+	}
+
+	return writeFileAtomic(m.statePath(), append(data, '\n'), 0600)
+}
+
+// ensureGroveIgnore writes .grove/.gitignore unless the project has one
+func (m *Manager) ensureGroveIgnore() error {
+	path := filepath.Join(m.BaseDir, ".grove", ".gitignore")
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		return nil
+	}
+	if err := writeFileAtomic(path, []byte(groveIgnore), 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return nil
+}
+
+// updateState applies fn to the grove state and saves the result, holding
+// the state lock so concurrent updates aren't lost
+func (m *Manager) updateState(fn func(*State) error) error {
+	if err := os.MkdirAll(filepath.Dir(m.stateLockPath()), 0755); err != nil {
+		return fmt.Errorf("failed to create state directory: %w", err)
+	}
+	lock, err := os.OpenFile(m.stateLockPath(), os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open state lock: %w", err)
+	}
+	defer lock.Close()
+	if err := flock(lock, true); err != nil {
+		return fmt.Errorf("failed to lock state: %w", err)
+	}
+	defer funlock(lock)
+
+	state, err := m.loadState()
+	if err != nil {
+		return err
+	}
+	if err := fn(state); err != nil {
+		return err
+	}
+	return m.saveState(state)
+}
+
+// StateEntries returns the recorded worktrees sorted by name
+func (m *Manager) StateEntries() ([]WorktreeState, error) {
+	return m.StateEntriesContext(context.Background())
+}
+
+// StateEntriesContext is StateEntries with a context
+func (m *Manager) StateEntriesContext(ctx context.Context) ([]WorktreeState, error) {
+	release, err := m.lock(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	state, err := m.loadState()
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]WorktreeState, 0, len(state.Worktrees))
+	for _, wt := range state.Worktrees {
+		entries = append(entries, wt)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return filepath.Base(entries[i].Path) < filepath.Base(entries[j].Path)
+	})
+	return entries, nil
+}
+
+// Reconciliation reports the changes ReconcileState made
+type Reconciliation struct {
+	// Removed lists branches whose worktree git no longer knows about
+	Removed []string `json:"removed"`
+	// Adopted lists branches checked out under the worktree base path that
+	// grove had no record of
+	Adopted []string `json:"adopted"`
+}
+
+// ReconcileState brings the state in line with `git worktree list`
+func (m *Manager) ReconcileState() (*Reconciliation, error) {
+	return m.ReconcileStateContext(context.Background())
+}
+
+// ReconcileStateContext is ReconcileState with a context
+func (m *Manager) ReconcileStateContext(ctx context.Context) (*Reconciliation, error) {
+	release, err := m.lock(ctx, true)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	return m.reconcile(ctx)
+}
+
+// TryReconcileState reconciles the state unless another grove process is
+// busy with the project, returning nil in that case
+func (m *Manager) TryReconcileState() (*Reconciliation, error) {
+	return m.TryReconcileStateContext(context.Background())
+}
+
+// TryReconcileStateContext is TryReconcileState with a context
+func (m *Manager) TryReconcileStateContext(ctx context.Context) (*Reconciliation, error) {
+	release, locked, err := m.tryLock(true)
+	if err != nil || !locked {
+		return nil, err
+	}
+	defer release()
+
+	return m.reconcile(ctx)
+}
+
+func (m *Manager) reconcile(ctx context.Context) (*Reconciliation, error) {
+	worktrees, err := m.ListWorktreesContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var result *Reconciliation
+	err = m.updateState(func(state *State) error {
+		result, err = m.reconcileState(state, worktrees)
+		return err
+	})
+	return result, err
+}
+
+// reconcileState drops entries for worktrees that are gone and adopts
+// worktrees under the base path that aren't recorded
+func (m *Manager) reconcileState(state *State, worktrees []WorktreeInfo) (*Reconciliation, error) {
+	result := &Reconciliation{Removed: []string{}, Adopted: []string{}}
+
+	live := make(map[string]bool)
+	for _, wt := range worktrees {
+		live[canonicalPath(wt.Path)] = true
+	}
+	for branch, wt := range state.Worktrees {
+		if !live[canonicalPath(wt.Path)] {
+			delete(state.Worktrees, branch)
+			result.Removed = append(result.Removed, branch)
+		}
+	}
+
+	base := canonicalPath(m.resolvePath(m.Config.Worktree.BasePath))
+	for _, wt := range worktrees {
+		path := canonicalPath(wt.Path)
+		if filepath.Dir(path) != base {
+			continue
+		}
+		branch := worktreeBranch(wt)
+		if recorded, ok := state.Worktrees[branch]; ok && canonicalPath(recorded.Path) == path {
+			continue
+		}
+
+		id, err := m.allocateBranchID(state, branch)
+		if err != nil {
+			return nil, err
+		}
+		state.Worktrees[branch] = WorktreeState{
+			Branch:   branch,
+			Slug:     filepath.Base(path),
+			BranchID: id,
+			Path:     wt.Path,
+		}
+		result.Adopted = append(result.Adopted, branch)
+	}
+
+	sort.Strings(result.Removed)
+	sort.Strings(result.Adopted)
+	return result, nil
+}
+
+// canonicalPath resolves symlinks so paths from git and grove compare equal
+func canonicalPath(path string) string {
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		return resolved
+	}
+	return filepath.Clean(path)
+}
@@ -0,0 +1,154 @@
+package worktree
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func newStateTestManager(t *testing.T) *Manager {
+	t.Helper()
+	return &Manager{
+		BaseDir: t.TempDir(),
+		Config: &Config{
+			Project:  ProjectConfig{Name: "testapp", Domain: "app.test"},
+			Worktree: WorktreeConfig{BasePath: "./worktrees"},
+		},
+	}
+}
+
+func TestManager_reconcileState(t *testing.T) {
+	m := newStateTestManager(t)
+	base := filepath.Join(m.BaseDir, "worktrees")
+	for _, name := range []string{"kept", "manual"} {
+		if err := os.MkdirAll(filepath.Join(base, name), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	state := &State{Worktrees: map[string]WorktreeState{
+		"kept":    {Branch: "kept", Slug: "kept", BranchID: 1, Path: filepath.Join(base, "kept"), Template: "rails"},
+		"deleted": {Branch: "deleted", Slug: "deleted", BranchID: 2, Path: filepath.Join(base, "deleted")},
+	}}
+	worktrees := []WorktreeInfo{
+		{Path: m.BaseDir, Branch: "main"},
+		{Path: filepath.Join(base, "kept"), Branch: "kept"},
+		{Path: filepath.Join(base, "manual"), Branch: "feature/manual"},
+	}
+
+	result, err := m.reconcileState(state, worktrees)
+	if err != nil {
+		t.Fatalf("reconcileState() error = %v", err)
+	}
+	if !reflect.DeepEqual(result.Removed, []string{"deleted"}) {
+		t.Errorf("Removed = %v, want [deleted]", result.Removed)
+	}
+	// The main checkout lies outside the base path and isn't adopted
+	if !reflect.DeepEqual(result.Adopted, []string{"feature/manual"}) {
+		t.Errorf("Adopted = %v, want [feature/manual]", result.Adopted)
+	}
+
+	if state.Worktrees["kept"].Template != "rails" {
+		t.Errorf("kept entry lost its template: %+v", state.Worktrees["kept"])
+	}
+	adopted := state.Worktrees["feature/manual"]
+	if adopted.Slug != "manual" || adopted.BranchID == 0 || adopted.BranchID == 1 {
+		t.Errorf("adopted entry = %+v, want slug manual and a free branch ID", adopted)
+	}
+
+	// A second pass has nothing to do
+	result, err = m.reconcileState(state, worktrees)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Removed) != 0 || len(result.Adopted) != 0 {
+		t.Errorf("second reconcileState() = %+v, want no changes", result)
+	}
+}
+
+func TestManager_loadState_version(t *testing.T) {
+	m := newStateTestManager(t)
+	if err := m.saveState(&State{Worktrees: map[string]WorktreeState{}}); err != nil {
+		t.Fatal(err)
+	}
+	state, err := m.loadState()
+	if err != nil {
+		t.Fatalf("loadState() error = %v", err)
+	}
+	if state.Version != stateVersion {
+		t.Errorf("Version = %d, want %d", state.Version, stateVersion)
+	}
+
+	if err := os.WriteFile(m.statePath(), []byte(`{"version": 99, "worktrees": {}}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.loadState(); err == nil {
+		t.Error("loadState() accepted a newer state version")
+	}
+}
+
+func TestManager_updateState_concurrent(t *testing.T) {
+	m := newStateTestManager(t)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			err := m.updateState(func(state *State) error {
+				branch := string(rune('a' + i))
+				state.Worktrees[branch] = WorktreeState{Branch: branch}
+				return nil
+			})
+			if err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	state, err := m.loadState()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(state.Worktrees) != 20 {
+		t.Errorf("state has %d worktrees, want 20; updates were lost", len(state.Worktrees))
+	}
+}
+
+func TestManager_saveStateIgnore(t *testing.T) {
+	m := newStateTestManager(t)
+	state := &State{Worktrees: map[string]WorktreeState{
+		"feature/auth": {Branch: "feature/auth", Generated: map[string]string{"db_password": "s3cret"}},
+	}}
+	if err := m.saveState(state); err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(m.BaseDir, ".grove", ".gitignore")
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("saveState() didn't write %s: %v", path, err)
+	}
+	ignored := strings.Fields(string(data))
+	for _, want := range []string{"state.json", "secrets.enc", "config.local.yaml", "certs/"} {
+		if !slices.Contains(ignored, want) {
+			t.Errorf(".gitignore doesn't ignore %s:\n%s", want, data)
+		}
+	}
+
+	// A project's own .gitignore is left alone
+	if err := os.WriteFile(path, []byte("state.json\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.saveState(state); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "state.json\n" {
+		t.Errorf("saveState() rewrote .gitignore: %s", data)
+	}
+}
@@ -0,0 +1,96 @@
+package worktree
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/glanotte/grove/pkg/runner"
+)
+
+// Steps bounded by the timeouts: config section
+const (
+	stepGit      = "git"
+	stepDocker   = "docker"
+	stepDatabase = "database"
+	stepProxy    = "proxy"
+	stepHealth   = "health"
+)
+
+// defaultStepTimeouts bound steps the config leaves unset. Database commands
+// have no default, as dumps and restores of large databases take a while.
+var defaultStepTimeouts = map[string]time.Duration{
+	stepGit:    5 * time.Minute,
+	stepDocker: 10 * time.Minute,
+	stepProxy:  time.Minute,
+	stepHealth: 2 * time.Minute,
+}
+
+// TimeoutError is returned when a step runs past its configured timeout
+type TimeoutError struct {
+	// Step is the timeouts: key that bounded it, e.g. "git"
+	Step string
+	// Op describes what timed out
+	Op      string
+	Timeout time.Duration
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("%s timed out after %s", e.Op, e.Timeout)
+}
+
+// Unwrap lets errors.Is match context.DeadlineExceeded
+func (e *TimeoutError) Unwrap() error {
+	return context.DeadlineExceeded
+}
+
+// stepTimeout returns the bound for a kind of step; zero means none
+func (m *Manager) stepTimeout(step string) time.Duration {
+	var value string
+	switch step {
+	case stepGit:
+		value = m.Config.Timeouts.Git
+	case stepDocker:
+		value = m.Config.Timeouts.Docker
+	case stepDatabase:
+		value = m.Config.Timeouts.Database
+	case stepProxy:
+		value = m.Config.Timeouts.Proxy
+	case stepHealth:
+		value = m.Config.Timeouts.Health
+	}
+	if timeout, err := time.ParseDuration(value); err == nil {
+		return timeout
+	}
+	return defaultStepTimeouts[step]
+}
+
+// withTimeout runs fn under the step's timeout. Running out of time fails
+// with a TimeoutError, while cancelling ctx itself is reported as is.
+func (m *Manager) withTimeout(ctx context.Context, step, op string, fn func(context.Context) error) error {
+	timeout := m.stepTimeout(step)
+	if timeout <= 0 {
+		return fn(ctx)
+	}
+
+	stepCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	err := fn(stepCtx)
+	if err != nil && ctx.Err() == nil && errors.Is(stepCtx.Err(), context.DeadlineExceeded) {
+		return &TimeoutError{Step: step, Op: op, Timeout: timeout}
+	}
+	return err
+}
+
+// runStep runs an external command under the step's timeout
+func (m *Manager) runStep(ctx context.Context, step string, cmd runner.Cmd) (runner.Result, error) {
+	var result runner.Result
+	err := m.withTimeout(ctx, step, m.redact(cmd.String()), func(ctx context.Context) error {
+		var err error
+		result, err = m.run(ctx, cmd)
+		return err
+	})
+	return result, err
+}
@@ -0,0 +1,67 @@
+package worktree
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/glanotte/grove/pkg/runner"
+)
+
+func TestManager_stepTimeout(t *testing.T) {
+	manager := &Manager{Config: &Config{Timeouts: TimeoutsConfig{Git: "30s", Docker: "0"}}}
+
+	tests := map[string]time.Duration{
+		stepGit:      30 * time.Second,
+		stepDocker:   0,
+		stepDatabase: 0,
+		stepProxy:    time.Minute,
+		stepHealth:   2 * time.Minute,
+	}
+	for step, want := range tests {
+		if got := manager.stepTimeout(step); got != want {
+			t.Errorf("stepTimeout(%s) = %s, want %s", step, got, want)
+		}
+	}
+}
+
+func TestManager_withTimeout(t *testing.T) {
+	manager := &Manager{Config: &Config{Timeouts: TimeoutsConfig{Git: "20ms"}}}
+	block := func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+
+	err := manager.withTimeout(context.Background(), stepGit, "git worktree add", block)
+	var timeoutErr *TimeoutError
+	if !errors.As(err, &timeoutErr) || timeoutErr.Step != stepGit {
+		t.Fatalf("withTimeout() error = %v, want a git TimeoutError", err)
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Error("TimeoutError should match context.DeadlineExceeded")
+	}
+	if want := "git worktree add timed out after 20ms"; err.Error() != want {
+		t.Errorf("Error() = %q, want %q", err.Error(), want)
+	}
+
+	// Cancellation from the caller isn't a timeout
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := manager.withTimeout(ctx, stepGit, "git worktree add", block); !errors.Is(err, context.Canceled) || errors.As(err, &timeoutErr) {
+		t.Errorf("withTimeout(cancelled) error = %v, want context.Canceled", err)
+	}
+}
+
+func TestManager_runStep(t *testing.T) {
+	fake := runner.NewFake()
+	fake.On("docker network create", runner.Response{})
+	manager := &Manager{Config: &Config{Timeouts: TimeoutsConfig{Docker: "1m"}}, Runner: fake}
+
+	if _, err := manager.runStep(context.Background(), stepDocker, runner.Command("docker", "network", "create", "app")); err != nil {
+		t.Fatalf("runStep() error = %v", err)
+	}
+	if !fake.Ran("docker network create app") {
+		t.Error("runStep() did not run the command")
+	}
+}